@@ -0,0 +1,137 @@
+package gosdjwt
+
+// Builder builds an instruction tree claim by claim
+type Builder struct {
+	children []Instruction
+}
+
+// NewBuilder returns an empty builder
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Claim adds a plain claim, which is selective disclosable when it is added to a RecursiveSD object, see AlwaysVisible
+func (b *Builder) Claim(name string, value any) *Builder {
+	b.children = append(b.children, &ChildInstructionV2{
+		Name:  name,
+		Value: value,
+	})
+	return b
+}
+
+// AlwaysVisible adds a plain claim that stays visible when it is added to a RecursiveSD object
+func (b *Builder) AlwaysVisible(name string, value any) *Builder {
+	b.children = append(b.children, &ChildInstructionV2{
+		Name:          name,
+		Value:         value,
+		AlwaysVisible: true,
+	})
+	return b
+}
+
+// SD adds a selective disclosable claim
+func (b *Builder) SD(name string, value any) *Builder {
+	b.children = append(b.children, &ChildInstructionV2{
+		Name:                name,
+		Value:               value,
+		SelectiveDisclosure: true,
+	})
+	return b
+}
+
+// Object adds a plain object, its claims are added by build
+func (b *Builder) Object(name string, build func(b *Builder)) *Builder {
+	b.children = append(b.children, &ParentInstructionV2{
+		Name:     name,
+		Children: buildChildren(build),
+	})
+	return b
+}
+
+// SDObject adds a selective disclosable object, its claims are added by build
+func (b *Builder) SDObject(name string, build func(b *Builder)) *Builder {
+	b.children = append(b.children, &ParentInstructionV2{
+		Name:                name,
+		SelectiveDisclosure: true,
+		Children:            buildChildren(build),
+	})
+	return b
+}
+
+// RecursiveSD adds a recursive selective disclosable object, its claims are added by build
+func (b *Builder) RecursiveSD(name string, build func(b *Builder)) *Builder {
+	b.children = append(b.children, &RecursiveInstructionV2{
+		Name:     name,
+		Children: buildChildren(build),
+	})
+	return b
+}
+
+// Array adds an array of plain values
+func (b *Builder) Array(name string, values ...any) *Builder {
+	return b.array(name, false, values)
+}
+
+// SDArray adds an array where each element is selective disclosable
+func (b *Builder) SDArray(name string, values ...any) *Builder {
+	return b.array(name, true, values)
+}
+
+// SDWholeArray adds a selective disclosable array of plain values, disclosed as one claim
+func (b *Builder) SDWholeArray(name string, values ...any) *Builder {
+	array := newBuilderArray(name, false, values)
+	array.SelectiveDisclosure = true
+	b.children = append(b.children, array)
+	return b
+}
+
+func (b *Builder) array(name string, sd bool, values []any) *Builder {
+	b.children = append(b.children, newBuilderArray(name, sd, values))
+	return b
+}
+
+func newBuilderArray(name string, sd bool, values []any) *ChildArrayInstructionV2 {
+	array := &ChildArrayInstructionV2{
+		Name: name,
+	}
+	for _, value := range values {
+		array.Children = append(array.Children, &ChildInstructionV2{
+			Value:               value,
+			SelectiveDisclosure: sd,
+		})
+	}
+	return array
+}
+
+// ArrayOf adds an array whose elements are added by build, elements are added without a name,
+// e.g. b.SDObject("", ...) adds a selective disclosable object element
+func (b *Builder) ArrayOf(name string, build func(b *Builder)) *Builder {
+	b.children = append(b.children, &ChildArrayInstructionV2{
+		Name:     name,
+		Children: buildChildren(build),
+	})
+	return b
+}
+
+// Instruction adds an already built instruction
+func (b *Builder) Instruction(instruction Instruction) *Builder {
+	b.children = append(b.children, instruction)
+	return b
+}
+
+// Build returns the validated instruction tree
+func (b *Builder) Build() (InstructionsV2, error) {
+	instructions := InstructionsV2(b.children)
+	if err := instructions.Validate(); err != nil {
+		return nil, err
+	}
+	return instructions, nil
+}
+
+func buildChildren(build func(b *Builder)) []Instruction {
+	child := NewBuilder()
+	if build != nil {
+		build(child)
+	}
+	return child.children
+}
@@ -0,0 +1,135 @@
+package gosdjwt
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	got, err := NewBuilder().
+		Claim("iss", "https://example.com").
+		SD("given_name", "John").
+		Object("address", func(b *Builder) {
+			b.Claim("country", "SE").SD("street", "Storgatan 1")
+		}).
+		SDObject("birth", func(b *Builder) {
+			b.Claim("date", "1970-01-01")
+		}).
+		RecursiveSD("place_of_birth", func(b *Builder) {
+			b.Claim("city", "Stockholm")
+		}).
+		Array("nationalities", "SE").
+		SDArray("phones", "1", "2").
+		ArrayOf("addresses", func(b *Builder) {
+			b.SDObject("", func(b *Builder) {
+				b.SD("street", "Storgatan 1")
+			}).SDArray("", "a")
+		}).
+		Build()
+	assert.NoError(t, err)
+
+	want := InstructionsV2{
+		&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ParentInstructionV2{
+			Name: "address",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "country", Value: "SE"},
+				&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+			},
+		},
+		&ParentInstructionV2{
+			Name:                "birth",
+			SelectiveDisclosure: true,
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "date", Value: "1970-01-01"},
+			},
+		},
+		&RecursiveInstructionV2{
+			Name: "place_of_birth",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+			},
+		},
+		&ChildArrayInstructionV2{
+			Name:     "nationalities",
+			Children: []Instruction{&ChildInstructionV2{Value: "SE"}},
+		},
+		&ChildArrayInstructionV2{
+			Name: "phones",
+			Children: []Instruction{
+				&ChildInstructionV2{Value: "1", SelectiveDisclosure: true},
+				&ChildInstructionV2{Value: "2", SelectiveDisclosure: true},
+			},
+		},
+		&ChildArrayInstructionV2{
+			Name: "addresses",
+			Children: []Instruction{
+				&ParentInstructionV2{
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "a", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestBuilderNotValid(t *testing.T) {
+	_, err := NewBuilder().
+		Claim("iss", "https://example.com").
+		SD("iss", "https://example.org").
+		Object("address", func(b *Builder) {
+			b.Claim("", "no name")
+		}).
+		Build()
+	assert.ErrorIs(t, err, ErrInstructionNameDuplicate)
+	assert.ErrorIs(t, err, ErrInstructionNameEmpty)
+}
+
+func TestBuilderAlwaysVisibleAndWholeArray(t *testing.T) {
+	got, err := NewBuilder().
+		RecursiveSD("place_of_birth", func(b *Builder) {
+			b.Claim("city", "Stockholm").AlwaysVisible("country", "SE")
+		}).
+		SDWholeArray("nationalities", "SE", "FI").
+		Build()
+	assert.NoError(t, err)
+
+	want := InstructionsV2{
+		&RecursiveInstructionV2{
+			Name: "place_of_birth",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+				&ChildInstructionV2{Name: "country", Value: "SE", AlwaysVisible: true},
+			},
+		},
+		&ChildArrayInstructionV2{
+			Name:                "nationalities",
+			SelectiveDisclosure: true,
+			Children:            []Instruction{&ChildInstructionV2{Value: "SE"}, &ChildInstructionV2{Value: "FI"}},
+		},
+	}
+	assert.Equal(t, want, got)
+
+	sdjwt, err := got.SDJWT(jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+	claims, _, err := Verify(sdjwt.String(), "mura")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"SE", "FI"}, claims["nationalities"])
+	assert.Equal(t, map[string]any{"city": "Stockholm", "country": "SE"}, claims["place_of_birth"])
+
+	undisclosed, _, err := Verify(sdjwt.JWT+"~", "mura")
+	assert.NoError(t, err)
+	assert.NotContains(t, undisclosed, "nationalities")
+	assert.NotContains(t, undisclosed, "place_of_birth")
+}
@@ -1,10 +1,235 @@
 package gosdjwt
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
 const (
+	// RuleParent is the key in a rule object that holds the rule of the object itself
+	RuleParent = "sdjwt::parent"
+
+	// RuleSelectiveDisclosure makes a claim selective disclosable
 	RuleSelectiveDisclosure = "sdjwt::rule::selective_disclosure"
+
+	// RuleRecursiveSelectiveDisclosure makes an object selective disclosable, and all of its children recursively
+	RuleRecursiveSelectiveDisclosure = "sdjwt::rule::recursive_selective_disclosure"
+
+	// RuleNone leaves a claim as a plain, always visible, claim
+	RuleNone = ""
+)
+
+var (
+	// ErrRuleClaimNotFound is returned when a rule reference a claim that is not present in the document
+	ErrRuleClaimNotFound = errors.New("rule reference a claim that is not present in the document")
+
+	// ErrRuleNotKnown is returned when a rule is not known
+	ErrRuleNotKnown = errors.New("rule is not known")
+
+	// ErrRuleTypeMismatch is returned when the shape of a rule does not match the shape of the claim
+	ErrRuleTypeMismatch = errors.New("rule does not match the type of the claim")
 )
 
-// ConvertJSON2SDJWT converts a JSON document to a SDJWT
+// ConvertJSON2SDJWT converts a JSON document to a SDJWT.
+//
+// The rules document mirrors the structure of the JSON document. A claim without a rule is
+// added as a plain claim. A rule is either a string (RuleNone, RuleSelectiveDisclosure or
+// RuleRecursiveSelectiveDisclosure), an object with rules for the children of an object claim
+// where the key RuleParent holds the rule of the object itself, or an array with one rule for
+// each element of an array claim. A string rule on an array claim applies to every element,
+// where an element rule on an object or array element works as the rule of a claim.
+//
+// Instructions are sorted by claim name to make the output deterministic.
 func ConvertJSON2SDJWT(document map[string]any, rules map[string]any) (InstructionsV2, error) {
-	return InstructionsV2{}, nil
+	if err := checkRules(document, rules, ""); err != nil {
+		return nil, err
+	}
+
+	instructions := InstructionsV2{}
+	for _, name := range sortedKeys(document) {
+		instruction, err := convertClaim(name, document[name], rules[name], joinPath("", name), false)
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, instruction)
+	}
+
+	return instructions, nil
+}
+
+// checkRules makes sure that every rule reference a claim in the document
+func checkRules(document map[string]any, rules map[string]any, path string) error {
+	for name, rule := range rules {
+		if name == RuleParent {
+			continue
+		}
+		claimPath := joinPath(path, name)
+		claim, ok := document[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrRuleClaimNotFound, claimPath)
+		}
+		if err := checkRule(claim, rule, claimPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkRule(claim, rule any, path string) error {
+	switch r := rule.(type) {
+	case nil, string:
+		return nil
+	case map[string]any:
+		c, ok := claim.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrRuleTypeMismatch, path)
+		}
+		return checkRules(c, r, path)
+	case []any:
+		c, ok := claim.([]any)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrRuleTypeMismatch, path)
+		}
+		for i, elementRule := range r {
+			elementPath := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(c) {
+				return fmt.Errorf("%w: %s", ErrRuleClaimNotFound, elementPath)
+			}
+			if err := checkRule(c[i], elementRule, elementPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrRuleNotKnown, path)
+	}
+}
+
+// ruleOf returns the string rule of a claim, for object rules the RuleParent value is used
+func ruleOf(rule any, path string) (string, error) {
+	switch r := rule.(type) {
+	case nil:
+		return RuleNone, nil
+	case string:
+		switch r {
+		case RuleNone, RuleSelectiveDisclosure, RuleRecursiveSelectiveDisclosure:
+			return r, nil
+		}
+		return "", fmt.Errorf("%w: %s: %q", ErrRuleNotKnown, path, r)
+	case map[string]any:
+		return ruleOf(r[RuleParent], path)
+	case []any:
+		return RuleNone, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrRuleNotKnown, path)
+	}
+}
+
+// hasExplicitRuleNone returns true if RuleNone is set for the claim, and not just left out
+func hasExplicitRuleNone(rule any) bool {
+	switch r := rule.(type) {
+	case string:
+		return r == RuleNone
+	case map[string]any:
+		parentRule, ok := r[RuleParent]
+		return ok && parentRule == RuleNone
+	}
+	return false
+}
+
+// convertClaim converts one claim into an instruction, inRecursive is true when the claim is a child of a recursive parent.
+// Children of a recursive parent are selective disclosable, unless RuleNone is set explicitly which makes them always visible.
+func convertClaim(name string, claim, rule any, path string, inRecursive bool) (Instruction, error) {
+	r, err := ruleOf(rule, path)
+	if err != nil {
+		return nil, err
+	}
+
+	alwaysVisible := inRecursive && hasExplicitRuleNone(rule)
+	if alwaysVisible {
+		inRecursive = false
+	}
+
+	switch c := claim.(type) {
+	case map[string]any:
+		childRules, _ := rule.(map[string]any)
+
+		if inRecursive || r == RuleRecursiveSelectiveDisclosure {
+			parent := &RecursiveInstructionV2{
+				Name: name,
+			}
+			for _, childName := range sortedKeys(c) {
+				child, err := convertClaim(childName, c[childName], childRules[childName], joinPath(path, childName), true)
+				if err != nil {
+					return nil, err
+				}
+				parent.Children = append(parent.Children, child)
+			}
+			return parent, nil
+		}
+
+		parent := &ParentInstructionV2{
+			Name:                name,
+			SelectiveDisclosure: r == RuleSelectiveDisclosure,
+			AlwaysVisible:       alwaysVisible,
+		}
+		for _, childName := range sortedKeys(c) {
+			child, err := convertClaim(childName, c[childName], childRules[childName], joinPath(path, childName), false)
+			if err != nil {
+				return nil, err
+			}
+			parent.Children = append(parent.Children, child)
+		}
+		return parent, nil
+
+	case []any:
+		array := &ChildArrayInstructionV2{
+			Name:          name,
+			AlwaysVisible: alwaysVisible,
+		}
+		elementRules, _ := rule.([]any)
+		for i, element := range c {
+			elementRule := rule
+			if elementRules != nil {
+				elementRule = nil
+				if i < len(elementRules) {
+					elementRule = elementRules[i]
+				}
+			}
+			child, err := convertClaim("", element, elementRule, fmt.Sprintf("%s[%d]", path, i), false)
+			if err != nil {
+				return nil, err
+			}
+			array.Children = append(array.Children, child)
+		}
+		return array, nil
+
+	default:
+		if r == RuleRecursiveSelectiveDisclosure {
+			return nil, fmt.Errorf("%w: %s: only objects can be recursive", ErrRuleTypeMismatch, path)
+		}
+		return &ChildInstructionV2{
+			Name:                name,
+			Value:               claim,
+			SelectiveDisclosure: inRecursive || r == RuleSelectiveDisclosure,
+			AlwaysVisible:       alwaysVisible,
+		}, nil
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
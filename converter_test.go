@@ -1,13 +1,15 @@
 package gosdjwt
 
 import (
+	"encoding/json"
+	"os"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestConvertJSON2SDJWT(t *testing.T) {
-	t.SkipNow()
 	type have struct {
 		claims map[string]any
 		rules  map[string]any
@@ -30,7 +32,7 @@ func TestConvertJSON2SDJWT(t *testing.T) {
 			want: InstructionsV2{
 				&ParentInstructionV2{
 					Name: "p",
-					Children: []any{
+					Children: []Instruction{
 						&ChildInstructionV2{
 							Name:  "k1",
 							Value: "v1",
@@ -39,6 +41,181 @@ func TestConvertJSON2SDJWT(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "test 1 - plain and selective disclosure children",
+			have: have{
+				claims: map[string]any{
+					"given_name": "John",
+					"iss":        "https://example.com",
+				},
+				rules: map[string]any{
+					"given_name": RuleSelectiveDisclosure,
+					"iss":        RuleNone,
+				},
+			},
+			want: InstructionsV2{
+				&ChildInstructionV2{
+					Name:                "given_name",
+					Value:               "John",
+					SelectiveDisclosure: true,
+				},
+				&ChildInstructionV2{
+					Name:  "iss",
+					Value: "https://example.com",
+				},
+			},
+		},
+		{
+			name: "test 2 - selective disclosure parent",
+			have: have{
+				claims: map[string]any{
+					"address": map[string]any{
+						"city":   "Stockholm",
+						"street": "Storgatan 1",
+					},
+				},
+				rules: map[string]any{
+					"address": map[string]any{
+						RuleParent: RuleSelectiveDisclosure,
+						"city":     RuleSelectiveDisclosure,
+					},
+				},
+			},
+			want: InstructionsV2{
+				&ParentInstructionV2{
+					Name:                "address",
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildInstructionV2{
+							Name:                "city",
+							Value:               "Stockholm",
+							SelectiveDisclosure: true,
+						},
+						&ChildInstructionV2{
+							Name:  "street",
+							Value: "Storgatan 1",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "test 3 - recursive parent",
+			have: have{
+				claims: map[string]any{
+					"parent_a": map[string]any{
+						"child_a": "test_a",
+						"parent_b": map[string]any{
+							"child_b": "test_b",
+						},
+					},
+				},
+				rules: map[string]any{
+					"parent_a": RuleRecursiveSelectiveDisclosure,
+				},
+			},
+			want: InstructionsV2{
+				&RecursiveInstructionV2{
+					Name: "parent_a",
+					Children: []Instruction{
+						&ChildInstructionV2{
+							Name:                "child_a",
+							Value:               "test_a",
+							SelectiveDisclosure: true,
+						},
+						&RecursiveInstructionV2{
+							Name: "parent_b",
+							Children: []Instruction{
+								&ChildInstructionV2{
+									Name:                "child_b",
+									Value:               "test_b",
+									SelectiveDisclosure: true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "test 4 - arrays",
+			have: have{
+				claims: map[string]any{
+					"nationalities": []any{"SE", "DK"},
+					"phones":        []any{"1", "2"},
+				},
+				rules: map[string]any{
+					"nationalities": RuleSelectiveDisclosure,
+					"phones":        []any{RuleNone, RuleSelectiveDisclosure},
+				},
+			},
+			want: InstructionsV2{
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "SE", SelectiveDisclosure: true},
+						&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Name: "phones",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "1"},
+						&ChildInstructionV2{Value: "2", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+		{
+			name: "test 5 - arrays of objects and nested arrays",
+			have: have{
+				claims: map[string]any{
+					"addresses": []any{
+						map[string]any{"street": "Storgatan 1", "country": "SE"},
+						map[string]any{"street": "Gade 2", "country": "DK"},
+					},
+					"matrix": []any{[]any{"a", "b"}},
+				},
+				rules: map[string]any{
+					"addresses": []any{
+						map[string]any{RuleParent: RuleSelectiveDisclosure, "street": RuleSelectiveDisclosure},
+						RuleRecursiveSelectiveDisclosure,
+					},
+					"matrix": RuleSelectiveDisclosure,
+				},
+			},
+			want: InstructionsV2{
+				&ChildArrayInstructionV2{
+					Name: "addresses",
+					Children: []Instruction{
+						&ParentInstructionV2{
+							SelectiveDisclosure: true,
+							Children: []Instruction{
+								&ChildInstructionV2{Name: "country", Value: "SE"},
+								&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+							},
+						},
+						&RecursiveInstructionV2{
+							Children: []Instruction{
+								&ChildInstructionV2{Name: "country", Value: "DK", SelectiveDisclosure: true},
+								&ChildInstructionV2{Name: "street", Value: "Gade 2", SelectiveDisclosure: true},
+							},
+						},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Name: "matrix",
+					Children: []Instruction{
+						&ChildArrayInstructionV2{
+							Children: []Instruction{
+								&ChildInstructionV2{Value: "a", SelectiveDisclosure: true},
+								&ChildInstructionV2{Value: "b", SelectiveDisclosure: true},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tts {
@@ -49,3 +226,159 @@ func TestConvertJSON2SDJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestConvertJSON2SDJWTErrors(t *testing.T) {
+	type have struct {
+		claims map[string]any
+		rules  map[string]any
+	}
+	tts := []struct {
+		name string
+		have have
+		want error
+	}{
+		{
+			name: "rule for absent claim",
+			have: have{
+				claims: map[string]any{"a": "b"},
+				rules:  map[string]any{"c": RuleSelectiveDisclosure},
+			},
+			want: ErrRuleClaimNotFound,
+		},
+		{
+			name: "rule for absent nested claim",
+			have: have{
+				claims: map[string]any{"a": map[string]any{"b": "c"}},
+				rules:  map[string]any{"a": map[string]any{"d": RuleSelectiveDisclosure}},
+			},
+			want: ErrRuleClaimNotFound,
+		},
+		{
+			name: "rule for absent array element",
+			have: have{
+				claims: map[string]any{"a": []any{"b"}},
+				rules:  map[string]any{"a": []any{RuleNone, RuleSelectiveDisclosure}},
+			},
+			want: ErrRuleClaimNotFound,
+		},
+		{
+			name: "unknown rule",
+			have: have{
+				claims: map[string]any{"a": "b"},
+				rules:  map[string]any{"a": "sdjwt::rule::unknown"},
+			},
+			want: ErrRuleNotKnown,
+		},
+		{
+			name: "object rule on a string claim",
+			have: have{
+				claims: map[string]any{"a": "b"},
+				rules:  map[string]any{"a": map[string]any{}},
+			},
+			want: ErrRuleTypeMismatch,
+		},
+		{
+			name: "recursive rule on a string claim",
+			have: have{
+				claims: map[string]any{"a": "b"},
+				rules:  map[string]any{"a": RuleRecursiveSelectiveDisclosure},
+			},
+			want: ErrRuleTypeMismatch,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConvertJSON2SDJWT(tt.have.claims, tt.have.rules)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestConvertJSON2SDJWTRuleV1(t *testing.T) {
+	b, err := os.ReadFile("rule_v1.json")
+	assert.NoError(t, err)
+
+	rules := map[string]any{}
+	assert.NoError(t, json.Unmarshal(b, &rules))
+
+	document := map[string]any{
+		"personalDetails": map[string]any{
+			"surnameAtBirth": "Andersson",
+			"address": map[string]any{
+				"street": "Storgatan 1",
+				"city":   "Stockholm",
+			},
+		},
+	}
+
+	want := InstructionsV2{
+		&ParentInstructionV2{
+			Name: "personalDetails",
+			Children: []Instruction{
+				&ParentInstructionV2{
+					Name:                "address",
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildInstructionV2{
+							Name:                "city",
+							Value:               "Stockholm",
+							SelectiveDisclosure: true,
+						},
+						&ChildInstructionV2{
+							Name:  "street",
+							Value: "Storgatan 1",
+						},
+					},
+				},
+				&ChildInstructionV2{
+					Name:                "surnameAtBirth",
+					Value:               "Andersson",
+					SelectiveDisclosure: true,
+				},
+			},
+		},
+	}
+
+	got, err := ConvertJSON2SDJWT(document, rules)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestConvertJSON2SDJWTRoundTrip(t *testing.T) {
+	document := map[string]any{
+		"iss": "https://example.com",
+		"address": map[string]any{
+			"street": "Storgatan 1",
+			"city":   "Stockholm",
+		},
+		"place_of_birth": map[string]any{
+			"locality": "Uppsala",
+			"country":  map[string]any{"code": "SE", "name": "Sweden"},
+		},
+		"nationalities": []any{"FI", "NO"},
+		"phones":        []any{},
+		"emails":        []any{},
+	}
+	rules := map[string]any{
+		"address": map[string]any{
+			RuleParent: RuleSelectiveDisclosure,
+			"street":   RuleSelectiveDisclosure,
+		},
+		"place_of_birth": RuleRecursiveSelectiveDisclosure,
+		"nationalities":  RuleSelectiveDisclosure,
+		"emails":         RuleSelectiveDisclosure,
+	}
+
+	instructions, err := ConvertJSON2SDJWT(document, rules)
+	assert.NoError(t, err)
+
+	sdjwt, err := instructions.SDJWT(jwt.SigningMethodHS256, "test-key")
+	assert.NoError(t, err)
+
+	claims, _, err := Verify(sdjwt.String(), "test-key")
+	assert.NoError(t, err)
+	for name, want := range document {
+		assert.Equal(t, want, claims[name], name)
+	}
+}
@@ -0,0 +1,527 @@
+package gosdjwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrDCQLNotValid is returned when a DCQL query is not valid
+	ErrDCQLNotValid = errors.New("DCQL query is not valid")
+
+	// ErrDCQLNotSatisfied is returned when credentials or presentations do not satisfy a DCQL query
+	ErrDCQLNotSatisfied = errors.New("DCQL query is not satisfied")
+)
+
+// DCQLQuery is a Digital Credentials Query Language query of OpenID4VP
+type DCQLQuery struct {
+	Credentials []DCQLCredentialQuery `json:"credentials"`
+
+	// CredentialSets are alternative combinations of credentials, all credentials are required if empty
+	CredentialSets []DCQLCredentialSetQuery `json:"credential_sets,omitempty"`
+}
+
+// DCQLCredentialQuery requests one credential, or several with Multiple
+type DCQLCredentialQuery struct {
+	ID string `json:"id"`
+
+	// Format is the format of the credential, it is matched by SD-JWTs with it as typ, e.g. TypeSDJWTVC
+	Format   string             `json:"format"`
+	Multiple bool               `json:"multiple,omitempty"`
+	Meta     DCQLCredentialMeta `json:"meta"`
+
+	// RequireCryptographicHolderBinding is true if nil, then only credentials bound to a holder key by cnf.jwk
+	// match and a presentation has to prove the binding with a KB-JWT
+	RequireCryptographicHolderBinding *bool `json:"require_cryptographic_holder_binding,omitempty"`
+
+	// Claims are the requested claims, no selectively disclosable claims are requested if empty
+	Claims []DCQLClaimsQuery `json:"claims,omitempty"`
+
+	// ClaimSets are alternative combinations of claim IDs in order of preference, all claims are required if empty
+	ClaimSets [][]string `json:"claim_sets,omitempty"`
+}
+
+// DCQLCredentialMeta is the meta of a credential query of format TypeSDJWTVC
+type DCQLCredentialMeta struct {
+	// VCTValues are the accepted vct values, any vct is accepted if empty
+	VCTValues []string `json:"vct_values,omitempty"`
+}
+
+// DCQLClaimsQuery requests a claim
+type DCQLClaimsQuery struct {
+	// ID identifies the claim in claim sets
+	ID string `json:"id,omitempty"`
+
+	// Path selects claims like ClaimFilter.Path
+	Path []any `json:"path"`
+
+	// Values are the accepted values of the claim, any value is accepted if empty
+	Values []any `json:"values,omitempty"`
+}
+
+// DCQLCredentialSetQuery is a set of alternative options of credential query IDs
+type DCQLCredentialSetQuery struct {
+	Options [][]string `json:"options"`
+
+	// Required is true if nil
+	Required *bool `json:"required,omitempty"`
+}
+
+func (s DCQLCredentialSetQuery) required() bool {
+	return s.Required == nil || *s.Required
+}
+
+func (c *DCQLCredentialQuery) requireHolderBinding() bool {
+	return c.RequireCryptographicHolderBinding == nil || *c.RequireCryptographicHolderBinding
+}
+
+// ParseDCQLQuery parses and validates a JSON DCQL query
+func ParseDCQLQuery(b []byte) (*DCQLQuery, error) {
+	query := &DCQLQuery{}
+	if err := json.Unmarshal(b, query); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDCQLNotValid, err)
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// Validate returns an error if IDs are missing or not unique, paths are not valid, or sets refer to unknown IDs
+func (q *DCQLQuery) Validate() error {
+	if len(q.Credentials) == 0 {
+		return fmt.Errorf("%w: credentials is empty", ErrDCQLNotValid)
+	}
+
+	ids := map[string]bool{}
+	for i, credential := range q.Credentials {
+		path := fmt.Sprintf("credentials[%d]", i)
+		if !credentialIDPattern.MatchString(credential.ID) {
+			return fmt.Errorf("%w: %s.id %q", ErrDCQLNotValid, path, credential.ID)
+		}
+		if ids[credential.ID] {
+			return fmt.Errorf("%w: %s.id %q is not unique", ErrDCQLNotValid, path, credential.ID)
+		}
+		ids[credential.ID] = true
+		if credential.Format == "" {
+			return fmt.Errorf("%w: %s.format is missing", ErrDCQLNotValid, path)
+		}
+		if err := credential.validateClaims(path); err != nil {
+			return err
+		}
+	}
+
+	for i, set := range q.CredentialSets {
+		path := fmt.Sprintf("credential_sets[%d]", i)
+		if len(set.Options) == 0 {
+			return fmt.Errorf("%w: %s.options is empty", ErrDCQLNotValid, path)
+		}
+		for j, option := range set.Options {
+			if err := validateDCQLSet(option, ids, fmt.Sprintf("%s.options[%d]", path, j)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *DCQLCredentialQuery) validateClaims(path string) error {
+	ids := map[string]bool{}
+	for i, claim := range c.Claims {
+		claimPath := fmt.Sprintf("%s.claims[%d]", path, i)
+		if claim.ID != "" || len(c.ClaimSets) > 0 {
+			if !credentialIDPattern.MatchString(claim.ID) {
+				return fmt.Errorf("%w: %s.id %q", ErrDCQLNotValid, claimPath, claim.ID)
+			}
+			if ids[claim.ID] {
+				return fmt.Errorf("%w: %s.id %q is not unique", ErrDCQLNotValid, claimPath, claim.ID)
+			}
+			ids[claim.ID] = true
+		}
+		if len(claim.Path) == 0 {
+			return fmt.Errorf("%w: %s.path is empty", ErrDCQLNotValid, claimPath)
+		}
+		for j, selector := range claim.Path {
+			if !validDCQLSelector(selector) {
+				return fmt.Errorf("%w: %s.path[%d] %v", ErrDCQLNotValid, claimPath, j, selector)
+			}
+		}
+	}
+
+	if len(c.ClaimSets) > 0 && len(c.Claims) == 0 {
+		return fmt.Errorf("%w: %s.claim_sets without claims", ErrDCQLNotValid, path)
+	}
+	for i, set := range c.ClaimSets {
+		if err := validateDCQLSet(set, ids, fmt.Sprintf("%s.claim_sets[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validDCQLSelector returns true for a string, null, or a non-negative integer
+func validDCQLSelector(selector any) bool {
+	switch s := selector.(type) {
+	case string, nil:
+		return true
+	default:
+		i, ok := schemaNumber(s)
+		return ok && i >= 0 && i == float64(int(i))
+	}
+}
+
+func validateDCQLSet(set []string, ids map[string]bool, path string) error {
+	if len(set) == 0 {
+		return fmt.Errorf("%w: %s is empty", ErrDCQLNotValid, path)
+	}
+	for _, id := range set {
+		if !ids[id] {
+			return fmt.Errorf("%w: %s refers to unknown id %q", ErrDCQLNotValid, path, id)
+		}
+	}
+	return nil
+}
+
+// credential returns the credential query with id, or nil
+func (q *DCQLQuery) credential(id string) *DCQLCredentialQuery {
+	for i := range q.Credentials {
+		if q.Credentials[i].ID == id {
+			return &q.Credentials[i]
+		}
+	}
+	return nil
+}
+
+// match returns the claims the credential query selects in claims, of the first claim set that claims
+// satisfy, and false if claims do not satisfy the query. typ is the typ header of the credential and bound is
+// true if it is bound to a holder key.
+func (c *DCQLCredentialQuery) match(typ string, bound bool, claims map[string]any) ([]selectedClaim, bool) {
+	if c.Format != typ {
+		return nil, false
+	}
+	if c.requireHolderBinding() && !bound {
+		return nil, false
+	}
+	vct, _ := claims["vct"].(string)
+	if len(c.Meta.VCTValues) > 0 && !slices.Contains(c.Meta.VCTValues, vct) {
+		return nil, false
+	}
+
+	selected := map[string][]selectedClaim{}
+	for i, claim := range c.Claims {
+		if s := claim.selectClaims(claims); len(s) > 0 {
+			selected[c.claimKey(i)] = s
+		}
+	}
+
+	sets := c.ClaimSets
+	if len(sets) == 0 {
+		all := []string{}
+		for i := range c.Claims {
+			all = append(all, c.claimKey(i))
+		}
+		sets = [][]string{all}
+	}
+
+	for _, set := range sets {
+		claimSet := []selectedClaim{}
+		for _, key := range set {
+			s, ok := selected[key]
+			if !ok {
+				claimSet = nil
+				break
+			}
+			claimSet = append(claimSet, s...)
+		}
+		if claimSet != nil {
+			return claimSet, true
+		}
+	}
+	return nil, false
+}
+
+// claimKey identifies the claim query at i, by its ID or its index if it has none
+func (c *DCQLCredentialQuery) claimKey(i int) string {
+	if c.Claims[i].ID != "" {
+		return c.Claims[i].ID
+	}
+	return fmt.Sprintf("[%d]", i)
+}
+
+// selectClaims returns the claims path selects in claims that have one of the values
+func (c DCQLClaimsQuery) selectClaims(claims map[string]any) []selectedClaim {
+	selected := selectClaimPaths(claims, c.Path)
+	if len(c.Values) == 0 {
+		return selected
+	}
+
+	matches := []selectedClaim{}
+	for _, claim := range selected {
+		for _, want := range c.Values {
+			if schemaEqual(want, claim.value) {
+				matches = append(matches, claim)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// selectCredentials returns the IDs of the credential queries to present, the first option of each credential
+// set where matched is true for every ID, or all IDs without credential sets
+func (q *DCQLQuery) selectCredentials(matched func(id string) bool) ([]string, error) {
+	if len(q.CredentialSets) == 0 {
+		ids := []string{}
+		for _, credential := range q.Credentials {
+			if !matched(credential.ID) {
+				return nil, fmt.Errorf("%w: credential %s", ErrDCQLNotSatisfied, credential.ID)
+			}
+			ids = append(ids, credential.ID)
+		}
+		return ids, nil
+	}
+
+	ids := []string{}
+	for i, set := range q.CredentialSets {
+		option := slices.IndexFunc(set.Options, func(option []string) bool {
+			for _, id := range option {
+				if !matched(id) {
+					return false
+				}
+			}
+			return true
+		})
+		if option < 0 {
+			if set.required() {
+				return nil, fmt.Errorf("%w: credential_sets[%d]", ErrDCQLNotSatisfied, i)
+			}
+			continue
+		}
+		for _, id := range set.Options[option] {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// DCQLMatch is a credential that satisfies a credential query
+type DCQLMatch struct {
+	Credential *StoredCredential
+
+	// Disclosures are the fewest disclosures that reveal the requested claims, sorted
+	Disclosures []string
+}
+
+// Presentation returns the SD-JWT with only the disclosures of the match, ending with ~, see HolderKey.Present
+func (m *DCQLMatch) Presentation() string {
+	return presentDisclosures(m.Credential.SDJWT, m.Disclosures)
+}
+
+// presentDisclosures returns the JWT of the SD-JWT with only the given disclosures, each followed by ~
+func presentDisclosures(sdjwt *SDJWT, disclosures []string) string {
+	presentation := sdjwt.JWT + "~"
+	for _, disclosure := range disclosures {
+		presentation += disclosure + "~"
+	}
+	return presentation
+}
+
+// DCQLResult is the result of evaluating a DCQL query against the credentials of a wallet
+type DCQLResult struct {
+	// Matches are the credentials that satisfy each credential query, by its ID. One of them is presented
+	// unless the credential query allows Multiple.
+	Matches map[string][]*DCQLMatch
+
+	// Selected are the IDs of the credential queries to present, one option of each credential set
+	Selected []string
+}
+
+// Evaluate finds the credentials that satisfy the query with the disclosures to present for each.
+// It returns ErrDCQLNotSatisfied if the credentials can not satisfy it.
+func (q *DCQLQuery) Evaluate(credentials []*StoredCredential) (*DCQLResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := &DCQLResult{Matches: map[string][]*DCQLMatch{}}
+	for _, credential := range credentials {
+		if credential.SDJWT == nil {
+			return nil, fmt.Errorf("%w: %s has no SD-JWT", ErrSDJWTNotValid, credential.ID)
+		}
+		claims, r, err := sdjwtReconstruction(credential.SDJWT)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", credential.ID, err)
+		}
+		typ := sdjwtType(credential.SDJWT)
+		_, bound := holderJWK(claims)
+		for i := range q.Credentials {
+			query := &q.Credentials[i]
+			selected, ok := query.match(typ, bound, claims)
+			if !ok {
+				continue
+			}
+			result.Matches[query.ID] = append(result.Matches[query.ID], &DCQLMatch{
+				Credential:  credential,
+				Disclosures: r.disclosuresOf(selected),
+			})
+		}
+	}
+
+	var err error
+	result.Selected, err = q.selectCredentials(func(id string) bool {
+		return len(result.Matches[id]) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sdjwtType returns the typ header of a SD-JWT, the signature is not verified
+func sdjwtType(sdjwt *SDJWT) string {
+	token, _, err := jwt.NewParser().ParseUnverified(sdjwt.JWT, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+	typ, _ := token.Header["typ"].(string)
+	return typ
+}
+
+// holderJWK returns the holder key in cnf.jwk of claims, false if the credential is not bound to one
+func holderJWK(claims map[string]any) (map[string]any, bool) {
+	cnf, _ := objectValue(claims["cnf"])
+	return objectValue(cnf["jwk"])
+}
+
+// sdjwtReconstruction reconstructs the claims of a SD-JWT with all its disclosures, the signature is not verified
+func sdjwtReconstruction(sdjwt *SDJWT) (map[string]any, *reconstruction, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(sdjwt.JWT, claims); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSDJWTNotValid, err)
+	}
+	reconstructed, r, err := reconstructClaims(claims, sdjwt.Disclosures.ArrayHashes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return map[string]any(reconstructed), r, nil
+}
+
+// disclosuresOf returns the disclosures needed to reveal the selected claims: those of the claims and their
+// parents, and all disclosures within them
+func (r *reconstruction) disclosuresOf(selected []selectedClaim) []string {
+	disclosures := []string{}
+	for _, disclosed := range r.disclosed {
+		for _, claim := range selected {
+			if pathContains(disclosed.path, claim.path) || pathContains(claim.path, disclosed.path) {
+				disclosures = append(disclosures, disclosed.disclosure.disclosureHash)
+				break
+			}
+		}
+	}
+	sort.Strings(disclosures)
+	return disclosures
+}
+
+// pathContains returns true if the claim at path is, or contains, the claim at claimPath
+func pathContains(path, claimPath string) bool {
+	return path == claimPath || strings.HasPrefix(claimPath, path+".") || strings.HasPrefix(claimPath, path+"[")
+}
+
+// Check returns ErrDCQLNotSatisfied unless the verified presentations, by credential query ID, satisfy the query.
+// A presentation is bound to the holder if it has a verified KeyBinding.
+func (q *DCQLQuery) Check(presented map[string][]*VerifiedPresentation) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+
+	for id, credentials := range presented {
+		query := q.credential(id)
+		if query == nil {
+			return fmt.Errorf("%w: %s is not requested", ErrDCQLNotSatisfied, id)
+		}
+		if len(credentials) > 1 && !query.Multiple {
+			return fmt.Errorf("%w: %s has %d credentials", ErrDCQLNotSatisfied, id, len(credentials))
+		}
+		for i, p := range credentials {
+			typ := ""
+			if p.Validation != nil {
+				typ, _ = p.Validation.Header["typ"].(string)
+			}
+			if _, ok := query.match(typ, p.KeyBinding != nil, p.Claims); !ok {
+				return fmt.Errorf("%w: %s[%d]", ErrDCQLNotSatisfied, id, i)
+			}
+		}
+	}
+
+	_, err := q.selectCredentials(func(id string) bool {
+		return len(presented[id]) > 0
+	})
+	return err
+}
+
+// VerifiedPresentation is a verified presentation of a credential
+type VerifiedPresentation struct {
+	Claims     jwt.MapClaims
+	Validation *Validation
+
+	// KeyBinding has the claims of the KB-JWT, when the credential is bound to a holder key by cnf
+	KeyBinding jwt.MapClaims
+}
+
+// verifyPresentation verifies a presentation to the verifier aud with its nonce. A credential bound to a holder
+// key by cnf has to be presented with a KB-JWT signed by that key, and a KB-JWT of a credential without one is
+// rejected as it can not be verified. The reconstruction of the claims is returned with the presentation.
+func (v *Verifier) verifyPresentation(ctx context.Context, presentation, aud, nonce string) (*VerifiedPresentation, *reconstruction, error) {
+	claims, r, validation, err := v.verifyReconstruction(ctx, presentation)
+	if err != nil {
+		return nil, nil, err
+	}
+	verified := &VerifiedPresentation{Claims: claims, Validation: validation}
+
+	jwk, bound := holderJWK(claims)
+	_, hasCNF := claims["cnf"]
+	switch {
+	case hasCNF && !bound:
+		return nil, nil, fmt.Errorf("%w: cnf has no jwk", ErrKeyBindingNotValid)
+	case !bound && splitSDJWT(presentation).KeyBinding != "":
+		return nil, nil, fmt.Errorf("%w: the credential has no cnf to verify it with", ErrKeyBindingNotValid)
+	case !bound:
+		return verified, r, nil
+	}
+	if verified.KeyBinding, err = VerifyKeyBindingJWT(presentation, jwk, aud, nonce, v.keyBindingMaxAge()); err != nil {
+		return nil, nil, err
+	}
+	return verified, r, nil
+}
+
+// VerifyDCQL verifies the presentations of a vp_token, by credential query ID, to the verifier aud with its
+// nonce and checks that they satisfy the query.
+//
+// A revoked or suspended credential is not an error, its status is in Validation.Status of the presentation and has
+// to be checked by the caller.
+func (v *Verifier) VerifyDCQL(ctx context.Context, query *DCQLQuery, vpToken map[string][]string, aud, nonce string) (map[string][]*VerifiedPresentation, error) {
+	verified := map[string][]*VerifiedPresentation{}
+	for id, presentations := range vpToken {
+		for i, presentation := range presentations {
+			p, _, err := v.verifyPresentation(ctx, presentation, aud, nonce)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", id, i, err)
+			}
+			verified[id] = append(verified[id], p)
+		}
+	}
+
+	if err := query.Check(verified); err != nil {
+		return nil, err
+	}
+	return verified, nil
+}
@@ -0,0 +1,521 @@
+package gosdjwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockDCQLCredentials returns a pid and a diploma credential, bound to key unless it is nil
+func mockDCQLCredentials(t *testing.T, key *HolderKey) []*StoredCredential {
+	var cnf map[string]any
+	if key != nil {
+		var err error
+		cnf, err = key.Confirmation()
+		assert.NoError(t, err)
+	}
+
+	credentials := []*StoredCredential{}
+	for _, c := range []struct{ id, country string }{{"pid", "SE"}, {"diploma", "NO"}} {
+		vc := VC{VCT: "https://example.com/" + c.id, Issuer: "https://example.com/issuer", Confirmation: cnf}
+		credential, err := NewStoredCredential(mockWalletCredentialVC(t, vc, time.Time{}, c.country), "")
+		assert.NoError(t, err)
+		credential.ID = c.id
+		credentials = append(credentials, credential)
+	}
+	return credentials
+}
+
+// mockDCQLHolderKey returns a new ES256 holder key
+func mockDCQLHolderKey(t *testing.T) *HolderKey {
+	key, err := NewMemoryHolderKeyStore().Create(context.Background(), "ES256")
+	assert.NoError(t, err)
+	return key
+}
+
+func TestParseDCQLQuery(t *testing.T) {
+	tts := []struct {
+		name  string
+		query string
+		err   error
+	}{
+		{
+			name:  "test 0 - valid",
+			query: `{"credentials":[{"id":"pid","format":"dc+sd-jwt","meta":{"vct_values":["https://example.com/pid"]},"claims":[{"id":"a","path":["nationalities",null]},{"id":"b","path":["nationalities",0]}],"claim_sets":[["a"],["b"]]}],"credential_sets":[{"options":[["pid"]],"required":false}]}`,
+		},
+		{
+			name:  "test 1 - no credentials",
+			query: `{"credentials":[]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 2 - credential id not unique",
+			query: `{"credentials":[{"id":"pid","format":"dc+sd-jwt"},{"id":"pid","format":"dc+sd-jwt"}]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 3 - credential id not valid",
+			query: `{"credentials":[{"id":"p.i.d","format":"dc+sd-jwt"}]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 4 - format missing",
+			query: `{"credentials":[{"id":"pid"}]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 5 - path empty",
+			query: `{"credentials":[{"id":"pid","format":"dc+sd-jwt","claims":[{"path":[]}]}]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 6 - negative index",
+			query: `{"credentials":[{"id":"pid","format":"dc+sd-jwt","claims":[{"path":["nationalities",-1]}]}]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 7 - claim id missing with claim sets",
+			query: `{"credentials":[{"id":"pid","format":"dc+sd-jwt","claims":[{"path":["given_name"]}],"claim_sets":[["a"]]}]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 8 - claim set refers to unknown id",
+			query: `{"credentials":[{"id":"pid","format":"dc+sd-jwt","claims":[{"id":"a","path":["given_name"]}],"claim_sets":[["b"]]}]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 9 - credential set refers to unknown id",
+			query: `{"credentials":[{"id":"pid","format":"dc+sd-jwt"}],"credential_sets":[{"options":[["mdl"]]}]}`,
+			err:   ErrDCQLNotValid,
+		},
+		{
+			name:  "test 10 - not json",
+			query: `{"credentials":`,
+			err:   ErrDCQLNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDCQLQuery([]byte(tt.query))
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDCQLQueryEvaluate(t *testing.T) {
+	credentials := mockDCQLCredentials(t, mockDCQLHolderKey(t))
+	notRequired := false
+
+	tts := []struct {
+		name        string
+		query       DCQLQuery
+		credentials []*StoredCredential
+		want        map[string]any
+		err         error
+	}{
+		{
+			name: "test 0 - no claims",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}},
+			}},
+			want: map[string]any{},
+		},
+		{
+			name: "test 1 - claim",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+					{Path: []any{"given_name"}},
+				}},
+			}},
+			want: map[string]any{"given_name": "John"},
+		},
+		{
+			name: "test 2 - nested claim with its parent",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+					{Path: []any{"address", "country"}},
+				}},
+			}},
+			want: map[string]any{"address": map[string]any{"country": "SE"}},
+		},
+		{
+			name: "test 3 - object with its claims",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+					{Path: []any{"address"}},
+				}},
+			}},
+			want: map[string]any{"address": map[string]any{"country": "SE"}},
+		},
+		{
+			name: "test 4 - array element by value",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+					{Path: []any{"nationalities", nil}, Values: []any{"SE"}},
+				}},
+			}},
+			want: map[string]any{"nationalities": []any{"SE"}},
+		},
+		{
+			name: "test 5 - array element by index",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+					{Path: []any{"nationalities", 0}},
+				}},
+			}},
+			want: map[string]any{"nationalities": []any{"FI"}},
+		},
+		{
+			name: "test 6 - second claim set",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+					{ID: "family_name", Path: []any{"family_name"}},
+					{ID: "given_name", Path: []any{"given_name"}},
+					{ID: "country", Path: []any{"address", "country"}, Values: []any{"NO"}},
+				}, ClaimSets: [][]string{{"family_name"}, {"country"}, {"given_name"}}},
+			}},
+			want: map[string]any{"given_name": "John"},
+		},
+		{
+			name: "test 7 - vct not matching",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/mdl"}}},
+			}},
+			err: ErrDCQLNotSatisfied,
+		},
+		{
+			name: "test 8 - value not matching",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+					{Path: []any{"address", "country"}, Values: []any{"DK"}},
+				}},
+			}},
+			err: ErrDCQLNotSatisfied,
+		},
+		{
+			name: "test 9 - other format",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: "mso_mdoc"},
+			}},
+			err: ErrDCQLNotSatisfied,
+		},
+		{
+			name: "test 10 - credential of the legacy typ",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC},
+			}},
+			credentials: []*StoredCredential{mockDCQLCredential(t, VC{Type: TypeSDJWTVCLegacy, VCT: "https://example.com/pid", Issuer: "https://example.com/issuer", Confirmation: mockDCQLConfirmation(t)})},
+			err:         ErrDCQLNotSatisfied,
+		},
+		{
+			name: "test 11 - plain SD-JWT",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, RequireCryptographicHolderBinding: &notRequired},
+			}},
+			credentials: []*StoredCredential{mockDCQLPlainCredential(t)},
+			err:         ErrDCQLNotSatisfied,
+		},
+		{
+			name: "test 12 - holder binding required",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC},
+			}},
+			credentials: mockDCQLCredentials(t, nil),
+			err:         ErrDCQLNotSatisfied,
+		},
+		{
+			name: "test 13 - holder binding not required",
+			query: DCQLQuery{Credentials: []DCQLCredentialQuery{
+				{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, RequireCryptographicHolderBinding: &notRequired},
+			}},
+			credentials: mockDCQLCredentials(t, nil),
+			want:        map[string]any{},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.credentials == nil {
+				tt.credentials = credentials
+			}
+			result, err := tt.query.Evaluate(tt.credentials)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"pid"}, result.Selected)
+			assert.Len(t, result.Matches["pid"], 1)
+
+			match := result.Matches["pid"][0]
+			assert.Equal(t, "pid", match.Credential.ID)
+
+			claims, err := ParseSDJWT(match.Presentation())
+			assert.NoError(t, err)
+			assert.Len(t, claims.Disclosures, len(match.Disclosures))
+
+			got, _, err := Verify(match.Presentation(), "mura")
+			assert.NoError(t, err)
+			for _, name := range []string{"given_name", "address", "nationalities"} {
+				if want, ok := tt.want[name]; ok {
+					assert.Equal(t, want, got[name], name)
+					continue
+				}
+				if name == "nationalities" {
+					assert.Empty(t, got[name])
+					continue
+				}
+				assert.NotContains(t, got, name)
+			}
+		})
+	}
+}
+
+// mockDCQLCredential returns a credential of vc with a given_name
+func mockDCQLCredential(t *testing.T, vc VC) *StoredCredential {
+	instructions := InstructionsV2{&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true}}
+	sdjwt, err := instructions.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+	credential, err := NewStoredCredential(sdjwt.String(), "")
+	assert.NoError(t, err)
+	credential.ID = "pid"
+	return credential
+}
+
+// mockDCQLPlainCredential returns a SD-JWT that is not a SD-JWT VC, without typ and vct
+func mockDCQLPlainCredential(t *testing.T) *StoredCredential {
+	instructions := InstructionsV2{&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true}}
+	sdjwt, err := instructions.SDJWT(jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+	credential, err := NewStoredCredential(sdjwt.String(), "")
+	assert.NoError(t, err)
+	credential.ID = "pid"
+	return credential
+}
+
+// mockDCQLConfirmation returns the cnf of a new holder key
+func mockDCQLConfirmation(t *testing.T) map[string]any {
+	cnf, err := mockDCQLHolderKey(t).Confirmation()
+	assert.NoError(t, err)
+	return cnf
+}
+
+func TestDCQLQueryCredentialSets(t *testing.T) {
+	credentials := mockDCQLCredentials(t, mockDCQLHolderKey(t))
+	optional := false
+
+	query := DCQLQuery{
+		Credentials: []DCQLCredentialQuery{
+			{ID: "mdl", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/mdl"}}},
+			{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}},
+			{ID: "diploma", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/diploma"}}},
+			{ID: "any", Format: TypeSDJWTVC, Multiple: true},
+		},
+		CredentialSets: []DCQLCredentialSetQuery{
+			{Options: [][]string{{"mdl"}, {"pid"}}},
+			{Options: [][]string{{"mdl", "diploma"}}, Required: &optional},
+			{Options: [][]string{{"diploma"}}, Required: &optional},
+		},
+	}
+
+	result, err := query.Evaluate(credentials)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pid", "diploma"}, result.Selected)
+	assert.Len(t, result.Matches["any"], 2)
+	assert.Empty(t, result.Matches["mdl"])
+
+	query.CredentialSets[1].Required = nil
+	_, err = query.Evaluate(credentials)
+	assert.ErrorIs(t, err, ErrDCQLNotSatisfied)
+
+	_, err = query.Evaluate(nil)
+	assert.ErrorIs(t, err, ErrDCQLNotSatisfied)
+}
+
+func TestDCQLQueryCheck(t *testing.T) {
+	query := DCQLQuery{Credentials: []DCQLCredentialQuery{
+		{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+			{Path: []any{"address", "country"}, Values: []any{"SE", "NO"}},
+		}},
+	}}
+	presentation := func(typ string, keyBinding jwt.MapClaims, claims jwt.MapClaims) *VerifiedPresentation {
+		return &VerifiedPresentation{
+			Claims:     claims,
+			Validation: &Validation{Header: map[string]any{"typ": typ}},
+			KeyBinding: keyBinding,
+		}
+	}
+	kb := jwt.MapClaims{"nonce": "nonce"}
+	pid := presentation(TypeSDJWTVC, kb, jwt.MapClaims{"vct": "https://example.com/pid", "address": map[string]any{"country": "SE"}})
+
+	tts := []struct {
+		name      string
+		presented map[string][]*VerifiedPresentation
+		err       error
+	}{
+		{
+			name:      "test 0 - satisfied",
+			presented: map[string][]*VerifiedPresentation{"pid": {pid}},
+		},
+		{
+			name:      "test 1 - claim not disclosed",
+			presented: map[string][]*VerifiedPresentation{"pid": {presentation(TypeSDJWTVC, kb, jwt.MapClaims{"vct": "https://example.com/pid"})}},
+			err:       ErrDCQLNotSatisfied,
+		},
+		{
+			name:      "test 2 - credential missing",
+			presented: map[string][]*VerifiedPresentation{},
+			err:       ErrDCQLNotSatisfied,
+		},
+		{
+			name:      "test 3 - not requested",
+			presented: map[string][]*VerifiedPresentation{"pid": {pid}, "mdl": {pid}},
+			err:       ErrDCQLNotSatisfied,
+		},
+		{
+			name:      "test 4 - multiple not allowed",
+			presented: map[string][]*VerifiedPresentation{"pid": {pid, pid}},
+			err:       ErrDCQLNotSatisfied,
+		},
+		{
+			name:      "test 5 - other typ",
+			presented: map[string][]*VerifiedPresentation{"pid": {presentation(TypeSDJWTVCLegacy, kb, pid.Claims)}},
+			err:       ErrDCQLNotSatisfied,
+		},
+		{
+			name:      "test 6 - not bound to the holder",
+			presented: map[string][]*VerifiedPresentation{"pid": {presentation(TypeSDJWTVC, nil, pid.Claims)}},
+			err:       ErrDCQLNotSatisfied,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			err := query.Check(tt.presented)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifierVerifyDCQL(t *testing.T) {
+	ctx := context.Background()
+	key := mockDCQLHolderKey(t)
+	credentials := mockDCQLCredentials(t, key)
+	verifier := &Verifier{Key: "mura"}
+	aud := "https://verifier.example.com"
+
+	query := &DCQLQuery{Credentials: []DCQLCredentialQuery{
+		{ID: "pid", Format: TypeSDJWTVC, Meta: DCQLCredentialMeta{VCTValues: []string{"https://example.com/pid"}}, Claims: []DCQLClaimsQuery{
+			{Path: []any{"address", "country"}},
+		}},
+	}}
+
+	result, err := query.Evaluate(credentials)
+	assert.NoError(t, err)
+	presentation, err := key.Present(result.Matches["pid"][0].Presentation(), aud, "nonce")
+	assert.NoError(t, err)
+
+	verified, err := verifier.VerifyDCQL(ctx, query, map[string][]string{"pid": {presentation}}, aud, "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"country": "SE"}, verified["pid"][0].Claims["address"])
+	assert.True(t, verified["pid"][0].Validation.Verify)
+
+	t.Run("claim not presented", func(t *testing.T) {
+		presentation, err := key.Present(credentials[0].SDJWT.JWT+"~", aud, "nonce")
+		assert.NoError(t, err)
+		_, err = verifier.VerifyDCQL(ctx, query, map[string][]string{"pid": {presentation}}, aud, "nonce")
+		assert.ErrorIs(t, err, ErrDCQLNotSatisfied)
+	})
+
+	t.Run("signature not valid", func(t *testing.T) {
+		_, err := (&Verifier{Key: "other"}).VerifyDCQL(ctx, query, map[string][]string{"pid": {presentation}}, aud, "nonce")
+		assert.Error(t, err)
+	})
+
+	unbound := mockDCQLCredentials(t, nil)[0].SDJWT.String()
+
+	t.Run("credential not bound to a holder key", func(t *testing.T) {
+		_, err := verifier.VerifyDCQL(ctx, query, map[string][]string{"pid": {unbound}}, aud, "nonce")
+		assert.ErrorIs(t, err, ErrDCQLNotSatisfied)
+	})
+
+	t.Run("holder binding not required", func(t *testing.T) {
+		notRequired := false
+		query := &DCQLQuery{Credentials: []DCQLCredentialQuery{
+			{ID: "pid", Format: TypeSDJWTVC, RequireCryptographicHolderBinding: &notRequired},
+		}}
+		verified, err := verifier.VerifyDCQL(ctx, query, map[string][]string{"pid": {unbound}}, aud, "nonce")
+		assert.NoError(t, err)
+		assert.Nil(t, verified["pid"][0].KeyBinding)
+
+		t.Run("KB-JWT of a credential without cnf", func(t *testing.T) {
+			withKB, err := key.Present(unbound, aud, "nonce")
+			assert.NoError(t, err)
+			_, err = verifier.VerifyDCQL(ctx, query, map[string][]string{"pid": {withKB}}, aud, "nonce")
+			assert.ErrorIs(t, err, ErrKeyBindingNotValid)
+		})
+
+		t.Run("plain SD-JWT", func(t *testing.T) {
+			_, err := verifier.VerifyDCQL(ctx, query, map[string][]string{"pid": {mockDCQLPlainCredential(t).SDJWT.String()}}, aud, "nonce")
+			assert.ErrorIs(t, err, ErrDCQLNotSatisfied)
+		})
+	})
+}
+
+func TestVerifierVerifyDCQLKeyBinding(t *testing.T) {
+	ctx := context.Background()
+	verifier := &Verifier{Key: "mura"}
+	aud := "https://verifier.example.com"
+
+	key, err := NewMemoryHolderKeyStore().Create(ctx, "ES256")
+	assert.NoError(t, err)
+	cnf, err := key.Confirmation()
+	assert.NoError(t, err)
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+	}
+	sdjwt, err := instructions.SDJWTVC(VC{VCT: "https://example.com/pid", Issuer: "https://example.com/issuer", Confirmation: cnf}, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	query := &DCQLQuery{Credentials: []DCQLCredentialQuery{
+		{ID: "pid", Format: TypeSDJWTVC, Claims: []DCQLClaimsQuery{{Path: []any{"given_name"}}}},
+	}}
+	presentation, err := key.Present(sdjwt.String(), aud, "nonce")
+	assert.NoError(t, err)
+
+	verified, err := verifier.VerifyDCQL(ctx, query, map[string][]string{"pid": {presentation}}, aud, "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, "John", verified["pid"][0].Claims["given_name"])
+	assert.Equal(t, "nonce", verified["pid"][0].KeyBinding["nonce"])
+
+	tts := []struct {
+		name         string
+		presentation string
+		aud          string
+		nonce        string
+	}{
+		{name: "test 0 - no KB-JWT", presentation: sdjwt.String(), aud: aud, nonce: "nonce"},
+		{name: "test 1 - other audience", presentation: presentation, aud: "https://other.example.com", nonce: "nonce"},
+		{name: "test 2 - other nonce", presentation: presentation, aud: aud, nonce: "other"},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.VerifyDCQL(ctx, query, map[string][]string{"pid": {tt.presentation}}, tt.aud, tt.nonce)
+			assert.ErrorIs(t, err, ErrKeyBindingNotValid)
+		})
+	}
+}
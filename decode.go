@@ -0,0 +1,130 @@
+package gosdjwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Decoded is verified claims decoded into a Go type
+type Decoded[T any] struct {
+	Claims T
+
+	// Undisclosed are the paths of fields that are missing, but might be in the credential since the
+	// object they belong to has digests without a disclosure
+	Undisclosed []string
+
+	// Absent are the paths of fields that are not in the credential
+	Absent []string
+}
+
+// VerifyInto verifies the SDJWT with key, a string is used as a HMAC secret, and decodes the disclosed claims into T
+func VerifyInto[T any](sdjwt string, key any) (*Decoded[T], *Validation, error) {
+	claims, r, validation, err := verify(sdjwt, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoded, err := decodeClaims[T](claims, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return decoded, validation, nil
+}
+
+// VerifierVerifyInto verifies the SDJWT with the verifier, as Verifier.Verify does, and decodes the disclosed
+// claims into T
+func VerifierVerifyInto[T any](ctx context.Context, v *Verifier, sdjwt string) (*Decoded[T], *Validation, error) {
+	claims, r, validation, err := v.verifyReconstruction(ctx, sdjwt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoded, err := decodeClaims[T](claims, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return decoded, validation, nil
+}
+
+func decodeClaims[T any](claims jwt.MapClaims, r *reconstruction) (*Decoded[T], error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := &Decoded[T]{}
+	if err := json.Unmarshal(b, &decoded.Claims); err != nil {
+		return nil, err
+	}
+
+	decoded.missingFields(reflect.TypeOf(decoded.Claims), claims, "", r.undisclosed)
+
+	return decoded, nil
+}
+
+// missingFields walks the fields of t and reports those that are not present in claims
+func (d *Decoded[T]) missingFields(t reflect.Type, claims map[string]any, path string, undisclosed map[string]int) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name, _, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			d.missingFields(field.Type, claims, path, undisclosed)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		claimPath := joinPath(path, name)
+		claim, ok := claims[name]
+		if !ok {
+			if undisclosed[path] > 0 {
+				d.Undisclosed = append(d.Undisclosed, claimPath)
+			} else {
+				d.Absent = append(d.Absent, claimPath)
+			}
+			continue
+		}
+
+		switch nested := claim.(type) {
+		case map[string]any:
+			d.missingFields(field.Type, nested, claimPath, undisclosed)
+		case []any:
+			d.missingElementFields(field.Type, nested, claimPath, undisclosed)
+		}
+	}
+}
+
+// missingElementFields reports missing fields of the object elements of a slice
+func (d *Decoded[T]) missingElementFields(t reflect.Type, elements []any, path string, undisclosed map[string]int) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return
+	}
+	for i, element := range elements {
+		if nested, ok := element.(map[string]any); ok {
+			d.missingFields(t.Elem(), nested, fmt.Sprintf("%s[%d]", path, i), undisclosed)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package gosdjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDecodedAddress struct {
+	Street  string `json:"street"`
+	Country string `json:"country"`
+}
+
+type mockDecodedCredential struct {
+	Sub        string              `json:"sub"`
+	GivenName  string              `json:"given_name"`
+	FamilyName string              `json:"family_name"`
+	Email      string              `json:"email"`
+	Address    *mockDecodedAddress `json:"address"`
+}
+
+// mockPresentation issues instructions and returns a presentation with the disclosures of the named claims
+func mockPresentation(t *testing.T, instructions InstructionsV2, key string, disclose ...string) string {
+	sdjwt, err := instructions.SDJWT(jwt.SigningMethodHS256, key)
+	assert.NoError(t, err)
+
+	presentation := sdjwt.JWT + "~"
+	for _, disclosure := range sdjwt.Disclosures {
+		for _, name := range disclose {
+			if disclosure.name == name {
+				presentation += disclosure.disclosureHash + "~"
+			}
+		}
+	}
+	return presentation
+}
+
+func TestVerifyInto(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "sub", Value: "test-2"},
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ChildInstructionV2{Name: "family_name", Value: "Doe", SelectiveDisclosure: true},
+		&ParentInstructionV2{
+			Name: "address",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "country", Value: "sweden"},
+			},
+		},
+	}
+
+	tts := []struct {
+		name     string
+		disclose []string
+		want     *Decoded[mockDecodedCredential]
+	}{
+		{
+			name:     "test 0 - one disclosed claim",
+			disclose: []string{"given_name"},
+			want: &Decoded[mockDecodedCredential]{
+				Claims: mockDecodedCredential{
+					Sub:       "test-2",
+					GivenName: "John",
+					Address: &mockDecodedAddress{
+						Country: "sweden",
+					},
+				},
+				Undisclosed: []string{"family_name", "email"},
+				Absent:      []string{"address.street"},
+			},
+		},
+		{
+			name:     "test 1 - all claims disclosed",
+			disclose: []string{"given_name", "family_name"},
+			want: &Decoded[mockDecodedCredential]{
+				Claims: mockDecodedCredential{
+					Sub:        "test-2",
+					GivenName:  "John",
+					FamilyName: "Doe",
+					Address: &mockDecodedAddress{
+						Country: "sweden",
+					},
+				},
+				Absent: []string{"email", "address.street"},
+			},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			presentation := mockPresentation(t, instructions, "mura", tt.disclose...)
+
+			got, validation, err := VerifyInto[mockDecodedCredential](presentation, "mura")
+			assert.NoError(t, err)
+			assert.True(t, validation.Verify)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVerifyIntoArrayElements(t *testing.T) {
+	type credential struct {
+		Addresses []mockDecodedAddress `json:"addresses"`
+	}
+
+	instructions := InstructionsV2{
+		&ChildArrayInstructionV2{
+			Name: "addresses",
+			Children: []Instruction{
+				&ParentInstructionV2{
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "country", Value: "SE"},
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+					},
+				},
+				&ParentInstructionV2{
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "country", Value: "DK"},
+					},
+				},
+			},
+		},
+	}
+	presentation := mockPresentation(t, instructions, "mura")
+
+	got, _, err := VerifyInto[credential](presentation, "mura")
+	assert.NoError(t, err)
+	assert.Equal(t, &Decoded[credential]{
+		Claims: credential{
+			Addresses: []mockDecodedAddress{{Country: "SE"}, {Country: "DK"}},
+		},
+		Undisclosed: []string{"addresses[0].street"},
+		Absent:      []string{"addresses[1].street"},
+	}, got)
+}
+
+func TestVerifyIntoNotValid(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+	}
+	presentation := mockPresentation(t, instructions, "mura", "given_name")
+
+	_, _, err := VerifyInto[mockDecodedCredential](strings.Replace(presentation, ".", ".x", 1), "mura")
+	assert.Error(t, err)
+
+	_, _, err = VerifyInto[mockDecodedCredential](presentation, "not_mura")
+	assert.Error(t, err)
+}
+
+func TestVerifyIntoKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+	}
+	sdjwt, err := instructions.SDJWTVC(mockVC, jwt.SigningMethodES256, key)
+	assert.NoError(t, err)
+
+	got, _, err := VerifyInto[mockDecodedCredential](sdjwt.String(), &key.PublicKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "John", got.Claims.GivenName)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, _, err = VerifyInto[mockDecodedCredential](sdjwt.String(), &other.PublicKey)
+	assert.Error(t, err)
+}
+
+func TestVerifierVerifyInto(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ChildInstructionV2{Name: "family_name", Value: "Doe", SelectiveDisclosure: true},
+	}
+	sdjwt, err := instructions.SDJWTVC(mockVC, jwt.SigningMethodES256, key)
+	assert.NoError(t, err)
+	presentation := mockVCPresentation(sdjwt)
+
+	got, validation, err := VerifierVerifyInto[mockDecodedCredential](ctx, &Verifier{Key: &key.PublicKey, VC: true}, presentation)
+	assert.NoError(t, err)
+	assert.True(t, validation.Verify)
+	assert.Equal(t, "John", got.Claims.GivenName)
+
+	t.Run("other key", func(t *testing.T) {
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		_, _, err = VerifierVerifyInto[mockDecodedCredential](ctx, &Verifier{Key: &other.PublicKey, VC: true}, presentation)
+		assert.Error(t, err)
+	})
+}
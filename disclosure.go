@@ -2,7 +2,9 @@ package gosdjwt
 
 import (
 	"encoding/base64"
-	"strings"
+	"encoding/json"
+	"errors"
+	"fmt"
 )
 
 // Disclosure keeps a disclosure
@@ -12,11 +14,27 @@ type Disclosure struct {
 	name           string
 	disclosureHash string
 	claimHash      string
+
+	// element is true for the disclosure of an array element, [salt, value], which has no name
+	element bool
 }
 
 // DisclosuresV2 is a map of disclosures
 type DisclosuresV2 map[string]Disclosure
 
+// clone returns a copy of the disclosures with deep copies of their values
+func (d DisclosuresV2) clone() DisclosuresV2 {
+	if d == nil {
+		return nil
+	}
+	clone := make(DisclosuresV2, len(d))
+	for k, disclosure := range d {
+		disclosure.value = cloneClaimValue(disclosure.value)
+		clone[k] = disclosure
+	}
+	return clone
+}
+
 //func (d DisclosuresV2) format() string {
 //	if len(d) == 0 {
 //		return ""
@@ -32,7 +50,10 @@ func (d DisclosuresV2) new(dd []string) error {
 	for _, v := range dd {
 		disclosure := Disclosure{}
 		if err := disclosure.parse(v); err != nil {
-			return err
+			return fmt.Errorf("%w: %w: %s", ErrSDJWTNotValid, ErrDisclosureNotValid, err)
+		}
+		if _, ok := d[disclosure.claimHash]; ok {
+			return fmt.Errorf("%w: %w: disclosure %s is given twice", ErrSDJWTNotValid, ErrDigestNotUnique, v)
 		}
 		d[disclosure.claimHash] = disclosure
 	}
@@ -48,26 +69,38 @@ func (d *Disclosure) makeClaimHash() {
 }
 
 func (d *Disclosure) parse(s string) error {
-	decoded, err := base64.RawStdEncoding.DecodeString(s)
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
 	if err != nil {
 		return err
 	}
 	d.disclosureHash = s
 
-	k, _ := strings.CutPrefix(string(decoded), "[")
-	k, _ = strings.CutSuffix(k, "]")
+	disclosure := []any{}
+	if err := json.Unmarshal(decoded, &disclosure); err != nil {
+		return err
+	}
 
-	for i, v := range strings.Split(k, ",") {
-		v = strings.Trim(v, "\"")
-		switch i {
-		case 0:
-			d.salt = v
-		case 1:
-			d.name = v
-		case 2:
-			d.value = v
+	switch len(disclosure) {
+	case 2:
+		d.value = disclosure[1]
+		d.element = true
+	case 3:
+		name, ok := disclosure[1].(string)
+		if !ok {
+			return errors.New("claim name is not a string")
 		}
+		d.name = name
+		d.value = disclosure[2]
+	default:
+		return fmt.Errorf("%d elements", len(disclosure))
 	}
+
+	salt, ok := disclosure[0].(string)
+	if !ok {
+		return errors.New("salt is not a string")
+	}
+	d.salt = salt
+
 	d.makeClaimHash()
 	return nil
 }
@@ -0,0 +1,94 @@
+package gosdjwt
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// DryRunDisclosure is a decoded disclosure of a dry run
+type DryRunDisclosure struct {
+	// Path is the JSON path of the disclosed claim, e.g. $.address.street or $.nationalities[1]
+	Path string `json:"path"`
+
+	// DigestPath is the JSON path of the digest, e.g. $.address._sd[0] or $.nationalities[1]
+	DigestPath string `json:"digest_path"`
+
+	Name       string `json:"name,omitempty"`
+	Value      any    `json:"value"`
+	Salt       string `json:"salt"`
+	Disclosure string `json:"disclosure"`
+	Digest     string `json:"digest"`
+}
+
+// DryRunReport is what a SD-JWT issued from the instructions would contain
+type DryRunReport struct {
+	// Payload is the unsigned payload with digests in place of the selective disclosable claims
+	Payload map[string]any `json:"payload"`
+
+	// Disclosures are sorted by path
+	Disclosures []DryRunDisclosure `json:"disclosures"`
+}
+
+// DryRun returns the payload and disclosures the instructions would produce, without signing.
+// Salts are random, so digests differ from run to run.
+func (i InstructionsV2) DryRun() (*DryRunReport, error) {
+	rawSDJWT, disclosures, err := i.createSDJWT()
+	if err != nil {
+		return nil, err
+	}
+
+	// the payload is encoded and decoded to get the same types as a verifier
+	b, err := json.Marshal(rawSDJWT)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]any{}
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return nil, err
+	}
+
+	decoded := DisclosuresV2{}
+	if err := decoded.new(disclosures.ArrayHashes()); err != nil {
+		return nil, err
+	}
+
+	r := newReconstruction(decoded)
+	if _, err := r.object(payload, ""); err != nil {
+		return nil, err
+	}
+
+	report := &DryRunReport{
+		Payload:     payload,
+		Disclosures: []DryRunDisclosure{},
+	}
+	for _, claim := range r.disclosed {
+		report.Disclosures = append(report.Disclosures, DryRunDisclosure{
+			Path:       jsonPath(claim.path),
+			DigestPath: jsonPath(claim.digestPath),
+			Name:       claim.disclosure.name,
+			Value:      claim.disclosure.value,
+			Salt:       claim.disclosure.salt,
+			Disclosure: claim.disclosure.disclosureHash,
+			Digest:     claim.disclosure.claimHash,
+		})
+	}
+	sort.SliceStable(report.Disclosures, func(a, b int) bool {
+		return report.Disclosures[a].Path < report.Disclosures[b].Path
+	})
+
+	return report, nil
+}
+
+// JSON returns the report as indented JSON
+func (r *DryRunReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// jsonPath converts a claim path, e.g. address.street, to a JSON path
+func jsonPath(path string) string {
+	if path == "" || strings.HasPrefix(path, "[") {
+		return "$" + path
+	}
+	return "$." + path
+}
@@ -0,0 +1,87 @@
+package gosdjwt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	newSalt = func() string {
+		return "salt_zyx"
+	}
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ParentInstructionV2{
+			Name:                "address",
+			SelectiveDisclosure: true,
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "country", Value: "SE"},
+				&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+			},
+		},
+		&ChildArrayInstructionV2{
+			Name: "nationalities",
+			Children: []Instruction{
+				&ChildInstructionV2{Value: "SE"},
+				&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+			},
+		},
+	}
+
+	report, err := instructions.DryRun()
+	assert.NoError(t, err)
+
+	type want struct {
+		path       string
+		digestPath string
+		name       string
+		value      any
+	}
+	wants := []want{
+		{path: "$.address", digestPath: "$._sd[1]", name: "address", value: map[string]any{"country": "SE", "_sd": []any{report.Disclosures[1].Digest}}},
+		{path: "$.address.street", digestPath: "$.address._sd[0]", name: "street", value: "Storgatan 1"},
+		{path: "$.given_name", digestPath: "$._sd[0]", name: "given_name", value: "John"},
+		{path: "$.nationalities[1]", digestPath: "$.nationalities[1]", value: "DK"},
+	}
+
+	assert.Len(t, report.Disclosures, len(wants))
+	for i, w := range wants {
+		got := report.Disclosures[i]
+		assert.Equal(t, w.path, got.Path)
+		assert.Equal(t, w.digestPath, got.DigestPath)
+		assert.Equal(t, w.name, got.Name)
+		assert.Equal(t, w.value, got.Value)
+		assert.Equal(t, "salt_zyx", got.Salt)
+		assert.Equal(t, hash(got.Disclosure), got.Digest)
+	}
+
+	assert.Equal(t, map[string]any{
+		"iss":     "https://example.com",
+		"_sd":     []any{report.Disclosures[2].Digest, report.Disclosures[0].Digest},
+		"_sd_alg": SDAlgSHA256,
+		"nationalities": []any{
+			"SE",
+			map[string]any{"...": report.Disclosures[3].Digest},
+		},
+	}, report.Payload)
+
+	b, err := report.JSON()
+	assert.NoError(t, err)
+
+	decoded := DryRunReport{}
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, *report, decoded)
+}
+
+func TestDryRunNotValid(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Value: "no name"},
+	}
+
+	_, err := instructions.DryRun()
+	assert.ErrorIs(t, err, ErrInstructionNameEmpty)
+}
@@ -0,0 +1,308 @@
+package gosdjwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// InstructionTypeParent is the encoded type of ParentInstructionV2
+	InstructionTypeParent = "parent"
+
+	// InstructionTypeRecursive is the encoded type of RecursiveInstructionV2
+	InstructionTypeRecursive = "recursive"
+
+	// InstructionTypeChild is the encoded type of ChildInstructionV2
+	InstructionTypeChild = "child"
+
+	// InstructionTypeArray is the encoded type of ChildArrayInstructionV2
+	InstructionTypeArray = "array"
+)
+
+var (
+	// ErrInstructionTypeMissing is returned when an encoded instruction lacks a type
+	ErrInstructionTypeMissing = errors.New("instruction type is missing")
+)
+
+// instructionType is used to read the type of an encoded instruction
+type instructionType struct {
+	Type string `json:"type" yaml:"type"`
+}
+
+func newInstruction(t string) (Instruction, error) {
+	switch t {
+	case InstructionTypeParent:
+		return &ParentInstructionV2{}, nil
+	case InstructionTypeRecursive:
+		return &RecursiveInstructionV2{}, nil
+	case InstructionTypeChild:
+		return &ChildInstructionV2{}, nil
+	case InstructionTypeArray:
+		return &ChildArrayInstructionV2{}, nil
+	case "":
+		return nil, ErrInstructionTypeMissing
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrNotKnownInstruction, t)
+	}
+}
+
+// unmarshalJSONInstructions decodes type discriminated instructions, defaultType is used for instructions without a type
+func unmarshalJSONInstructions(raws []json.RawMessage, defaultType string) ([]Instruction, error) {
+	if raws == nil {
+		return nil, nil
+	}
+	instructions := []Instruction{}
+	for _, raw := range raws {
+		t := instructionType{}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, err
+		}
+		if t.Type == "" {
+			t.Type = defaultType
+		}
+		instruction, err := newInstruction(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, instruction); err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions, nil
+}
+
+// unmarshalYAMLInstructions decodes type discriminated instructions, defaultType is used for instructions without a type
+func unmarshalYAMLInstructions(nodes []yaml.Node, defaultType string) ([]Instruction, error) {
+	if nodes == nil {
+		return nil, nil
+	}
+	instructions := []Instruction{}
+	for _, node := range nodes {
+		t := instructionType{}
+		if err := node.Decode(&t); err != nil {
+			return nil, err
+		}
+		if t.Type == "" {
+			t.Type = defaultType
+		}
+		instruction, err := newInstruction(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		if err := node.Decode(instruction); err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions, nil
+}
+
+// splitChildrenNode returns a copy of a mapping node without its children, and the children nodes
+func splitChildrenNode(value *yaml.Node) (*yaml.Node, []yaml.Node, error) {
+	node := *value
+	node.Content = nil
+
+	var children []yaml.Node
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, v := value.Content[i], value.Content[i+1]
+		if key.Value == "children" {
+			if err := v.Decode(&children); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		node.Content = append(node.Content, key, v)
+	}
+	return &node, children, nil
+}
+
+// UnmarshalJSON decodes a list of type discriminated instructions
+func (i *InstructionsV2) UnmarshalJSON(b []byte) error {
+	raws := []json.RawMessage{}
+	if err := json.Unmarshal(b, &raws); err != nil {
+		return err
+	}
+	instructions, err := unmarshalJSONInstructions(raws, "")
+	if err != nil {
+		return err
+	}
+	*i = instructions
+	return nil
+}
+
+// UnmarshalYAML decodes a list of type discriminated instructions
+func (i *InstructionsV2) UnmarshalYAML(value *yaml.Node) error {
+	nodes := []yaml.Node{}
+	if err := value.Decode(&nodes); err != nil {
+		return err
+	}
+	instructions, err := unmarshalYAMLInstructions(nodes, "")
+	if err != nil {
+		return err
+	}
+	*i = instructions
+	return nil
+}
+
+// MarshalJSON encodes the instruction with its type
+func (p ParentInstructionV2) MarshalJSON() ([]byte, error) {
+	type alias ParentInstructionV2
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		alias
+	}{InstructionTypeParent, alias(p)})
+}
+
+// MarshalYAML encodes the instruction with its type
+func (p ParentInstructionV2) MarshalYAML() (any, error) {
+	type alias ParentInstructionV2
+	return struct {
+		Type  string `yaml:"type"`
+		alias `yaml:",inline"`
+	}{InstructionTypeParent, alias(p)}, nil
+}
+
+// UnmarshalJSON decodes the instruction and its type discriminated children
+func (p *ParentInstructionV2) UnmarshalJSON(b []byte) error {
+	type alias ParentInstructionV2
+	a := struct {
+		*alias
+		Children []json.RawMessage `json:"children"`
+	}{alias: (*alias)(p)}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return err
+	}
+	var err error
+	p.Children, err = unmarshalJSONInstructions(a.Children, "")
+	return err
+}
+
+// UnmarshalYAML decodes the instruction and its type discriminated children
+func (p *ParentInstructionV2) UnmarshalYAML(value *yaml.Node) error {
+	type alias ParentInstructionV2
+	node, children, err := splitChildrenNode(value)
+	if err != nil {
+		return err
+	}
+	if err := node.Decode((*alias)(p)); err != nil {
+		return err
+	}
+	p.Children, err = unmarshalYAMLInstructions(children, "")
+	return err
+}
+
+// MarshalJSON encodes the instruction with its type
+func (r RecursiveInstructionV2) MarshalJSON() ([]byte, error) {
+	type alias RecursiveInstructionV2
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		alias
+	}{InstructionTypeRecursive, alias(r)})
+}
+
+// MarshalYAML encodes the instruction with its type
+func (r RecursiveInstructionV2) MarshalYAML() (any, error) {
+	type alias RecursiveInstructionV2
+	return struct {
+		Type  string `yaml:"type"`
+		alias `yaml:",inline"`
+	}{InstructionTypeRecursive, alias(r)}, nil
+}
+
+// UnmarshalJSON decodes the instruction and its type discriminated children
+func (r *RecursiveInstructionV2) UnmarshalJSON(b []byte) error {
+	type alias RecursiveInstructionV2
+	a := struct {
+		*alias
+		Children []json.RawMessage `json:"children"`
+	}{alias: (*alias)(r)}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return err
+	}
+	var err error
+	r.Children, err = unmarshalJSONInstructions(a.Children, "")
+	return err
+}
+
+// UnmarshalYAML decodes the instruction and its type discriminated children
+func (r *RecursiveInstructionV2) UnmarshalYAML(value *yaml.Node) error {
+	type alias RecursiveInstructionV2
+	node, children, err := splitChildrenNode(value)
+	if err != nil {
+		return err
+	}
+	if err := node.Decode((*alias)(r)); err != nil {
+		return err
+	}
+	r.Children, err = unmarshalYAMLInstructions(children, "")
+	return err
+}
+
+// MarshalJSON encodes the instruction with its type
+func (c ChildInstructionV2) MarshalJSON() ([]byte, error) {
+	type alias ChildInstructionV2
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		alias
+	}{InstructionTypeChild, alias(c)})
+}
+
+// MarshalYAML encodes the instruction with its type
+func (c ChildInstructionV2) MarshalYAML() (any, error) {
+	type alias ChildInstructionV2
+	return struct {
+		Type  string `yaml:"type"`
+		alias `yaml:",inline"`
+	}{InstructionTypeChild, alias(c)}, nil
+}
+
+// MarshalJSON encodes the instruction with its type
+func (c ChildArrayInstructionV2) MarshalJSON() ([]byte, error) {
+	type alias ChildArrayInstructionV2
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		alias
+	}{InstructionTypeArray, alias(c)})
+}
+
+// MarshalYAML encodes the instruction with its type
+func (c ChildArrayInstructionV2) MarshalYAML() (any, error) {
+	type alias ChildArrayInstructionV2
+	return struct {
+		Type  string `yaml:"type"`
+		alias `yaml:",inline"`
+	}{InstructionTypeArray, alias(c)}, nil
+}
+
+// UnmarshalJSON decodes the instruction and its type discriminated elements, an element without a type is a child
+func (c *ChildArrayInstructionV2) UnmarshalJSON(b []byte) error {
+	type alias ChildArrayInstructionV2
+	a := struct {
+		*alias
+		Children []json.RawMessage `json:"children"`
+	}{alias: (*alias)(c)}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return err
+	}
+	var err error
+	c.Children, err = unmarshalJSONInstructions(a.Children, InstructionTypeChild)
+	return err
+}
+
+// UnmarshalYAML decodes the instruction and its type discriminated elements, an element without a type is a child
+func (c *ChildArrayInstructionV2) UnmarshalYAML(value *yaml.Node) error {
+	type alias ChildArrayInstructionV2
+	node, children, err := splitChildrenNode(value)
+	if err != nil {
+		return err
+	}
+	if err := node.Decode((*alias)(c)); err != nil {
+		return err
+	}
+	c.Children, err = unmarshalYAMLInstructions(children, InstructionTypeChild)
+	return err
+}
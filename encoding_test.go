@@ -0,0 +1,189 @@
+package gosdjwt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+var mockEncodingInstructions = InstructionsV2{
+	&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+	&ParentInstructionV2{
+		Name:                "address",
+		SelectiveDisclosure: true,
+		Children: []Instruction{
+			&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+		},
+	},
+	&RecursiveInstructionV2{
+		Name: "place_of_birth",
+		Children: []Instruction{
+			&ChildInstructionV2{Name: "country", Value: "SE"},
+			&RecursiveInstructionV2{
+				Name: "locality",
+				Children: []Instruction{
+					&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+				},
+			},
+		},
+	},
+	&ChildArrayInstructionV2{
+		Name: "nationalities",
+		Children: []Instruction{
+			&ChildInstructionV2{Value: "SE"},
+			&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+		},
+	},
+	&ChildArrayInstructionV2{
+		Name: "addresses",
+		Children: []Instruction{
+			&ParentInstructionV2{
+				SelectiveDisclosure: true,
+				Children: []Instruction{
+					&ChildInstructionV2{Name: "street", Value: "Gade 2"},
+				},
+			},
+			&ChildArrayInstructionV2{
+				Children: []Instruction{
+					&ChildInstructionV2{Value: "a"},
+				},
+			},
+		},
+	},
+}
+
+func TestInstructionsUnmarshalJSON(t *testing.T) {
+	have := `[
+		{"type": "child", "name": "iss", "value": "https://example.com"},
+		{"type": "parent", "name": "address", "sd": true, "children": [
+			{"type": "child", "name": "street", "value": "Storgatan 1"}
+		]},
+		{"type": "recursive", "name": "place_of_birth", "children": [
+			{"type": "child", "name": "country", "value": "SE"},
+			{"type": "recursive", "name": "locality", "children": [
+				{"type": "child", "name": "city", "value": "Stockholm"}
+			]}
+		]},
+		{"type": "array", "name": "nationalities", "children": [
+			{"value": "SE"},
+			{"value": "DK", "sd": true}
+		]},
+		{"type": "array", "name": "addresses", "children": [
+			{"type": "parent", "sd": true, "children": [
+				{"type": "child", "name": "street", "value": "Gade 2"}
+			]},
+			{"type": "array", "children": [
+				{"value": "a"}
+			]}
+		]}
+	]`
+
+	got := InstructionsV2{}
+	err := json.Unmarshal([]byte(have), &got)
+	assert.NoError(t, err)
+	assert.Equal(t, mockEncodingInstructions, got)
+}
+
+func TestInstructionsUnmarshalYAML(t *testing.T) {
+	have := `
+- type: child
+  name: iss
+  value: https://example.com
+- type: parent
+  name: address
+  sd: true
+  children:
+    - type: child
+      name: street
+      value: Storgatan 1
+- type: recursive
+  name: place_of_birth
+  children:
+    - type: child
+      name: country
+      value: SE
+    - type: recursive
+      name: locality
+      children:
+        - type: child
+          name: city
+          value: Stockholm
+- type: array
+  name: nationalities
+  children:
+    - value: SE
+    - value: DK
+      sd: true
+- type: array
+  name: addresses
+  children:
+    - type: parent
+      sd: true
+      children:
+        - type: child
+          name: street
+          value: Gade 2
+    - type: array
+      children:
+        - value: a
+`
+
+	got := InstructionsV2{}
+	err := yaml.Unmarshal([]byte(have), &got)
+	assert.NoError(t, err)
+	assert.Equal(t, mockEncodingInstructions, got)
+}
+
+func TestInstructionsRoundTrip(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		b, err := json.Marshal(mockEncodingInstructions)
+		assert.NoError(t, err)
+
+		got := InstructionsV2{}
+		assert.NoError(t, json.Unmarshal(b, &got))
+		assert.Equal(t, mockEncodingInstructions, got)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		b, err := yaml.Marshal(mockEncodingInstructions)
+		assert.NoError(t, err)
+
+		got := InstructionsV2{}
+		assert.NoError(t, yaml.Unmarshal(b, &got))
+		assert.Equal(t, mockEncodingInstructions, got)
+	})
+}
+
+func TestInstructionsUnmarshalErrors(t *testing.T) {
+	tts := []struct {
+		name string
+		have string
+		want error
+	}{
+		{
+			name: "missing type",
+			have: `[{"name": "iss"}]`,
+			want: ErrInstructionTypeMissing,
+		},
+		{
+			name: "unknown type",
+			have: `[{"type": "unknown", "name": "iss"}]`,
+			want: ErrNotKnownInstruction,
+		},
+		{
+			name: "unknown type of child",
+			have: `[{"type": "parent", "name": "address", "children": [{"type": "unknown"}]}]`,
+			want: ErrNotKnownInstruction,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got := InstructionsV2{}
+			err := json.Unmarshal([]byte(tt.have), &got)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package gosdjwt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// recordEnvelopeVersion is the version of the envelope of encrypted records
+	recordEnvelopeVersion = 1
+
+	// recordEnvelopeAlg is the content encryption of encrypted records, AES-256-GCM
+	recordEnvelopeAlg = "A256GCM"
+
+	// dataKeySize is the size of the AES-256 key each record is encrypted with
+	dataKeySize = 32
+)
+
+var (
+	// ErrRecordNotValid is returned when an encrypted record can not be decrypted, because it was changed,
+	// moved to another ID, or its key is not the one it was encrypted with
+	ErrRecordNotValid = errors.New("encrypted record is not valid")
+
+	// ErrKeyEncryptionKeyNotFound is returned when a record is wrapped by a key encryption key the store does not have
+	ErrKeyEncryptionKeyNotFound = errors.New("key encryption key is not found")
+)
+
+// KeyEncryptionKey wraps the data keys of encrypted records, e.g. a key in a KMS or a hardware keystore
+type KeyEncryptionKey interface {
+	// ID identifies the key, it is stored with each record so the right key can unwrap it
+	ID() string
+
+	// Wrap encrypts a data key, aad has to be given to Unwrap
+	Wrap(ctx context.Context, dataKey, aad []byte) ([]byte, error)
+
+	// Unwrap decrypts a data key wrapped by Wrap
+	Unwrap(ctx context.Context, wrapped, aad []byte) ([]byte, error)
+}
+
+// AESKeyEncryptionKey is a KeyEncryptionKey that wraps data keys with AES-GCM
+type AESKeyEncryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewAESKeyEncryptionKey returns a key encryption key for a 16, 24 or 32 byte AES key
+func NewAESKeyEncryptionKey(id string, key []byte) (*AESKeyEncryptionKey, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &AESKeyEncryptionKey{id: id, aead: aead}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ID returns the ID of the key
+func (k *AESKeyEncryptionKey) ID() string {
+	return k.id
+}
+
+// Wrap encrypts the data key with a random nonce, which is prepended
+func (k *AESKeyEncryptionKey) Wrap(ctx context.Context, dataKey, aad []byte) ([]byte, error) {
+	return sealAEAD(k.aead, dataKey, aad)
+}
+
+// Unwrap decrypts a data key wrapped by Wrap
+func (k *AESKeyEncryptionKey) Unwrap(ctx context.Context, wrapped, aad []byte) ([]byte, error) {
+	return openAEAD(k.aead, wrapped, aad)
+}
+
+// sealAEAD encrypts plaintext with a random nonce and returns the nonce followed by the ciphertext
+func sealAEAD(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// openAEAD decrypts the output of sealAEAD
+func openAEAD(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrRecordNotValid
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrRecordNotValid
+	}
+	return plaintext, nil
+}
+
+// recordEnvelope is an encrypted record, the credential encrypted with a data key that is wrapped by a key
+// encryption key
+type recordEnvelope struct {
+	Version    int    `json:"v"`
+	Alg        string `json:"alg"`
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// aad binds the ciphertext to the ID of its record, so records can not be swapped
+func (e *recordEnvelope) aad(id string) []byte {
+	b, _ := json.Marshal([]any{e.Version, e.Alg, id})
+	return b
+}
+
+// keyAAD binds the wrapped data key to the ID of its record and the key encryption key
+func (e *recordEnvelope) keyAAD(id string) []byte {
+	b, _ := json.Marshal([]any{e.Version, e.Alg, e.KeyID, id})
+	return b
+}
+
+// envelopeCodec encrypts records with a new data key each, wrapped by the current key encryption key
+type envelopeCodec struct {
+	current KeyEncryptionKey
+	keys    map[string]KeyEncryptionKey
+}
+
+func (c *envelopeCodec) seal(ctx context.Context, id string, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := &recordEnvelope{
+		Version: recordEnvelopeVersion,
+		Alg:     recordEnvelopeAlg,
+		KeyID:   c.current.ID(),
+	}
+	if envelope.WrappedKey, err = c.current.Wrap(ctx, dataKey, envelope.keyAAD(id)); err != nil {
+		return nil, err
+	}
+	if envelope.Ciphertext, err = sealAEAD(aead, plaintext, envelope.aad(id)); err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
+func (c *envelopeCodec) open(ctx context.Context, id string, record []byte) ([]byte, error) {
+	envelope, dataKey, err := c.unwrap(ctx, id, record)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRecordNotValid, id)
+	}
+	plaintext, err := openAEAD(aead, envelope.Ciphertext, envelope.aad(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, id)
+	}
+	return plaintext, nil
+}
+
+// unwrap decodes the envelope of a record and unwraps its data key
+func (c *envelopeCodec) unwrap(ctx context.Context, id string, record []byte) (*recordEnvelope, []byte, error) {
+	envelope := &recordEnvelope{}
+	if err := json.Unmarshal(record, envelope); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %s", ErrRecordNotValid, id, err)
+	}
+	if envelope.Version != recordEnvelopeVersion || envelope.Alg != recordEnvelopeAlg {
+		return nil, nil, fmt.Errorf("%w: %s: version %d %s", ErrRecordNotValid, id, envelope.Version, envelope.Alg)
+	}
+
+	kek, ok := c.keys[envelope.KeyID]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s: %q", ErrKeyEncryptionKeyNotFound, id, envelope.KeyID)
+	}
+	dataKey, err := kek.Unwrap(ctx, envelope.WrappedKey, envelope.keyAAD(id))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %s", ErrRecordNotValid, id, err)
+	}
+	return envelope, dataKey, nil
+}
+
+// rewrap wraps the data key of a record with the current key encryption key, the ciphertext is kept.
+// changed is false if the record already is wrapped by the current key.
+func (c *envelopeCodec) rewrap(ctx context.Context, id string, record []byte) ([]byte, bool, error) {
+	envelope, dataKey, err := c.unwrap(ctx, id, record)
+	if err != nil {
+		return nil, false, err
+	}
+	if envelope.KeyID == c.current.ID() {
+		return record, false, nil
+	}
+
+	envelope.KeyID = c.current.ID()
+	if envelope.WrappedKey, err = c.current.Wrap(ctx, dataKey, envelope.keyAAD(id)); err != nil {
+		return nil, false, err
+	}
+	b, err := json.Marshal(envelope)
+	return b, true, err
+}
+
+// EncryptedCredentialStore is a CredentialStore that encrypts each credential, with its disclosures and metadata,
+// before it is stored in a RecordStore. Each record has its own AES-256-GCM data key and nonce, the data key is
+// wrapped by a key encryption key. A record that is changed, or moved to another ID, fails to decrypt with
+// ErrRecordNotValid. It is safe for concurrent use within a process.
+type EncryptedCredentialStore struct {
+	*recordCredentialStore
+	codec *envelopeCodec
+}
+
+// NewEncryptedCredentialStore returns a store that keeps its records in records. New records are wrapped by
+// current, previous are the key encryption keys of records that are not rotated yet.
+func NewEncryptedCredentialStore(records RecordStore, current KeyEncryptionKey, previous ...KeyEncryptionKey) *EncryptedCredentialStore {
+	codec := &envelopeCodec{
+		current: current,
+		keys:    map[string]KeyEncryptionKey{current.ID(): current},
+	}
+	for _, kek := range previous {
+		if _, ok := codec.keys[kek.ID()]; !ok {
+			codec.keys[kek.ID()] = kek
+		}
+	}
+	return &EncryptedCredentialStore{
+		recordCredentialStore: newRecordCredentialStore(records, codec),
+		codec:                 codec,
+	}
+}
+
+// Rotate wraps the data keys of all records with the current key encryption key, after which the previous keys
+// are no longer needed. It returns how many records were rewrapped.
+func (s *EncryptedCredentialStore) Rotate(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.records.IDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, id := range ids {
+		record, err := s.records.Get(ctx, id)
+		if err != nil {
+			return rotated, err
+		}
+		rewrapped, changed, err := s.codec.rewrap(ctx, id, record)
+		if err != nil {
+			return rotated, err
+		}
+		if !changed {
+			continue
+		}
+		if err := s.records.Put(ctx, id, rewrapped); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
@@ -0,0 +1,207 @@
+package gosdjwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockKeyEncryptionKey(t *testing.T, id string) *AESKeyEncryptionKey {
+	kek, err := NewAESKeyEncryptionKey(id, bytes.Repeat([]byte(id[len(id)-1:]), 32))
+	assert.NoError(t, err)
+	return kek
+}
+
+func TestEncryptedCredentialStore(t *testing.T) {
+	store := NewEncryptedCredentialStore(NewMemoryRecordStore(), mockKeyEncryptionKey(t, "kek-1"))
+	store.now = func() time.Time { return mockWalletNow }
+	testCredentialStore(t, store)
+}
+
+func TestEncryptedCredentialStoreFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	records, err := NewFileRecordStore(dir)
+	assert.NoError(t, err)
+	store := NewEncryptedCredentialStore(records, mockKeyEncryptionKey(t, "kek-1"))
+
+	credential, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/pid", time.Time{}, "SE"), "holder-key-1")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put(ctx, credential))
+
+	b, err := os.ReadFile(filepath.Join(dir, credential.ID+".json"))
+	assert.NoError(t, err)
+	for _, plaintext := range append([]string{"John", "https://example.com/pid", "holder-key-1", credential.SDJWT.JWT}, credential.SDJWT.Disclosures.ArrayHashes()...) {
+		assert.False(t, strings.Contains(string(b), plaintext), "%s is not encrypted", plaintext)
+	}
+
+	got, err := store.Get(ctx, credential.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, credential.Claims, got.Claims)
+}
+
+func TestEncryptedCredentialStoreTampering(t *testing.T) {
+	ctx := context.Background()
+
+	newStore := func() (*EncryptedCredentialStore, *MemoryRecordStore, *StoredCredential) {
+		records := NewMemoryRecordStore()
+		store := NewEncryptedCredentialStore(records, mockKeyEncryptionKey(t, "kek-1"))
+		credential, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/pid", time.Time{}, "SE"), "")
+		assert.NoError(t, err)
+		assert.NoError(t, store.Put(ctx, credential))
+		return store, records, credential
+	}
+
+	editEnvelope := func(t *testing.T, records *MemoryRecordStore, id string, edit func(envelope *recordEnvelope)) {
+		record, err := records.Get(ctx, id)
+		assert.NoError(t, err)
+		envelope := &recordEnvelope{}
+		assert.NoError(t, json.Unmarshal(record, envelope))
+		edit(envelope)
+		record, err = json.Marshal(envelope)
+		assert.NoError(t, err)
+		assert.NoError(t, records.Put(ctx, id, record))
+	}
+
+	tts := []struct {
+		name   string
+		tamper func(t *testing.T, store *EncryptedCredentialStore, records *MemoryRecordStore, id string) string
+		want   error
+	}{
+		{
+			name: "test 0 - ciphertext changed",
+			tamper: func(t *testing.T, store *EncryptedCredentialStore, records *MemoryRecordStore, id string) string {
+				editEnvelope(t, records, id, func(envelope *recordEnvelope) { envelope.Ciphertext[20] ^= 1 })
+				return id
+			},
+			want: ErrRecordNotValid,
+		},
+		{
+			name: "test 1 - wrapped key changed",
+			tamper: func(t *testing.T, store *EncryptedCredentialStore, records *MemoryRecordStore, id string) string {
+				editEnvelope(t, records, id, func(envelope *recordEnvelope) { envelope.WrappedKey[20] ^= 1 })
+				return id
+			},
+			want: ErrRecordNotValid,
+		},
+		{
+			name: "test 2 - record moved to another id",
+			tamper: func(t *testing.T, store *EncryptedCredentialStore, records *MemoryRecordStore, id string) string {
+				record, err := records.Get(ctx, id)
+				assert.NoError(t, err)
+				assert.NoError(t, records.Put(ctx, "other", record))
+				return "other"
+			},
+			want: ErrRecordNotValid,
+		},
+		{
+			name: "test 3 - unknown key encryption key",
+			tamper: func(t *testing.T, store *EncryptedCredentialStore, records *MemoryRecordStore, id string) string {
+				editEnvelope(t, records, id, func(envelope *recordEnvelope) { envelope.KeyID = "kek-9" })
+				return id
+			},
+			want: ErrKeyEncryptionKeyNotFound,
+		},
+		{
+			name: "test 4 - another key with the same id",
+			tamper: func(t *testing.T, store *EncryptedCredentialStore, records *MemoryRecordStore, id string) string {
+				other, err := NewAESKeyEncryptionKey("kek-1", bytes.Repeat([]byte("x"), 32))
+				assert.NoError(t, err)
+				store.codec.keys["kek-1"] = other
+				return id
+			},
+			want: ErrRecordNotValid,
+		},
+		{
+			name: "test 5 - not an envelope",
+			tamper: func(t *testing.T, store *EncryptedCredentialStore, records *MemoryRecordStore, id string) string {
+				assert.NoError(t, records.Put(ctx, id, []byte(`{"id": "plaintext"}`)))
+				return id
+			},
+			want: ErrRecordNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			store, records, credential := newStore()
+			id := tt.tamper(t, store, records, credential.ID)
+
+			_, err := store.Get(ctx, id)
+			assert.ErrorIs(t, err, tt.want)
+
+			_, err = store.Query(ctx, CredentialQuery{})
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestEncryptedCredentialStoreNonces(t *testing.T) {
+	ctx := context.Background()
+	records := NewMemoryRecordStore()
+	store := NewEncryptedCredentialStore(records, mockKeyEncryptionKey(t, "kek-1"))
+
+	serialized := mockWalletCredential(t, "https://example.com/pid", time.Time{}, "SE")
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		credential, err := NewStoredCredential(serialized, "")
+		assert.NoError(t, err)
+		assert.NoError(t, store.Put(ctx, credential))
+
+		record, err := records.Get(ctx, credential.ID)
+		assert.NoError(t, err)
+		envelope := &recordEnvelope{}
+		assert.NoError(t, json.Unmarshal(record, envelope))
+
+		for _, b := range [][]byte{envelope.Ciphertext[:12], envelope.WrappedKey} {
+			assert.False(t, seen[string(b)], "nonces and data keys are not reused")
+			seen[string(b)] = true
+		}
+	}
+}
+
+func TestEncryptedCredentialStoreRotate(t *testing.T) {
+	ctx := context.Background()
+	records := NewMemoryRecordStore()
+	kek1, kek2 := mockKeyEncryptionKey(t, "kek-1"), mockKeyEncryptionKey(t, "kek-2")
+
+	store := NewEncryptedCredentialStore(records, kek1)
+	ids := []string{}
+	for _, country := range []string{"SE", "DK"} {
+		credential, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/pid", time.Time{}, country), "")
+		assert.NoError(t, err)
+		assert.NoError(t, store.Put(ctx, credential))
+		ids = append(ids, credential.ID)
+	}
+
+	_, err := NewEncryptedCredentialStore(records, kek2).Get(ctx, ids[0])
+	assert.ErrorIs(t, err, ErrKeyEncryptionKeyNotFound, "previous key is needed before rotation")
+
+	rotating := NewEncryptedCredentialStore(records, kek2, kek1)
+	got, err := rotating.Query(ctx, CredentialQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	rotated, err := rotating.Rotate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rotated)
+
+	rotated, err = rotating.Rotate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rotated)
+
+	rotatedStore := NewEncryptedCredentialStore(records, kek2)
+	for _, id := range ids {
+		credential, err := rotatedStore.Get(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/pid", credential.VCT)
+	}
+}
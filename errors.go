@@ -10,4 +10,22 @@ var (
 
 	// ErrBase64EncodedEmpty is returned when the base64 encoded string is empty in Instruction
 	ErrBase64EncodedEmpty = errors.New("base64Encoded is empty")
+
+	// ErrDisclosureNotValid is returned when a disclosure is not a JSON array of salt, name and value, or salt and value
+	ErrDisclosureNotValid = errors.New("disclosure is not valid")
+
+	// ErrDisclosureNotReferenced is returned when a disclosure is not referenced by any digest in the SD-JWT
+	ErrDisclosureNotReferenced = errors.New("disclosure is not referenced")
+
+	// ErrDigestNotUnique is returned when the same digest is referenced more than once
+	ErrDigestNotUnique = errors.New("digest is not unique")
+
+	// ErrClaimNameExists is returned when a disclosed claim name already exists in the object
+	ErrClaimNameExists = errors.New("disclosed claim name already exists")
+
+	// ErrSDAlgNotSupported is returned when the _sd_alg of a SD-JWT is not sha-256
+	ErrSDAlgNotSupported = errors.New("_sd_alg is not supported")
+
+	// ErrSDJWTNotValid is returned when a serialized SD-JWT can not be parsed
+	ErrSDJWTNotValid = errors.New("SD-JWT is not valid")
 )
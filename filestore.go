@@ -0,0 +1,132 @@
+package gosdjwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// recordFileExt is the extension of record files
+const recordFileExt = ".json"
+
+// FileRecordStore is a RecordStore with one file per record in a directory.
+// Files are written atomically and only readable by the owner.
+type FileRecordStore struct {
+	dir string
+}
+
+// NewFileRecordStore returns a store in dir, which is created if it does not exist
+func NewFileRecordStore(dir string) (*FileRecordStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileRecordStore{dir: dir}, nil
+}
+
+func (s *FileRecordStore) path(id string) (string, error) {
+	if !credentialIDPattern.MatchString(id) {
+		return "", fmt.Errorf("%w: %q", ErrCredentialIDNotValid, id)
+	}
+	return filepath.Join(s.dir, id+recordFileExt), nil
+}
+
+// Put writes the record to its file
+func (s *FileRecordStore) Put(ctx context.Context, id string, record []byte) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, record)
+}
+
+// writeFileAtomic writes b to a temporary file that is renamed to path, readers never see a partial file
+func writeFileAtomic(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Get reads the record with id
+func (s *FileRecordStore) Get(ctx context.Context, id string) ([]byte, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrCredentialNotFound, id)
+	}
+	return b, err
+}
+
+// Delete removes the file of the record with id
+func (s *FileRecordStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrCredentialNotFound, id)
+	}
+	return err
+}
+
+// IDs returns the sorted IDs of the record files, other files in the directory are ignored
+func (s *FileRecordStore) IDs(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), recordFileExt)
+		if !ok || entry.IsDir() || !credentialIDPattern.MatchString(id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// FileCredentialStore is a CredentialStore with one JSON file per credential in a directory.
+// Files are written atomically and only readable by the owner, but they are not encrypted, see
+// EncryptedCredentialStore. It is safe for concurrent use within a process.
+type FileCredentialStore struct {
+	*recordCredentialStore
+}
+
+// NewFileCredentialStore returns a store in dir, which is created if it does not exist
+func NewFileCredentialStore(dir string) (*FileCredentialStore, error) {
+	records, err := NewFileRecordStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileCredentialStore{newRecordCredentialStore(records, plainCodec{})}, nil
+}
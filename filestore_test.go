@@ -0,0 +1,64 @@
+package gosdjwt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCredentialStore(t *testing.T) {
+	store, err := NewFileCredentialStore(filepath.Join(t.TempDir(), "credentials"))
+	assert.NoError(t, err)
+	store.now = func() time.Time { return mockWalletNow }
+	testCredentialStore(t, store)
+}
+
+func TestFileCredentialStoreFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := NewFileCredentialStore(dir)
+	assert.NoError(t, err)
+
+	credential, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/pid", time.Time{}, "SE"), "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put(ctx, credential))
+
+	info, err := os.Stat(filepath.Join(dir, credential.ID+".json"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files are left")
+
+	t.Run("read by another store", func(t *testing.T) {
+		other, err := NewFileCredentialStore(dir)
+		assert.NoError(t, err)
+
+		got, err := other.Get(ctx, credential.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, credential.Claims, got.Claims)
+		assert.Equal(t, credential.VCT, got.VCT)
+	})
+
+	t.Run("other files are ignored", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("credentials"), 0o600))
+
+		got, err := store.Query(ctx, CredentialQuery{})
+		assert.NoError(t, err)
+		assert.Len(t, got, 1)
+	})
+
+	t.Run("id outside of the directory", func(t *testing.T) {
+		_, err := store.Get(ctx, "../credential")
+		assert.ErrorIs(t, err, ErrCredentialIDNotValid)
+
+		err = store.Put(ctx, &StoredCredential{ID: "../credential", SDJWT: credential.SDJWT})
+		assert.ErrorIs(t, err, ErrCredentialIDNotValid)
+	})
+}
@@ -0,0 +1,135 @@
+package gosdjwt
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrHeaderParameterReserved is returned when an extra header parameter is set by the signer or by a Header field
+	ErrHeaderParameterReserved = errors.New("header parameter is reserved")
+
+	// ErrHeaderNotValid is returned when the header of a SD-JWT can not be decoded
+	ErrHeaderNotValid = errors.New("header is not valid")
+
+	// ErrHeaderJWKNotPublic is returned when the jwk header parameter has private key parameters
+	ErrHeaderJWKNotPublic = errors.New("header jwk is not a public key")
+)
+
+// Header holds the JOSE header parameters set on issuance, empty fields are left out
+type Header struct {
+	// Type is the typ parameter, JWT is used if empty
+	Type string
+
+	// KeyID is the kid parameter
+	KeyID string
+
+	// X5C is the x5c parameter, base64 encoded DER certificates with the signing certificate first
+	X5C []string
+
+	// JWK is the jwk parameter, the public key of the signer. A JWK with private key parameters is rejected.
+	JWK map[string]any
+
+	// TrustChain is the trust_chain parameter, OpenID Federation entity statements
+	TrustChain []string
+
+	// Extra are additional header parameters, they can not replace alg or a parameter set by a field
+	Extra map[string]any
+}
+
+// params returns the header parameters
+func (h Header) params() (map[string]any, error) {
+	params := map[string]any{}
+	if h.Type != "" {
+		params["typ"] = h.Type
+	}
+	if h.KeyID != "" {
+		params["kid"] = h.KeyID
+	}
+	if len(h.X5C) > 0 {
+		params["x5c"] = h.X5C
+	}
+	if h.JWK != nil {
+		params["jwk"] = h.JWK
+	}
+	if len(h.TrustChain) > 0 {
+		params["trust_chain"] = h.TrustChain
+	}
+
+	for k, v := range h.Extra {
+		if _, ok := params[k]; ok || k == "alg" {
+			return nil, fmt.Errorf("%w: %s", ErrHeaderParameterReserved, k)
+		}
+		params[k] = v
+	}
+
+	if jwk, ok := params["jwk"].(map[string]any); ok {
+		if name, ok := privateMember(jwk); ok {
+			return nil, fmt.Errorf("%w: %s", ErrHeaderJWKNotPublic, name)
+		}
+	}
+	return params, nil
+}
+
+// EncodeX5C returns certificates encoded for the x5c header parameter
+func EncodeX5C(certs ...*x509.Certificate) []string {
+	x5c := []string{}
+	for _, cert := range certs {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	return x5c
+}
+
+// keyOf returns the key used to sign or verify, a string is used as a HMAC secret
+func keyOf(key any) any {
+	if s, ok := key.(string); ok {
+		return []byte(s)
+	}
+	return key
+}
+
+// SDJWTWithHeader returns a signed SD-JWT with disclosures, and header added to its JOSE header.
+// signingKey is the private key of signingMethod, a string is used as a HMAC secret.
+func (i InstructionsV2) SDJWTWithHeader(header Header, signingMethod jwt.SigningMethod, signingKey any) (*SDJWT, error) {
+	params, err := header.params()
+	if err != nil {
+		return nil, err
+	}
+
+	rawSDJWT, disclosures, err := i.createSDJWT()
+	if err != nil {
+		return nil, err
+	}
+	signedJWT, err := sign(rawSDJWT, params, signingMethod, keyOf(signingKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SDJWT{
+		JWT:         signedJWT,
+		Disclosures: disclosures,
+	}, nil
+}
+
+// Header returns the decoded JOSE header of the SD-JWT
+func (s *SDJWT) Header() (map[string]any, error) {
+	encoded, _, ok := strings.Cut(s.JWT, ".")
+	if !ok {
+		return nil, ErrHeaderNotValid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrHeaderNotValid, err)
+	}
+	header := map[string]any{}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrHeaderNotValid, err)
+	}
+	return header, nil
+}
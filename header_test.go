@@ -0,0 +1,127 @@
+package gosdjwt
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSDJWTWithHeader(t *testing.T) {
+	pubKey, privKey, err := NewECDSAKeyPair(elliptic.P256())
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "issuer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pubKey, privKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+	}
+
+	tts := []struct {
+		name string
+		have Header
+		want map[string]any
+	}{
+		{
+			name: "test 0 - no parameters",
+			want: map[string]any{"alg": "ES256", "typ": "JWT"},
+		},
+		{
+			name: "test 1 - all parameters",
+			have: Header{
+				Type:       "example+sd-jwt",
+				KeyID:      "key-1",
+				X5C:        EncodeX5C(cert),
+				JWK:        map[string]any{"kty": "EC", "crv": "P-256"},
+				TrustChain: []string{"statement-1", "statement-2"},
+				Extra:      map[string]any{"iss": "https://example.com"},
+			},
+			want: map[string]any{
+				"alg":         "ES256",
+				"typ":         "example+sd-jwt",
+				"kid":         "key-1",
+				"x5c":         []any{EncodeX5C(cert)[0]},
+				"jwk":         map[string]any{"kty": "EC", "crv": "P-256"},
+				"trust_chain": []any{"statement-1", "statement-2"},
+				"iss":         "https://example.com",
+			},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			sdjwt, err := instructions.SDJWTWithHeader(tt.have, jwt.SigningMethodES256, privKey)
+			assert.NoError(t, err)
+
+			got, err := sdjwt.Header()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			assert.NoError(t, VerifySignature(sdjwt.JWT, "ES256", pubKey))
+		})
+	}
+}
+
+func TestSDJWTWithHeaderErrors(t *testing.T) {
+	tts := []struct {
+		name string
+		have Header
+	}{
+		{
+			name: "alg in extra",
+			have: Header{Extra: map[string]any{"alg": "none"}},
+		},
+		{
+			name: "kid in both field and extra",
+			have: Header{KeyID: "key-1", Extra: map[string]any{"kid": "key-2"}},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := InstructionsV2{}.SDJWTWithHeader(tt.have, jwt.SigningMethodHS256, "mura")
+			assert.ErrorIs(t, err, ErrHeaderParameterReserved)
+		})
+	}
+
+	for _, member := range jwkPrivateMembers {
+		t.Run("jwk with private member "+member, func(t *testing.T) {
+			jwk := map[string]any{"kty": "EC", "crv": "P-256", "x": "x", "y": "y", member: "secret"}
+			_, err := InstructionsV2{}.SDJWTWithHeader(Header{JWK: jwk}, jwt.SigningMethodHS256, "mura")
+			assert.ErrorIs(t, err, ErrHeaderJWKNotPublic)
+
+			_, err = InstructionsV2{}.SDJWTWithHeader(Header{Extra: map[string]any{"jwk": jwk}}, jwt.SigningMethodHS256, "mura")
+			assert.ErrorIs(t, err, ErrHeaderJWKNotPublic)
+		})
+	}
+
+	_, err := (&SDJWT{JWT: "not a jwt"}).Header()
+	assert.ErrorIs(t, err, ErrHeaderNotValid)
+}
+
+func TestSDJWTVCHeader(t *testing.T) {
+	vc := mockVC
+	vc.Header = Header{Type: "JWT", KeyID: "key-1"}
+
+	sdjwt, err := InstructionsV2{}.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	got, err := sdjwt.Header()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"alg": "HS256", "typ": TypeSDJWTVC, "kid": "key-1"}, got)
+}
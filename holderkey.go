@@ -0,0 +1,385 @@
+package gosdjwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TypeKeyBindingJWT is the typ header of a KB-JWT
+const TypeKeyBindingJWT = "kb+jwt"
+
+// DefaultKeyBindingMaxAge is how old the iat of a KB-JWT may be when Verifier.KeyBindingMaxAge is not set
+const DefaultKeyBindingMaxAge = 5 * time.Minute
+
+var (
+	// ErrHolderKeyNotFound is returned when a holder key is not in the store
+	ErrHolderKeyNotFound = errors.New("holder key is not found")
+
+	// ErrHolderKeyNotSupported is returned for a signing algorithm or key type holder keys do not support
+	ErrHolderKeyNotSupported = errors.New("holder key is not supported")
+
+	// ErrKeyBindingNotValid is returned when a presentation has no KB-JWT or its KB-JWT is not valid
+	ErrKeyBindingNotValid = errors.New("key binding JWT is not valid")
+)
+
+// HolderKey is a private key of a holder, the credentials bound to it have its public JWK in cnf
+type HolderKey struct {
+	ID string
+
+	// Alg is the JWS algorithm of the key, ES256, ES384, ES512 or EdDSA
+	Alg string
+
+	// Signer signs with the private key, which does not have to leave e.g. a hardware keystore
+	Signer crypto.Signer
+}
+
+// newHolderKey returns the holder key of signer with its JWS algorithm
+func newHolderKey(id string, signer crypto.Signer) (*HolderKey, error) {
+	alg, err := holderKeyAlg(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &HolderKey{ID: id, Alg: alg, Signer: signer}, nil
+}
+
+// holderKeyAlg returns the JWS algorithm of a public key
+func holderKeyAlg(pub crypto.PublicKey) (string, error) {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	}
+	return "", fmt.Errorf("%w: %T", ErrHolderKeyNotSupported, pub)
+}
+
+// generateHolderKey returns a new private key for the JWS algorithm alg
+func generateHolderKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrHolderKeyNotSupported, alg)
+}
+
+// PublicJWK returns the public key as a JWK
+func (k *HolderKey) PublicJWK() (map[string]any, error) {
+	return PublicJWK(k.Signer.Public())
+}
+
+// Confirmation returns the cnf claim that binds a credential to the key, e.g. for VC.Confirmation
+func (k *HolderKey) Confirmation() (map[string]any, error) {
+	jwk, err := k.PublicJWK()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"jwk": jwk}, nil
+}
+
+// KeyBindingJWT returns a KB-JWT for presentation, the SD-JWT with the disclosures to present ending with ~,
+// to the verifier aud with its nonce
+func (k *HolderKey) KeyBindingJWT(presentation, aud, nonce string, iat time.Time) (string, error) {
+	header := map[string]any{
+		"typ": TypeKeyBindingJWT,
+		"alg": k.Alg,
+	}
+	claims := map[string]any{
+		"iat":     iat.Unix(),
+		"aud":     aud,
+		"nonce":   nonce,
+		"sd_hash": hash(presentation),
+	}
+	return signJWS(header, claims, k.Alg, k.Signer)
+}
+
+// Present returns presentation followed by a KB-JWT for the verifier aud with its nonce
+func (k *HolderKey) Present(presentation, aud, nonce string) (string, error) {
+	if !strings.HasSuffix(presentation, "~") {
+		presentation += "~"
+	}
+	kb, err := k.KeyBindingJWT(presentation, aud, nonce, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return presentation + kb, nil
+}
+
+// VerifyKeyBindingJWT verifies the KB-JWT at the end of presentation with the holder key jwk, from the cnf of
+// the credential, and checks its typ, aud, nonce and the sd_hash of the presentation before it. iat may not be in
+// the future nor older than maxAge.
+func VerifyKeyBindingJWT(presentation string, jwk map[string]any, aud, nonce string, maxAge time.Duration) (jwt.MapClaims, error) {
+	i := strings.LastIndex(presentation, "~")
+	if i < 0 || i == len(presentation)-1 {
+		return nil, fmt.Errorf("%w: missing", ErrKeyBindingNotValid)
+	}
+	kb := presentation[i+1:]
+
+	key, err := ParseJWK(jwk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyBindingNotValid, err)
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(kb, claims, func(token *jwt.Token) (any, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{"ES256", "ES384", "ES512", "EdDSA"}), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyBindingNotValid, err)
+	}
+
+	if typ, _ := token.Header["typ"].(string); typ != TypeKeyBindingJWT {
+		return nil, fmt.Errorf("%w: typ %q", ErrKeyBindingNotValid, typ)
+	}
+	iat, ok := numericValue(claims["iat"])
+	if !ok {
+		return nil, fmt.Errorf("%w: iat", ErrKeyBindingNotValid)
+	}
+	if issued := time.Unix(int64(iat), 0); time.Since(issued) > maxAge {
+		return nil, fmt.Errorf("%w: iat %s is older than %s", ErrKeyBindingNotValid, issued.UTC().Format(time.RFC3339), maxAge)
+	}
+	if got, _ := claims["aud"].(string); got != aud {
+		return nil, fmt.Errorf("%w: aud %q", ErrKeyBindingNotValid, got)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%w: nonce %q", ErrKeyBindingNotValid, got)
+	}
+	if got, _ := claims["sd_hash"].(string); got != hash(presentation[:i+1]) {
+		return nil, fmt.Errorf("%w: sd_hash %q", ErrKeyBindingNotValid, got)
+	}
+	return claims, nil
+}
+
+// signJWS returns a compact JWS of header and claims signed by signer, with the JWS algorithm alg
+func signJWS(header, claims map[string]any, alg string, signer crypto.Signer) (string, error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	var signature []byte
+	switch alg {
+	case "ES256", "ES384", "ES512":
+		signature, err = signECDSA(signer, []byte(signingInput), alg)
+	case "EdDSA":
+		signature, err = signer.Sign(rand.Reader, []byte(signingInput), crypto.Hash(0))
+	default:
+		err = fmt.Errorf("%w: %s", ErrHolderKeyNotSupported, alg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// signECDSA signs message and returns the signature as r and s of the curve size, as JWS wants it
+func signECDSA(signer crypto.Signer, message []byte, alg string) ([]byte, error) {
+	hashes := map[string]crypto.Hash{"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512}
+	h := hashes[alg].New()
+	h.Write(message)
+
+	der, err := signer.Sign(rand.Reader, h.Sum(nil), hashes[alg])
+	if err != nil {
+		return nil, err
+	}
+	signature := struct{ R, S *big.Int }{}
+	if _, err := asn1.Unmarshal(der, &signature); err != nil {
+		return nil, err
+	}
+
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s with %T", ErrHolderKeyNotSupported, alg, signer.Public())
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	raw := make([]byte, 2*size)
+	signature.R.FillBytes(raw[:size])
+	signature.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// HolderKeyStore keeps the private keys of a holder. A new key for each credential keeps presentations of
+// different credentials from being linked by their cnf, see StoredCredential.HolderKeyID.
+type HolderKeyStore interface {
+	// Create generates a key for the JWS algorithm alg, ES256, ES384, ES512 or EdDSA
+	Create(ctx context.Context, alg string) (*HolderKey, error)
+
+	// Get returns the key with id, or ErrHolderKeyNotFound
+	Get(ctx context.Context, id string) (*HolderKey, error)
+
+	// Delete removes the key with id, or returns ErrHolderKeyNotFound
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryHolderKeyStore is a HolderKeyStore in memory, it is safe for concurrent use
+type MemoryHolderKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]crypto.Signer
+}
+
+// NewMemoryHolderKeyStore returns an empty store
+func NewMemoryHolderKeyStore() *MemoryHolderKeyStore {
+	return &MemoryHolderKeyStore{keys: map[string]crypto.Signer{}}
+}
+
+// Create generates a key
+func (s *MemoryHolderKeyStore) Create(ctx context.Context, alg string) (*HolderKey, error) {
+	signer, err := generateHolderKey(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := newUUID()
+	s.keys[id] = signer
+	return newHolderKey(id, signer)
+}
+
+// Get returns the key with id
+func (s *MemoryHolderKeyStore) Get(ctx context.Context, id string) (*HolderKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	signer, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrHolderKeyNotFound, id)
+	}
+	return newHolderKey(id, signer)
+}
+
+// Delete removes the key with id
+func (s *MemoryHolderKeyStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrHolderKeyNotFound, id)
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+// FileHolderKeyStore is a HolderKeyStore with one PEM encoded PKCS #8 private key file per key in a directory.
+// Files are written atomically and only readable by the owner. Keys are not stored as JWK files, the public JWK
+// is exported by HolderKey.PublicJWK.
+type FileHolderKeyStore struct {
+	dir string
+}
+
+// NewFileHolderKeyStore returns a store in dir, which is created if it does not exist
+func NewFileHolderKeyStore(dir string) (*FileHolderKeyStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileHolderKeyStore{dir: dir}, nil
+}
+
+func (s *FileHolderKeyStore) path(id string) (string, error) {
+	if !credentialIDPattern.MatchString(id) {
+		return "", fmt.Errorf("%w: %q", ErrHolderKeyNotFound, id)
+	}
+	return filepath.Join(s.dir, id+".pem"), nil
+}
+
+// Create generates a key and writes it to its file
+func (s *FileHolderKeyStore) Create(ctx context.Context, alg string) (*HolderKey, error) {
+	signer, err := generateHolderKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	id := newUUID()
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return newHolderKey(id, signer)
+}
+
+// Get reads the key with id
+func (s *FileHolderKeyStore) Get(ctx context.Context, id string) (*HolderKey, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrHolderKeyNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PRIVATE KEY PEM block", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrHolderKeyNotSupported, key)
+	}
+	return newHolderKey(id, signer)
+}
+
+// Delete removes the file of the key with id
+func (s *FileHolderKeyStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrHolderKeyNotFound, id)
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package gosdjwt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// httpGet returns the body of uri, at most limit bytes. Errors are not wrapped, callers wrap them in their own error.
+// client is http.DefaultClient if nil.
+func httpGet(ctx context.Context, client *http.Client, uri, accept string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", uri, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
@@ -1,33 +1,76 @@
 package gosdjwt
 
-// ParentInstructionV2 instructs how to build a SD-JWT
+import "github.com/golang-jwt/jwt/v5"
+
+// Instruction is implemented by all instructions that can be part of an instruction tree.
+// The interface is sealed, a new kind of instruction is added by implementing its methods in this package.
+type Instruction interface {
+	// makeSD adds the instruction to storage, either as a plain claim or as a digest in _sd
+	makeSD(storage jwt.MapClaims, disclosures DisclosuresV2) error
+
+	// makeRecursiveSD adds the instruction to storage as a child of a recursive parent, where it is
+	// selective disclosable unless it is always visible
+	makeRecursiveSD(storage jwt.MapClaims, disclosures DisclosuresV2) error
+
+	// makeElement returns the instruction as an element of an array, a selective disclosable element is returned as {"...": digest}
+	makeElement(disclosures DisclosuresV2) (any, error)
+
+	// validate adds the problems of the instruction, and its children, to v
+	validate(path string, index int, siblings map[string]bool, v *validator)
+
+	// name returns the claim name of the instruction, which is empty for array elements
+	name() string
+
+	// clone returns a deep copy of the instruction without hashes
+	clone() Instruction
+
+	// isSelectiveDisclosure reports whether the instruction is selective disclosable as a claim of an object
+	isSelectiveDisclosure() bool
+
+	// nested returns the children of an object, or the elements of an array in which case elements is true
+	nested() (children []Instruction, elements bool)
+
+	// flags returns the selective disclosure flags, which are nil for a recursive parent as it is always selective disclosable
+	flags() (selectiveDisclosure, alwaysVisible *bool)
+
+	// bind returns a copy of the instruction with its placeholders bound from value, false is returned if it
+	// should be left out. recursive is true for the children of a recursive parent.
+	bind(value boundValue, path string, recursive bool, v *validator) (Instruction, bool)
+}
+
+// ParentInstructionV2 instructs how to build a SD-JWT.
+// A selective disclosable parent is disclosed as one object, where each child keeps its own selective disclosure.
+// AlwaysVisible keeps the parent visible when it is a child of a recursive parent.
 type ParentInstructionV2 struct {
-	Name                string   `json:"name,omitempty" yaml:"name,omitempty"`
-	Children            []any    `json:"children,omitempty" yaml:"children,omitempty"`
-	SelectiveDisclosure bool     `json:"sd,omitempty" yaml:"sd,omitempty"`
-	Salt                string   `json:"salt,omitempty" yaml:"salt,omitempty"`
-	DisclosureHash      string   `json:"disclosure_hash,omitempty" yaml:"disclosure_hash,omitempty"`
-	ClaimHash           string   `json:"claim_hash,omitempty" yaml:"claim_hash,omitempty"`
-	ChildrenClaimHash   []string `json:"children_claim_hash,omitempty" yaml:"children_claim_hash,omitempty"`
+	Name                string        `json:"name,omitempty" yaml:"name,omitempty"`
+	Children            []Instruction `json:"children,omitempty" yaml:"children,omitempty"`
+	SelectiveDisclosure bool          `json:"sd,omitempty" yaml:"sd,omitempty"`
+	AlwaysVisible       bool          `json:"always_visible,omitempty" yaml:"always_visible,omitempty"`
+	Salt                string        `json:"salt,omitempty" yaml:"salt,omitempty"`
+	DisclosureHash      string        `json:"disclosure_hash,omitempty" yaml:"disclosure_hash,omitempty"`
+	ClaimHash           string        `json:"claim_hash,omitempty" yaml:"claim_hash,omitempty"`
+	ChildrenClaimHash   []string      `json:"children_claim_hash,omitempty" yaml:"children_claim_hash,omitempty"`
 }
 
-// RecursiveInstructionV2 instructs how to build a SD-JWT
+// RecursiveInstructionV2 instructs how to build a SD-JWT.
+// A recursive parent is disclosed as one object where every child is selective disclosable, unless the child is always visible.
 type RecursiveInstructionV2 struct {
-	Name                string   `json:"name,omitempty" yaml:"name,omitempty"`
-	Value               any      `json:"value,omitempty" yaml:"value,omitempty"`
-	Children            []any    `json:"children,omitempty" yaml:"children,omitempty"`
-	SelectiveDisclosure bool     `json:"sd,omitempty" yaml:"sd,omitempty"`
-	Salt                string   `json:"salt,omitempty" yaml:"salt,omitempty"`
-	DisclosureHash      string   `json:"disclosure_hash,omitempty" yaml:"disclosure_hash,omitempty"`
-	ClaimHash           string   `json:"claim_hash,omitempty" yaml:"claim_hash,omitempty"`
-	ChildrenClaimHash   []string `json:"children_claim_hash,omitempty" yaml:"children_claim_hash,omitempty"`
-	UID                 string   `json:"uid,omitempty" yaml:"uid,omitempty"`
-}
-
-// ChildInstructionV2 instructs how to build a SD-JWT
+	Name              string        `json:"name,omitempty" yaml:"name,omitempty"`
+	Value             any           `json:"value,omitempty" yaml:"value,omitempty"`
+	Children          []Instruction `json:"children,omitempty" yaml:"children,omitempty"`
+	Salt              string        `json:"salt,omitempty" yaml:"salt,omitempty"`
+	DisclosureHash    string        `json:"disclosure_hash,omitempty" yaml:"disclosure_hash,omitempty"`
+	ClaimHash         string        `json:"claim_hash,omitempty" yaml:"claim_hash,omitempty"`
+	ChildrenClaimHash []string      `json:"children_claim_hash,omitempty" yaml:"children_claim_hash,omitempty"`
+	UID               string        `json:"uid,omitempty" yaml:"uid,omitempty"`
+}
+
+// ChildInstructionV2 instructs how to build a SD-JWT.
+// AlwaysVisible keeps the child visible when it is a child of a recursive parent.
 type ChildInstructionV2 struct {
 	Name                string `json:"name,omitempty" yaml:"name,omitempty"`
 	SelectiveDisclosure bool   `json:"sd,omitempty" yaml:"sd,omitempty"`
+	AlwaysVisible       bool   `json:"always_visible,omitempty" yaml:"always_visible,omitempty"`
 	Salt                string `json:"salt,omitempty" yaml:"salt,omitempty"`
 	Value               any    `json:"value,omitempty" yaml:"value,omitempty"`
 	DisclosureHash      string `json:"disclosure_hash,omitempty" yaml:"disclosure_hash,omitempty"`
@@ -35,16 +78,87 @@ type ChildInstructionV2 struct {
 	UID                 string `json:"uid,omitempty" yaml:"uid,omitempty"`
 }
 
-// ChildArrayInstructionV2 is a child with slice values
+// ChildArrayInstructionV2 is a child with slice values.
+// Each element is an instruction without a name, objects and arrays are allowed as elements.
+// A selective disclosable array is disclosed as one claim, where each element keeps its own selective disclosure.
+// AlwaysVisible keeps the array visible when it is a child of a recursive parent.
 type ChildArrayInstructionV2 struct {
-	Name                string               `json:"name,omitempty" yaml:"name,omitempty"`
-	Children            []ChildInstructionV2 `json:"children,omitempty" yaml:"children,omitempty"`
-	SelectiveDisclosure bool                 `json:"sd,omitempty" yaml:"sd,omitempty"`
-	Salt                string               `json:"salt,omitempty" yaml:"salt,omitempty"`
-	Value               []any                `json:"value,omitempty" yaml:"value,omitempty"`
-	DisclosureHash      string               `json:"disclosure_hash,omitempty" yaml:"disclosure_hash,omitempty"`
-	ClaimHash           string               `json:"claim_hash,omitempty" yaml:"claim_hash,omitempty"`
+	Name                string        `json:"name,omitempty" yaml:"name,omitempty"`
+	Children            []Instruction `json:"children,omitempty" yaml:"children,omitempty"`
+	SelectiveDisclosure bool          `json:"sd,omitempty" yaml:"sd,omitempty"`
+	AlwaysVisible       bool          `json:"always_visible,omitempty" yaml:"always_visible,omitempty"`
+	Salt                string        `json:"salt,omitempty" yaml:"salt,omitempty"`
+	DisclosureHash      string        `json:"disclosure_hash,omitempty" yaml:"disclosure_hash,omitempty"`
+	ClaimHash           string        `json:"claim_hash,omitempty" yaml:"claim_hash,omitempty"`
 }
 
 // InstructionsV2 is a list of instructions
-type InstructionsV2 []any
+type InstructionsV2 []Instruction
+
+func (p *ParentInstructionV2) name() string     { return p.Name }
+func (r *RecursiveInstructionV2) name() string  { return r.Name }
+func (c *ChildInstructionV2) name() string      { return c.Name }
+func (c *ChildArrayInstructionV2) name() string { return c.Name }
+
+func (p *ParentInstructionV2) clone() Instruction {
+	return &ParentInstructionV2{
+		Name:                p.Name,
+		SelectiveDisclosure: p.SelectiveDisclosure,
+		AlwaysVisible:       p.AlwaysVisible,
+		Children:            cloneInstructions(p.Children),
+	}
+}
+
+func (r *RecursiveInstructionV2) clone() Instruction {
+	return &RecursiveInstructionV2{
+		Name:     r.Name,
+		Value:    r.Value,
+		UID:      r.UID,
+		Children: cloneInstructions(r.Children),
+	}
+}
+
+func (c *ChildInstructionV2) clone() Instruction {
+	return &ChildInstructionV2{
+		Name:                c.Name,
+		SelectiveDisclosure: c.SelectiveDisclosure,
+		AlwaysVisible:       c.AlwaysVisible,
+		Value:               c.Value,
+		UID:                 c.UID,
+	}
+}
+
+func (c *ChildArrayInstructionV2) clone() Instruction {
+	return &ChildArrayInstructionV2{
+		Name:                c.Name,
+		SelectiveDisclosure: c.SelectiveDisclosure,
+		AlwaysVisible:       c.AlwaysVisible,
+		Children:            cloneInstructions(c.Children),
+	}
+}
+
+func (p *ParentInstructionV2) isSelectiveDisclosure() bool     { return p.SelectiveDisclosure }
+func (r *RecursiveInstructionV2) isSelectiveDisclosure() bool  { return true }
+func (c *ChildInstructionV2) isSelectiveDisclosure() bool      { return c.SelectiveDisclosure }
+func (c *ChildArrayInstructionV2) isSelectiveDisclosure() bool { return c.SelectiveDisclosure }
+
+func (p *ParentInstructionV2) nested() ([]Instruction, bool)     { return p.Children, false }
+func (r *RecursiveInstructionV2) nested() ([]Instruction, bool)  { return r.Children, false }
+func (c *ChildInstructionV2) nested() ([]Instruction, bool)      { return nil, false }
+func (c *ChildArrayInstructionV2) nested() ([]Instruction, bool) { return c.Children, true }
+
+func (p *ParentInstructionV2) flags() (*bool, *bool) {
+	return &p.SelectiveDisclosure, &p.AlwaysVisible
+}
+
+func (r *RecursiveInstructionV2) flags() (*bool, *bool) {
+	return nil, nil
+}
+
+func (c *ChildInstructionV2) flags() (*bool, *bool) {
+	return &c.SelectiveDisclosure, &c.AlwaysVisible
+}
+
+func (c *ChildArrayInstructionV2) flags() (*bool, *bool) {
+	return &c.SelectiveDisclosure, &c.AlwaysVisible
+}
@@ -3,7 +3,6 @@ package gosdjwt
 import (
 	"crypto/sha256"
 	"encoding/base64"
-	"fmt"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -45,6 +44,9 @@ type DefaultClaims struct {
 //	return a
 //}
 
+// SDAlgSHA256 is the _sd_alg of the digests of disclosures, it is the only supported hash algorithm
+const SDAlgSHA256 = "sha-256"
+
 // SDJWT is a sd-jwt
 type SDJWT struct {
 	JWT         string
@@ -150,10 +152,10 @@ func newUUID() string {
 // Instructions is a slice of instructions
 //type Instructions []*Instruction
 
-func hash(disclosureHash string) string {
-	sha256Encoded := fmt.Sprintf("%x", sha256.Sum256([]byte(disclosureHash)))
-
-	return base64.RawURLEncoding.EncodeToString([]byte(sha256Encoded))
+// hash returns the base64url encoded SHA-256 digest of s, the digest of _sd_alg sha-256
+func hash(s string) string {
+	digest := sha256.Sum256([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
 }
 
 func addToArray(key string, value any, storage jwt.MapClaims) {
@@ -237,40 +239,24 @@ func addToArray(key string, value any, storage jwt.MapClaims) {
 //}
 
 func (i InstructionsV2) createSDJWT() (jwt.MapClaims, DisclosuresV2, error) {
+	if err := i.Validate(); err != nil {
+		return nil, nil, err
+	}
 	storage := jwt.MapClaims{}
 	disclosures := DisclosuresV2{}
 	if err := makeSDV2(i, storage, disclosures); err != nil {
 		return nil, nil, err
 	}
+	storage["_sd_alg"] = SDAlgSHA256
 	return storage, disclosures, nil
 }
 
-// MergeInstructions merge two instructions, a and b where a has precedence
-// Can be used to achieve a default instruction set within an implementation
-//func MergeInstructions(a, b Instructions) Instructions {
-//	for _, v := range a {
-//		for i, vv := range b {
-//			if v.Name == vv.Name {
-//				b[i] = b[len(b)-1]
-//				b = b[:len(b)-1]
-//			}
-//		}
-//	}
-//
-//	return append(a, b...)
-//}
-
-func sign(claims jwt.MapClaims, signingMethod jwt.SigningMethod, signingKey any) (string, error) {
-	//if c.config.SigningMethod == nil {
-	//	c.config.SigningMethod = jwt.SigningMethodHS256
-	//}
+// sign signs the claims, header is added to the JOSE header of the token
+func sign(claims jwt.MapClaims, header map[string]any, signingMethod jwt.SigningMethod, signingKey any) (string, error) {
 	token := jwt.NewWithClaims(signingMethod, claims)
-
-	//	if c.config.JWTType == "" {
-	//		token.Header["typ"] = "sd-jwt"
-	//	} else {
-	//		token.Header["typ"] = c.config.JWTType
-	//	}
+	for k, v := range header {
+		token.Header[k] = v
+	}
 
 	return token.SignedString(signingKey)
 }
@@ -282,7 +268,7 @@ func (i InstructionsV2) SDJWT(signingMethod jwt.SigningMethod, signingKey string
 	if err != nil {
 		return nil, err
 	}
-	signedJWT, err := sign(rawSDJWT, signingMethod, []byte(signingKey))
+	signedJWT, err := sign(rawSDJWT, nil, signingMethod, []byte(signingKey))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,259 @@
+package gosdjwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwtVCIssuerWellKnown is inserted between the host and the path of the issuer to get its metadata URL
+	jwtVCIssuerWellKnown = "/.well-known/jwt-vc-issuer"
+
+	// DefaultIssuerKeysTTL is how long the keys of an issuer are cached if JWTVCIssuerResolver.TTL is zero
+	DefaultIssuerKeysTTL = time.Hour
+
+	// maxMetadataSize limits the size of fetched metadata
+	maxMetadataSize = 1 << 20
+)
+
+var (
+	// ErrIssuerMetadataFetch is returned when the JWT VC issuer metadata or its jwks_uri can not be fetched
+	ErrIssuerMetadataFetch = errors.New("JWT VC issuer metadata can not be fetched")
+
+	// ErrIssuerMetadataNotValid is returned when the JWT VC issuer metadata does not match the issuer
+	ErrIssuerMetadataNotValid = errors.New("JWT VC issuer metadata is not valid")
+
+	// ErrKeyNotFound is returned when no key of the issuer matches the JWT
+	ErrKeyNotFound = errors.New("key is not found")
+)
+
+// KeyResolver returns the key that verifies a JWT, from its header and unverified claims
+type KeyResolver interface {
+	ResolveKey(ctx context.Context, header map[string]any, claims map[string]any) (any, error)
+}
+
+// JWKS is a JWK set
+type JWKS struct {
+	Keys []map[string]any `json:"keys"`
+}
+
+// JWTVCIssuerMetadata is the metadata an issuer publishes at /.well-known/jwt-vc-issuer, with either JWKS or JWKSURI
+type JWTVCIssuerMetadata struct {
+	Issuer  string `json:"issuer"`
+	JWKS    *JWKS  `json:"jwks,omitempty"`
+	JWKSURI string `json:"jwks_uri,omitempty"`
+}
+
+// JWTVCIssuerMetadataURL returns the metadata URL of issuer, e.g. https://example.com/tenant/1 has its
+// metadata at https://example.com/.well-known/jwt-vc-issuer/tenant/1
+func JWTVCIssuerMetadataURL(issuer string) (string, error) {
+	u, err := httpsURL(issuer)
+	if err != nil {
+		return "", fmt.Errorf("%w: iss: %s", ErrIssuerMetadataNotValid, err)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("%w: iss has a query or fragment: %s", ErrIssuerMetadataNotValid, issuer)
+	}
+	u.Path = jwtVCIssuerWellKnown + strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// httpsURL parses an absolute https URL
+func httpsURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("not an https URL: %s", s)
+	}
+	return u, nil
+}
+
+// cachedIssuerKeys are the keys of an issuer and when they have to be fetched again
+type cachedIssuerKeys struct {
+	keys    []map[string]any
+	expires time.Time
+}
+
+// JWTVCIssuerResolver is a KeyResolver that finds the key of a SD-JWT VC in the JWT VC issuer metadata of its iss.
+// The key is matched by the kid header, a JWT without kid is accepted if the issuer has a single key.
+// Keys are cached for TTL, and fetched again when no cached key matches the kid. It is safe for concurrent use,
+// the zero value is ready to use.
+type JWTVCIssuerResolver struct {
+	// Client is used for the requests, http.DefaultClient is used if nil
+	Client *http.Client
+
+	// TTL is how long the keys of an issuer are cached, DefaultIssuerKeysTTL is used if zero
+	TTL time.Duration
+
+	now   func() time.Time
+	mu    sync.Mutex
+	cache map[string]cachedIssuerKeys
+}
+
+// NewJWTVCIssuerResolver returns a resolver that fetches metadata with client
+func NewJWTVCIssuerResolver(client *http.Client) *JWTVCIssuerResolver {
+	return &JWTVCIssuerResolver{
+		Client: client,
+		now:    time.Now,
+		cache:  map[string]cachedIssuerKeys{},
+	}
+}
+
+// ResolveKey returns the public key of the iss claim that matches the kid and alg of header
+func (r *JWTVCIssuerResolver) ResolveKey(ctx context.Context, header map[string]any, claims map[string]any) (any, error) {
+	issuer, ok := claims["iss"].(string)
+	if !ok || issuer == "" {
+		return nil, fmt.Errorf("%w: iss", ErrVCClaimMissing)
+	}
+	kid, _ := header["kid"].(string)
+	alg, _ := header["alg"].(string)
+
+	keys, cached, err := r.keys(ctx, issuer, false)
+	if err != nil {
+		return nil, err
+	}
+	key, err := selectJWK(keys, kid, alg)
+	if errors.Is(err, ErrKeyNotFound) && cached {
+		// the issuer might have rotated its keys
+		if keys, _, err = r.keys(ctx, issuer, true); err != nil {
+			return nil, err
+		}
+		key, err = selectJWK(keys, kid, alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, issuer)
+	}
+	return key, nil
+}
+
+// clock returns the current time
+func (r *JWTVCIssuerResolver) clock() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
+
+// keys returns the keys of issuer and if they came from the cache, refresh skips the cache
+func (r *JWTVCIssuerResolver) keys(ctx context.Context, issuer string, refresh bool) ([]map[string]any, bool, error) {
+	now := r.clock()
+
+	r.mu.Lock()
+	cached, ok := r.cache[issuer]
+	r.mu.Unlock()
+	if ok && !refresh && now.Before(cached.expires) {
+		return cached.keys, true, nil
+	}
+
+	metadata, err := r.Metadata(ctx, issuer)
+	if err != nil {
+		return nil, false, err
+	}
+
+	jwks := metadata.JWKS
+	if metadata.JWKSURI != "" {
+		if _, err := httpsURL(metadata.JWKSURI); err != nil {
+			return nil, false, fmt.Errorf("%w: jwks_uri: %s", ErrIssuerMetadataNotValid, err)
+		}
+		jwks = &JWKS{}
+		if err := r.fetch(ctx, metadata.JWKSURI, jwks); err != nil {
+			return nil, false, err
+		}
+	}
+
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = DefaultIssuerKeysTTL
+	}
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = map[string]cachedIssuerKeys{}
+	}
+	r.cache[issuer] = cachedIssuerKeys{keys: jwks.Keys, expires: now.Add(ttl)}
+	r.mu.Unlock()
+
+	return jwks.Keys, false, nil
+}
+
+// Metadata fetches the JWT VC issuer metadata of issuer
+func (r *JWTVCIssuerResolver) Metadata(ctx context.Context, issuer string) (*JWTVCIssuerMetadata, error) {
+	uri, err := JWTVCIssuerMetadataURL(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &JWTVCIssuerMetadata{}
+	if err := r.fetch(ctx, uri, metadata); err != nil {
+		return nil, err
+	}
+
+	if metadata.Issuer != issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrIssuerMetadataNotValid, metadata.Issuer, issuer)
+	}
+	if (metadata.JWKS == nil) == (metadata.JWKSURI == "") {
+		return nil, fmt.Errorf("%w: exactly one of jwks and jwks_uri is required", ErrIssuerMetadataNotValid)
+	}
+	return metadata, nil
+}
+
+// fetch decodes the JSON document at uri into v
+func (r *JWTVCIssuerResolver) fetch(ctx context.Context, uri string, v any) error {
+	b, err := httpGet(ctx, r.Client, uri, "application/json", maxMetadataSize)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrIssuerMetadataFetch, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrIssuerMetadataNotValid, uri, err)
+	}
+	return nil
+}
+
+// selectJWK returns the public key of the JWK with kid, or of the only JWK if kid is empty.
+// Encryption keys and keys for another alg are skipped.
+func selectJWK(keys []map[string]any, kid, alg string) (any, error) {
+	candidates := []map[string]any{}
+	for _, jwk := range keys {
+		if use, _ := jwk["use"].(string); use == "enc" {
+			continue
+		}
+		if jwkAlg, _ := jwk["alg"].(string); jwkAlg != "" && jwkAlg != alg {
+			continue
+		}
+		if jwkKid, _ := jwk["kid"].(string); kid != "" && jwkKid != kid {
+			continue
+		}
+		candidates = append(candidates, jwk)
+	}
+
+	switch {
+	case len(candidates) == 0 && kid != "":
+		return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+	case len(candidates) == 0:
+		return nil, ErrKeyNotFound
+	case len(candidates) > 1:
+		return nil, fmt.Errorf("%w: several keys match kid %q", ErrKeyNotFound, kid)
+	}
+	return ParseJWK(candidates[0])
+}
+
+// resolveKey returns the key of the SD-JWT from resolver, before its signature is verified
+func resolveKey(ctx context.Context, resolver KeyResolver, sdjwt string) (any, error) {
+	claims := jwt.MapClaims{}
+	token, _, err := jwt.NewParser().ParseUnverified(splitSDJWT(sdjwt).JWT, claims)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.ResolveKey(ctx, token.Header, claims)
+}
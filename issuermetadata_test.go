@@ -0,0 +1,254 @@
+package gosdjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIssuer publishes JWT VC issuer metadata for the issuer <server>/tenant
+type mockIssuer struct {
+	*httptest.Server
+	requests atomic.Int32
+	metadata func(issuer string) any
+	jwks     any
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	m := &mockIssuer{}
+	m.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.requests.Add(1)
+		var v any
+		switch r.URL.Path {
+		case "/.well-known/jwt-vc-issuer/tenant":
+			v = m.metadata(m.URL + "/tenant")
+		case "/jwks":
+			v = m.jwks
+		}
+		if v == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(v))
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func mockIssuerKey(t *testing.T, kid string) (*ecdsa.PrivateKey, map[string]any) {
+	pubKey, privKey, err := NewECDSAKeyPair(elliptic.P256())
+	assert.NoError(t, err)
+	jwk, err := PublicJWK(pubKey)
+	assert.NoError(t, err)
+	jwk["kid"] = kid
+	return privKey, jwk
+}
+
+func TestJWTVCIssuerMetadataURL(t *testing.T) {
+	tts := []struct {
+		name string
+		have string
+		want string
+		err  error
+	}{
+		{name: "test 0 - host", have: "https://example.com", want: "https://example.com/.well-known/jwt-vc-issuer"},
+		{name: "test 1 - path", have: "https://example.com/tenant/1234", want: "https://example.com/.well-known/jwt-vc-issuer/tenant/1234"},
+		{name: "test 2 - trailing slash", have: "https://example.com/tenant/", want: "https://example.com/.well-known/jwt-vc-issuer/tenant"},
+		{name: "test 3 - http", have: "http://example.com", err: ErrIssuerMetadataNotValid},
+		{name: "test 4 - query", have: "https://example.com?tenant=1", err: ErrIssuerMetadataNotValid},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JWTVCIssuerMetadataURL(tt.have)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestJWTVCIssuerResolver(t *testing.T) {
+	privKey, jwk := mockIssuerKey(t, "key-1")
+	_, otherJWK := mockIssuerKey(t, "key-2")
+
+	tts := []struct {
+		name     string
+		metadata func(m *mockIssuer, issuer string) any
+		jwks     any
+		kid      string
+		want     error
+	}{
+		{
+			name: "test 0 - jwks",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return JWTVCIssuerMetadata{Issuer: issuer, JWKS: &JWKS{Keys: []map[string]any{otherJWK, jwk}}}
+			},
+			kid: "key-1",
+		},
+		{
+			name: "test 1 - jwks_uri",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return JWTVCIssuerMetadata{Issuer: issuer, JWKSURI: m.URL + "/jwks"}
+			},
+			jwks: JWKS{Keys: []map[string]any{jwk, otherJWK}},
+			kid:  "key-1",
+		},
+		{
+			name: "test 2 - single key without kid",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return JWTVCIssuerMetadata{Issuer: issuer, JWKS: &JWKS{Keys: []map[string]any{jwk}}}
+			},
+		},
+		{
+			name: "test 3 - several keys without kid",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return JWTVCIssuerMetadata{Issuer: issuer, JWKS: &JWKS{Keys: []map[string]any{jwk, otherJWK}}}
+			},
+			want: ErrKeyNotFound,
+		},
+		{
+			name: "test 4 - unknown kid",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return JWTVCIssuerMetadata{Issuer: issuer, JWKS: &JWKS{Keys: []map[string]any{otherJWK}}}
+			},
+			kid:  "key-1",
+			want: ErrKeyNotFound,
+		},
+		{
+			name: "test 5 - signed with another key with the same kid",
+			metadata: func(m *mockIssuer, issuer string) any {
+				impostor := map[string]any{}
+				for k, v := range otherJWK {
+					impostor[k] = v
+				}
+				impostor["kid"] = "key-1"
+				return JWTVCIssuerMetadata{Issuer: issuer, JWKS: &JWKS{Keys: []map[string]any{impostor}}}
+			},
+			kid:  "key-1",
+			want: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name: "test 6 - issuer does not match",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return JWTVCIssuerMetadata{Issuer: m.URL, JWKS: &JWKS{Keys: []map[string]any{jwk}}}
+			},
+			kid:  "key-1",
+			want: ErrIssuerMetadataNotValid,
+		},
+		{
+			name: "test 7 - both jwks and jwks_uri",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return JWTVCIssuerMetadata{Issuer: issuer, JWKS: &JWKS{Keys: []map[string]any{jwk}}, JWKSURI: m.URL + "/jwks"}
+			},
+			kid:  "key-1",
+			want: ErrIssuerMetadataNotValid,
+		},
+		{
+			name: "test 8 - jwks_uri not found",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return JWTVCIssuerMetadata{Issuer: issuer, JWKSURI: m.URL + "/jwks"}
+			},
+			kid:  "key-1",
+			want: ErrIssuerMetadataFetch,
+		},
+		{
+			name: "test 9 - no metadata",
+			metadata: func(m *mockIssuer, issuer string) any {
+				return nil
+			},
+			kid:  "key-1",
+			want: ErrIssuerMetadataFetch,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIssuer(t)
+			m.metadata = func(issuer string) any { return tt.metadata(m, issuer) }
+			m.jwks = tt.jwks
+
+			vc := VC{VCT: mockVC.VCT, Issuer: m.URL + "/tenant", Header: Header{KeyID: tt.kid}}
+			sdjwt, err := InstructionsV2{}.SDJWTVC(vc, jwt.SigningMethodES256, privKey)
+			assert.NoError(t, err)
+
+			verifier := &Verifier{VC: true, KeyResolver: NewJWTVCIssuerResolver(m.Client())}
+			claims, validation, err := verifier.Verify(context.Background(), mockVCPresentation(sdjwt))
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, validation.Verify)
+			assert.Equal(t, vc.Issuer, claims["iss"])
+		})
+	}
+}
+
+func TestJWTVCIssuerResolverCache(t *testing.T) {
+	privKey, jwk := mockIssuerKey(t, "key-1")
+	rotatedKey, rotatedJWK := mockIssuerKey(t, "key-2")
+
+	m := newMockIssuer(t)
+	keys := []map[string]any{jwk}
+	m.metadata = func(issuer string) any {
+		return JWTVCIssuerMetadata{Issuer: issuer, JWKS: &JWKS{Keys: keys}}
+	}
+
+	resolver := NewJWTVCIssuerResolver(m.Client())
+	resolver.TTL = time.Minute
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+	verifier := &Verifier{VC: true, KeyResolver: resolver}
+
+	verify := func(key *ecdsa.PrivateKey, kid string) {
+		vc := VC{VCT: mockVC.VCT, Issuer: m.URL + "/tenant", Header: Header{KeyID: kid}}
+		sdjwt, err := InstructionsV2{}.SDJWTVC(vc, jwt.SigningMethodES256, key)
+		assert.NoError(t, err)
+		_, _, err = verifier.Verify(context.Background(), mockVCPresentation(sdjwt))
+		assert.NoError(t, err)
+	}
+
+	verify(privKey, "key-1")
+	verify(privKey, "key-1")
+	assert.Equal(t, int32(1), m.requests.Load(), "cached")
+
+	now = now.Add(2 * time.Minute)
+	verify(privKey, "key-1")
+	assert.Equal(t, int32(2), m.requests.Load(), "expired")
+
+	keys = []map[string]any{jwk, rotatedJWK}
+	verify(rotatedKey, "key-2")
+	assert.Equal(t, int32(3), m.requests.Load(), "unknown kid fetches again")
+}
+
+func TestJWTVCIssuerResolverZeroValue(t *testing.T) {
+	privKey, jwk := mockIssuerKey(t, "key-1")
+
+	m := newMockIssuer(t)
+	m.metadata = func(issuer string) any {
+		return JWTVCIssuerMetadata{Issuer: issuer, JWKS: &JWKS{Keys: []map[string]any{jwk}}}
+	}
+
+	resolver := &JWTVCIssuerResolver{Client: m.Client()}
+	verifier := &Verifier{VC: true, KeyResolver: resolver}
+
+	vc := VC{VCT: mockVC.VCT, Issuer: m.URL + "/tenant", Header: Header{KeyID: "key-1"}}
+	sdjwt, err := InstructionsV2{}.SDJWTVC(vc, jwt.SigningMethodES256, privKey)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, _, err = verifier.Verify(context.Background(), mockVCPresentation(sdjwt))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), m.requests.Load())
+}
@@ -1,6 +1,7 @@
 package gosdjwt
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -17,86 +18,54 @@ var (
 	ErrValueAndChildrenPresent = fmt.Errorf("value and children present")
 )
 
-func (c *ChildInstructionV2) makeClaimHash() {
-	c.Salt = newSalt()
-	s := fmt.Sprintf("[%q,%q,%q]", c.Salt, c.Name, c.Value)
-	c.DisclosureHash = base64.RawURLEncoding.EncodeToString([]byte(s))
-	c.ClaimHash = hash(c.DisclosureHash)
+// encodeDisclosure returns the salt, the base64url encoded disclosure [salt, name, value] of an object member and its digest
+func encodeDisclosure(name string, value any) (string, string, string, error) {
+	salt := newSalt()
+	disclosureHash, claimHash, err := encodeDisclosureArray([]any{salt, name, value})
+	return salt, disclosureHash, claimHash, err
 }
 
-func (r *RecursiveInstructionV2) makeClaimHash() error {
-	r.Salt = newSalt()
-
-	childClaims := map[string][]string{
-		"_sd": r.ChildrenClaimHash,
-	}
-
-	j, err := json.Marshal(childClaims)
-	if err != nil {
-		return err
-	}
-
-	s := fmt.Sprintf("[%q,%q,%s]", r.Salt, r.Name, string(j))
-	r.DisclosureHash = base64.RawURLEncoding.EncodeToString([]byte(s))
-	r.ClaimHash = hash(r.DisclosureHash)
-
-	return nil
+// encodeElementDisclosure returns the salt, the base64url encoded disclosure [salt, value] of an array element and its digest
+func encodeElementDisclosure(value any) (string, string, string, error) {
+	salt := newSalt()
+	disclosureHash, claimHash, err := encodeDisclosureArray([]any{salt, value})
+	return salt, disclosureHash, claimHash, err
 }
 
-func (p *ParentInstructionV2) makeClaimHash() error {
-	p.Salt = newSalt()
-	childrenClaims, err := claimStringRepresentation(p.Children)
-	if err != nil {
-		return err
+func encodeDisclosureArray(disclosure []any) (string, string, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(disclosure); err != nil {
+		return "", "", err
 	}
-	s := fmt.Sprintf("[%q,%q,%s]", p.Salt, p.Name, childrenClaims)
-	p.DisclosureHash = base64.RawURLEncoding.EncodeToString([]byte(s))
-	p.ClaimHash = hash(p.DisclosureHash)
 
-	return nil
+	disclosureHash := base64.RawURLEncoding.EncodeToString(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return disclosureHash, hash(disclosureHash), nil
 }
 
-//func (c *ChildArrayInstructionV2) makeClaimHash() {
-//	c.Salt = newSalt()
-//	s := fmt.Sprintf("[%q,%q]", c.Salt, c.Name)
-//	c.DisclosureHash = base64.RawURLEncoding.EncodeToString([]byte(s))
-//	c.ClaimHash = hash(c.DisclosureHash)
-//}
-
-func (r *RecursiveInstructionV2) recursiveHashClaim(claimHashes []string) error {
-	// make claimHash of children claimHashes
-	r.Salt = newSalt()
-	childrenClaims := map[string][]string{
-		"_sd": claimHashes,
-	}
-
-	b, err := json.Marshal(childrenClaims)
-	if err != nil {
-		return err
-	}
-	s := fmt.Sprintf("[%q,%q,%s]", r.Salt, r.Name, string(b))
-	r.DisclosureHash = base64.RawURLEncoding.EncodeToString([]byte(s))
-	r.ClaimHash = hash(r.DisclosureHash)
+func (c *ChildInstructionV2) makeClaimHash() error {
+	var err error
+	c.Salt, c.DisclosureHash, c.ClaimHash, err = encodeDisclosure(c.Name, c.Value)
+	return err
+}
 
-	return nil
+func (r *RecursiveInstructionV2) makeClaimHash(value jwt.MapClaims) error {
+	var err error
+	r.Salt, r.DisclosureHash, r.ClaimHash, err = encodeDisclosure(r.Name, value)
+	return err
 }
 
-func claimStringRepresentation(children []any) (string, error) {
-	stringClaims := map[string]any{}
-	for _, child := range children {
-		switch claim := child.(type) {
-		case *ChildInstructionV2:
-			stringClaims[claim.Name] = claim.Value
-		default:
-			return "", ErrNotKnownInstruction
-		}
-	}
+func (p *ParentInstructionV2) makeClaimHash(value jwt.MapClaims) error {
+	var err error
+	p.Salt, p.DisclosureHash, p.ClaimHash, err = encodeDisclosure(p.Name, value)
+	return err
+}
 
-	d, err := json.Marshal(stringClaims)
-	if err != nil {
-		return "", err
-	}
-	return string(d), nil
+func (c *ChildArrayInstructionV2) makeClaimHash(value []any) error {
+	var err error
+	c.Salt, c.DisclosureHash, c.ClaimHash, err = encodeDisclosure(c.Name, value)
+	return err
 }
 
 func (c *ChildInstructionV2) addToDisclosures(d DisclosuresV2) {
@@ -105,38 +74,37 @@ func (c *ChildInstructionV2) addToDisclosures(d DisclosuresV2) {
 		value:          c.Value,
 		name:           c.Name,
 		disclosureHash: c.DisclosureHash,
+		claimHash:      c.ClaimHash,
 	}
 }
 
-func (p *ParentInstructionV2) addToDisclosures(d DisclosuresV2) {
-	values := map[string]any{}
-	collectChildrenValues(p.Children, values)
+func (p *ParentInstructionV2) addToDisclosures(d DisclosuresV2, value jwt.MapClaims) {
 	d[newUUID()] = Disclosure{
 		salt:           p.Salt,
-		value:          values,
+		value:          value,
 		name:           p.Name,
 		disclosureHash: p.DisclosureHash,
+		claimHash:      p.ClaimHash,
 	}
 }
 
-//func (c *ChildArrayInstructionV2) addToDisclosures(d DisclosuresV2) {
-//	values := []any{}
-//	for _, child := range c.Children {
-//		values = append(values, child.Value)
-//	}
-//	d[newUUID()] = Disclosure{
-//		salt:           c.Salt,
-//		value:          values,
-//		name:           c.Name,
-//		disclosureHash: c.DisclosureHash,
-//	}
-//}
+func (c *ChildArrayInstructionV2) addToDisclosures(d DisclosuresV2, value []any) {
+	d[newUUID()] = Disclosure{
+		salt:           c.Salt,
+		value:          value,
+		name:           c.Name,
+		disclosureHash: c.DisclosureHash,
+		claimHash:      c.ClaimHash,
+	}
+}
 
-func (r *RecursiveInstructionV2) addToDisclosures(d DisclosuresV2) {
+func (r *RecursiveInstructionV2) addToDisclosures(d DisclosuresV2, value jwt.MapClaims) {
 	d[newUUID()] = Disclosure{
 		salt:           r.Salt,
+		value:          value,
 		name:           r.Name,
 		disclosureHash: r.DisclosureHash,
+		claimHash:      r.ClaimHash,
 	}
 }
 
@@ -150,139 +118,238 @@ func (d DisclosuresV2) ArrayHashes() []string {
 	return a
 }
 
-func collectChildrenValues(children []any, storage map[string]any) {
-	for _, child := range children {
-		switch claim := child.(type) {
-		case *ChildInstructionV2:
-			storage[claim.Name] = claim.Value
-		case ChildArrayInstructionV2:
-		case *ParentInstructionV2:
-			storage[claim.Name] = jwt.MapClaims{}
-			collectChildrenValues(claim.Children, storage)
+// digests returns the digests in the _sd claim of an object
+func digests(claims jwt.MapClaims) []string {
+	d := []string{}
+	values, _ := claims["_sd"].([]any)
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			d = append(d, s)
 		}
 	}
+	return d
 }
 
-func addUID(instruction any) {
-	switch ins := instruction.(type) {
-	case *RecursiveInstructionV2:
-		if ins.UID == "" {
-			ins.UID = newUUID()
+// recursiveClaimHandler builds the object disclosed by a recursive parent, where every child is selective disclosable
+func recursiveClaimHandler(instructions []Instruction, parent *RecursiveInstructionV2, disclosures DisclosuresV2) (jwt.MapClaims, error) {
+	storage := jwt.MapClaims{}
+	for _, instruction := range instructions {
+		if isNilInstruction(instruction) {
+			return nil, ErrInstructionNil
 		}
-		//	case *ParentV2:
-		//		instruction.(*ParentV2).UID = newUUID()
-	case *ChildInstructionV2:
-		if ins.UID == "" {
-			ins.UID = newUUID()
+		if err := instruction.makeRecursiveSD(storage, disclosures); err != nil {
+			return nil, err
 		}
-		//	case *ChildArrayV2:
-		//		instruction.(*ChildArrayV2).UID = newUUID()
 	}
+	parent.ChildrenClaimHash = digests(storage)
+	return storage, nil
+}
+
+// makeRecursiveSD is the same as makeSD, a recursive parent is always selective disclosable
+func (r *RecursiveInstructionV2) makeRecursiveSD(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	return r.makeSD(storage, disclosures)
+}
+
+func (c *ChildInstructionV2) makeRecursiveSD(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	if c.AlwaysVisible {
+		storage[c.Name] = c.Value
+		return nil
+	}
+	return c.makeSelectiveDisclosure(storage, disclosures)
 }
 
-func recursiveClaimHandler(instructions []any, parent any, disclosures DisclosuresV2) error {
+func (p *ParentInstructionV2) makeRecursiveSD(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	if p.AlwaysVisible {
+		return p.makePlain(storage, disclosures)
+	}
+	return p.makeSelectiveDisclosure(storage, disclosures)
+}
+
+func (c *ChildArrayInstructionV2) makeRecursiveSD(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	values, err := c.elements(disclosures)
+	if err != nil {
+		return err
+	}
+	if c.AlwaysVisible {
+		storage[c.Name] = values
+		return nil
+	}
+	return c.makeSelectiveDisclosure(values, storage, disclosures)
+}
+
+func makeSDV2(instructions []Instruction, storage jwt.MapClaims, disclosures DisclosuresV2) error {
 	for _, instruction := range instructions {
-		switch instruction.(type) {
-		case *RecursiveInstructionV2:
-			addUID(instruction)
-			child := instruction.(*RecursiveInstructionV2)
-			if err := recursiveClaimHandler(child.Children, child, disclosures); err != nil {
-				return err
-			}
-			if err := child.makeClaimHash(); err != nil {
-				return err
-			}
-			child.addToDisclosures(disclosures)
-			switch parentClaim := parent.(type) {
-			case *RecursiveInstructionV2:
-				if parentClaim.UID == child.UID {
-					break
-				}
-				parentClaim.ChildrenClaimHash = append(parentClaim.ChildrenClaimHash, child.ClaimHash)
-			default:
-				return ErrNotKnownInstruction
-			}
-		case *ChildInstructionV2:
-			addUID(instruction)
-			child := instruction.(*ChildInstructionV2)
-			child.makeClaimHash()
-			child.addToDisclosures(disclosures)
-			switch parentClaim := parent.(type) {
-			case *RecursiveInstructionV2:
-				parentClaim.ChildrenClaimHash = append(parentClaim.ChildrenClaimHash, child.ClaimHash)
-			default:
-				return ErrNotKnownInstruction
-			}
-		default:
-			return ErrNotKnownInstruction
+		if isNilInstruction(instruction) {
+			return ErrInstructionNil
+		}
+		if err := instruction.makeSD(storage, disclosures); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func makeSDV2(instructions []any, storage jwt.MapClaims, disclosures DisclosuresV2) error {
-	for _, i := range instructions {
-		switch claim := i.(type) {
-		case *ParentInstructionV2:
-
-			if claim.SelectiveDisclosure {
-				// Parent is Selective Disclosure witch means that all of its children are also Selective Disclosure, but not recursive.
-				if err := claim.makeClaimHash(); err != nil {
-					return err
-				}
-				addToArray("_sd", claim.ClaimHash, storage)
-
-				claim.addToDisclosures(disclosures)
-
-				break
-			}
-
-			storage[claim.Name] = jwt.MapClaims{}
-			if err := makeSDV2(claim.Children, storage[claim.Name].(jwt.MapClaims), disclosures); err != nil {
-				return err
-			}
-
-		case *RecursiveInstructionV2:
-			if err := recursiveClaimHandler(claim.Children, claim, disclosures); err != nil {
-				return err
-			}
-
-			if err := claim.recursiveHashClaim(claim.ChildrenClaimHash); err != nil {
-				return err
-			}
-
-			claim.addToDisclosures(disclosures)
-
-			addToArray("_sd", claim.ClaimHash, storage)
-
-		case *ChildInstructionV2:
-			if claim.SelectiveDisclosure {
-				claim.makeClaimHash()
-				claim.addToDisclosures(disclosures)
-				addToArray("_sd", claim.ClaimHash, storage)
-			} else {
-				storage[claim.Name] = claim.Value
-			}
-
-		case *ChildArrayInstructionV2:
-			for _, child := range claim.Children {
-				if child.SelectiveDisclosure {
-					child.makeClaimHash()
-					addToArray(claim.Name, map[string]string{"...": child.ClaimHash}, storage)
-
-					child.addToDisclosures(disclosures)
-				} else {
-					addToArray(claim.Name, child.Value, storage)
-				}
-			}
-
-		default:
-			return ErrNotKnownInstruction
-		}
+func (p *ParentInstructionV2) makeSD(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	if p.SelectiveDisclosure {
+		return p.makeSelectiveDisclosure(storage, disclosures)
+	}
+	return p.makePlain(storage, disclosures)
+}
+
+// makeSelectiveDisclosure discloses the parent as one object, where each child keeps its own selective disclosure
+func (p *ParentInstructionV2) makeSelectiveDisclosure(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	value := jwt.MapClaims{}
+	if err := makeSDV2(p.Children, value, disclosures); err != nil {
+		return err
+	}
+	p.ChildrenClaimHash = digests(value)
+
+	if err := p.makeClaimHash(value); err != nil {
+		return err
+	}
+	addToArray("_sd", p.ClaimHash, storage)
+
+	p.addToDisclosures(disclosures, value)
+
+	return nil
+}
+
+func (p *ParentInstructionV2) makePlain(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	claims := jwt.MapClaims{}
+	storage[p.Name] = claims
+	return makeSDV2(p.Children, claims, disclosures)
+}
+
+func (r *RecursiveInstructionV2) makeSD(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	value, err := recursiveClaimHandler(r.Children, r, disclosures)
+	if err != nil {
+		return err
+	}
+
+	if err := r.makeClaimHash(value); err != nil {
+		return err
+	}
+
+	r.addToDisclosures(disclosures, value)
+
+	addToArray("_sd", r.ClaimHash, storage)
+
+	return nil
+}
+
+func (c *ChildInstructionV2) makeSD(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	if c.SelectiveDisclosure {
+		return c.makeSelectiveDisclosure(storage, disclosures)
+	}
+	storage[c.Name] = c.Value
+	return nil
+}
+
+func (c *ChildInstructionV2) makeSelectiveDisclosure(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	if err := c.makeClaimHash(); err != nil {
+		return err
 	}
+	c.addToDisclosures(disclosures)
+	addToArray("_sd", c.ClaimHash, storage)
 	return nil
 }
 
+func (c *ChildArrayInstructionV2) makeSD(storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	values, err := c.elements(disclosures)
+	if err != nil {
+		return err
+	}
+	if c.SelectiveDisclosure {
+		return c.makeSelectiveDisclosure(values, storage, disclosures)
+	}
+	storage[c.Name] = values
+	return nil
+}
+
+// makeSelectiveDisclosure discloses the array as one claim
+func (c *ChildArrayInstructionV2) makeSelectiveDisclosure(values []any, storage jwt.MapClaims, disclosures DisclosuresV2) error {
+	if err := c.makeClaimHash(values); err != nil {
+		return err
+	}
+	c.addToDisclosures(disclosures, values)
+	addToArray("_sd", c.ClaimHash, storage)
+	return nil
+}
+
+// elements returns the elements of the array, where selective disclosable elements are replaced by {"...": digest}
+func (c *ChildArrayInstructionV2) elements(disclosures DisclosuresV2) ([]any, error) {
+	values := []any{}
+	for _, child := range c.Children {
+		if isNilInstruction(child) {
+			return nil, ErrInstructionNil
+		}
+		value, err := child.makeElement(disclosures)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (c *ChildInstructionV2) makeElement(disclosures DisclosuresV2) (any, error) {
+	if !c.SelectiveDisclosure {
+		return c.Value, nil
+	}
+	var err error
+	if c.Salt, c.DisclosureHash, c.ClaimHash, err = encodeElementDisclosure(c.Value); err != nil {
+		return nil, err
+	}
+	c.addToDisclosures(disclosures)
+	return map[string]string{"...": c.ClaimHash}, nil
+}
+
+// makeElement returns the object of the parent, where each child keeps its own selective disclosure
+func (p *ParentInstructionV2) makeElement(disclosures DisclosuresV2) (any, error) {
+	value := jwt.MapClaims{}
+	if err := makeSDV2(p.Children, value, disclosures); err != nil {
+		return nil, err
+	}
+	if !p.SelectiveDisclosure {
+		return value, nil
+	}
+	p.ChildrenClaimHash = digests(value)
+	var err error
+	if p.Salt, p.DisclosureHash, p.ClaimHash, err = encodeElementDisclosure(value); err != nil {
+		return nil, err
+	}
+	p.addToDisclosures(disclosures, value)
+	return map[string]string{"...": p.ClaimHash}, nil
+}
+
+// makeElement returns the digest of the object, a recursive parent is always selective disclosable
+func (r *RecursiveInstructionV2) makeElement(disclosures DisclosuresV2) (any, error) {
+	value, err := recursiveClaimHandler(r.Children, r, disclosures)
+	if err != nil {
+		return nil, err
+	}
+	if r.Salt, r.DisclosureHash, r.ClaimHash, err = encodeElementDisclosure(value); err != nil {
+		return nil, err
+	}
+	r.addToDisclosures(disclosures, value)
+	return map[string]string{"...": r.ClaimHash}, nil
+}
+
+func (c *ChildArrayInstructionV2) makeElement(disclosures DisclosuresV2) (any, error) {
+	values, err := c.elements(disclosures)
+	if err != nil {
+		return nil, err
+	}
+	if !c.SelectiveDisclosure {
+		return values, nil
+	}
+	if c.Salt, c.DisclosureHash, c.ClaimHash, err = encodeElementDisclosure(values); err != nil {
+		return nil, err
+	}
+	c.addToDisclosures(disclosures, values)
+	return map[string]string{"...": c.ClaimHash}, nil
+}
+
 func decodeDisclosureHash(hash string) (string, error) {
 	decoded, err := base64.RawStdEncoding.DecodeString(hash)
 	if err != nil {
@@ -49,6 +49,12 @@ func testClaim(t *testing.T, inversSelectiveDisclosureClaim map[string][]any) {
 	}
 }
 
+func TestHash(t *testing.T) {
+	// the family_name disclosure and its digest from the examples of the SD-JWT specification
+	got := hash("WyJfMjZiYzRMVC1hYzZxMktJNmNCVzVlcyIsICJmYW1pbHlfbmFtZSIsICJNw7ZiaXVzIl0")
+	assert.Equal(t, "X9yH0Ajrdm1Oij4tWso9UzzKJvPoDxwmuEcO3XAdRC0", got)
+}
+
 func TestMakeSDV2(t *testing.T) {
 	type want struct {
 		claims                         jwt.MapClaims
@@ -57,18 +63,18 @@ func TestMakeSDV2(t *testing.T) {
 	}
 	tts := []struct {
 		name string
-		have []any
+		have []Instruction
 		want want
 	}{
 		{
 			name: "Test 1 - Children: No Selective Disclosure",
-			have: []any{
+			have: []Instruction{
 				&ParentInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&ParentInstructionV2{
 							Name: "parent_b",
-							Children: []any{
+							Children: []Instruction{
 								&ChildInstructionV2{
 									Name:  "child_a",
 									Value: "test",
@@ -92,13 +98,13 @@ func TestMakeSDV2(t *testing.T) {
 		},
 		{
 			name: "Test 2 - Children: Two Selective Disclosure Children to the same parent",
-			have: []any{
+			have: []Instruction{
 				&ParentInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&ParentInstructionV2{
 							Name: "parent_b",
-							Children: []any{
+							Children: []Instruction{
 								&ChildInstructionV2{
 									Name:                "child_a",
 									Value:               "test",
@@ -119,18 +125,18 @@ func TestMakeSDV2(t *testing.T) {
 					"parent_a": jwt.MapClaims{
 						"parent_b": jwt.MapClaims{
 							"_sd": []interface{}{
-								"MTM1ZTE1NDBlZGIyMzc0NDJhYTIyNDY3ZmRlMzhlMDUyYTA5NTY4ZjVhMTI0MTVlMjc3MTIxMTU1ZjE1NDlhMg",
-								"YjBkOGM1ZjJiYjdjMjNiNGI2MDVmZTc2NDMwMDdkNDI0MjFlNmE3NTc4ZGMxZGU1NzA0ODY0NDk2ODUzYzE2OQ",
+								"E14VQO2yN0QqoiRn_eOOBSoJVo9aEkFeJ3EhFV8VSaI",
+								"sNjF8rt8I7S2Bf52QwB9QkIeanV43B3lcEhkSWhTwWk",
 							},
 						},
 					},
 				},
 				disclosureHashes: []string{"WyJzYWx0X3p5eCIsImNoaWxkX2EiLCJ0ZXN0Il0", "WyJzYWx0X3p5eCIsImNoaWxkX2IiLCJ0ZXN0Il0"},
 				inversSelectiveDisclosureClaim: map[string][]any{
-					"MTM1ZTE1NDBlZGIyMzc0NDJhYTIyNDY3ZmRlMzhlMDUyYTA5NTY4ZjVhMTI0MTVlMjc3MTIxMTU1ZjE1NDlhMg": {
+					"E14VQO2yN0QqoiRn_eOOBSoJVo9aEkFeJ3EhFV8VSaI": {
 						"salt_zyx", "child_a", "test",
 					},
-					"YjBkOGM1ZjJiYjdjMjNiNGI2MDVmZTc2NDMwMDdkNDI0MjFlNmE3NTc4ZGMxZGU1NzA0ODY0NDk2ODUzYzE2OQ": {
+					"sNjF8rt8I7S2Bf52QwB9QkIeanV43B3lcEhkSWhTwWk": {
 						"salt_zyx", "child_b", "test",
 					},
 				},
@@ -138,17 +144,17 @@ func TestMakeSDV2(t *testing.T) {
 		},
 		{
 			name: "Test 3 - ChildrenArray: Two non Selective Disclosure children to the same parent",
-			have: []any{
+			have: []Instruction{
 				&ParentInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&ChildArrayInstructionV2{
 							Name: "parent_b",
-							Children: []ChildInstructionV2{
-								{
+							Children: []Instruction{
+								&ChildInstructionV2{
 									Value: "test1",
 								},
-								{
+								&ChildInstructionV2{
 									Value: "test2",
 								},
 							},
@@ -171,17 +177,17 @@ func TestMakeSDV2(t *testing.T) {
 		},
 		{
 			name: "Test 4 - ChildrenArray: Two Children to the same parent, one Selective Disclosure.",
-			have: []any{
+			have: []Instruction{
 				&ParentInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&ChildArrayInstructionV2{
 							Name: "parent_b",
-							Children: []ChildInstructionV2{
-								{
+							Children: []Instruction{
+								&ChildInstructionV2{
 									Value: "test1",
 								},
-								{
+								&ChildInstructionV2{
 									Value:               "test2",
 									SelectiveDisclosure: true,
 								},
@@ -195,25 +201,25 @@ func TestMakeSDV2(t *testing.T) {
 					"parent_a": jwt.MapClaims{
 						"parent_b": []interface{}{
 							"test1",
-							map[string]string{"...": "NTc0MGFhYzIxZTc2YTkzNDJiNWQ0NzIxMDYyZTdhNTlkYTQ3MzUyOWQ4NTYxNzc1YjRiMjMzNmQ5OGQ1NmFmNQ"},
+							map[string]string{"...": "XJIkcSdiLYwo3TFuoTDd8sw31xzZT5YvNQw89PfT-Qg"},
 						},
 					},
 				},
-				disclosureHashes: []string{"WyJzYWx0X3p5eCIsIiIsInRlc3QyIl0"},
+				disclosureHashes: []string{"WyJzYWx0X3p5eCIsInRlc3QyIl0"},
 				inversSelectiveDisclosureClaim: map[string][]any{
-					"NTc0MGFhYzIxZTc2YTkzNDJiNWQ0NzIxMDYyZTdhNTlkYTQ3MzUyOWQ4NTYxNzc1YjRiMjMzNmQ5OGQ1NmFmNQ": {
-						"salt_zyx", "", "test2",
+					"XJIkcSdiLYwo3TFuoTDd8sw31xzZT5YvNQw89PfT-Qg": {
+						"salt_zyx", "test2",
 					},
 				},
 			},
 		},
 		{
 			name: "Test 5 - Parent Selective Disclosure with one child that's not Selective Disclosure",
-			have: []any{
+			have: []Instruction{
 				&ParentInstructionV2{
 					Name:                "parent_a",
 					SelectiveDisclosure: true,
-					Children: []any{
+					Children: []Instruction{
 						&ChildInstructionV2{
 							Name:  "child_a",
 							Value: "test",
@@ -222,10 +228,10 @@ func TestMakeSDV2(t *testing.T) {
 				},
 			},
 			want: want{
-				claims:           jwt.MapClaims{"_sd": []any{"ODk5MDE2NjM4OWFmYmJhMDFjYWQwZjBhYjlhYzg4ODM5NTY5ZDk4MzU2NWI5NWJjNmI3Zjc0MzAwZTU3MThiNQ"}},
+				claims:           jwt.MapClaims{"_sd": []any{"iZAWY4mvu6AcrQ8KuayIg5Vp2YNWW5W8a390MA5XGLU"}},
 				disclosureHashes: []string{"WyJzYWx0X3p5eCIsInBhcmVudF9hIix7ImNoaWxkX2EiOiJ0ZXN0In1d"},
 				inversSelectiveDisclosureClaim: map[string][]any{
-					"ODk5MDE2NjM4OWFmYmJhMDFjYWQwZjBhYjlhYzg4ODM5NTY5ZDk4MzU2NWI5NWJjNmI3Zjc0MzAwZTU3MThiNQ": {
+					"iZAWY4mvu6AcrQ8KuayIg5Vp2YNWW5W8a390MA5XGLU": {
 						"salt_zyx", "parent_a", map[string]any{
 							"child_a": "test",
 						},
@@ -235,10 +241,10 @@ func TestMakeSDV2(t *testing.T) {
 		},
 		{
 			name: "Test 6 - Two parents, one with Selective Disclosure with one child that's not Selective Disclosure, and one without Selective Disclosure",
-			have: []any{
+			have: []Instruction{
 				&ParentInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&ChildInstructionV2{
 							Name:  "child_a",
 							Value: "test",
@@ -248,7 +254,7 @@ func TestMakeSDV2(t *testing.T) {
 				&ParentInstructionV2{
 					Name:                "parent_b",
 					SelectiveDisclosure: true,
-					Children: []any{
+					Children: []Instruction{
 						&ChildInstructionV2{
 							Name:  "child_b",
 							Value: "test",
@@ -258,14 +264,14 @@ func TestMakeSDV2(t *testing.T) {
 			},
 			want: want{
 				claims: jwt.MapClaims{
-					"_sd": []any{"ODJiZGJhNmQ3MWRlNGY3NzlkYmMzYTNlMjU1YjAwNDAwZjJjM2I5NTVlNGQ3ZDQ5MTU4ZDZhMTNjMzcwOGU0NA"},
+					"_sd": []any{"gr26bXHeT3edvDo-JVsAQA8sO5VeTX1JFY1qE8NwjkQ"},
 					"parent_a": jwt.MapClaims{
 						"child_a": "test",
 					},
 				},
 				disclosureHashes: []string{"WyJzYWx0X3p5eCIsInBhcmVudF9iIix7ImNoaWxkX2IiOiJ0ZXN0In1d"},
 				inversSelectiveDisclosureClaim: map[string][]any{
-					"ODJiZGJhNmQ3MWRlNGY3NzlkYmMzYTNlMjU1YjAwNDAwZjJjM2I5NTVlNGQ3ZDQ5MTU4ZDZhMTNjMzcwOGU0NA": {
+					"gr26bXHeT3edvDo-JVsAQA8sO5VeTX1JFY1qE8NwjkQ": {
 						"salt_zyx", "parent_b", map[string]any{
 							"child_b": "test",
 						},
@@ -275,10 +281,10 @@ func TestMakeSDV2(t *testing.T) {
 		},
 		{
 			name: "Test 7 - Recursive Selective Disclosure",
-			have: []any{
+			have: []Instruction{
 				&RecursiveInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&ChildInstructionV2{
 							Name:  "child_a",
 							Value: "test_a",
@@ -292,13 +298,13 @@ func TestMakeSDV2(t *testing.T) {
 			},
 			want: want{
 				claims: jwt.MapClaims{
-					"_sd": []any{"NWM1NDg0MGFjNWFlMjY3MTc4MjAwYjMzMTM4OTViMzI1ZWMwOTI3MTJmMDRjMDRhMmU0ODBjMDhmOGJjNTBlNw"},
+					"_sd": []any{"PWOP4wPnuIlSI23RTezNxSjQYBdxnw6PkrfqY7RKE5g"},
 				},
-				disclosureHashes: []string{"WyJzYWx0X3p5eCIsImNoaWxkX2EiLCJ0ZXN0X2EiXQ", "WyJzYWx0X3p5eCIsImNoaWxkX2IiLCJ0ZXN0X2IiXQ", "WyJzYWx0X3p5eCIsInBhcmVudF9hIix7Il9zZCI6WyJOR05sTURabE5qazFZakU0TmpWaE1qVmpaVFZoTXpsbU5EVXhaRGsxTnpBMlpqbGpaall4TVRrMVlqSmxOREU1TjJRek1qWmpZamMyTmprd1kyWmpNdyIsIk1tRTNaVGhoTTJZMVl6QmlORFU0TWpnNVpHUmxZV0U1WVRRM1lUTTROelV5TVRGaFl6TTFaVE0wTm1VNE1qQTBORFV3TXpVeE5UaGxOakpsTjJRMVpBIl19XQ"},
+				disclosureHashes: []string{"WyJzYWx0X3p5eCIsImNoaWxkX2EiLCJ0ZXN0X2EiXQ", "WyJzYWx0X3p5eCIsImNoaWxkX2IiLCJ0ZXN0X2IiXQ", "WyJzYWx0X3p5eCIsInBhcmVudF9hIix7Il9zZCI6WyJUT0J1YVZzWVphSmM1YU9mUlIyVmNHLWM5aEdWc3VRWmZUSnN0MmFRejhNIiwiS242S1Axd0xSWUtKM2VxcHBIbzRkU0VhdzE0MGJvSUVSUU5SV09ZdWZWMCJdfV0"},
 				inversSelectiveDisclosureClaim: map[string][]any{
-					"NWM1NDg0MGFjNWFlMjY3MTc4MjAwYjMzMTM4OTViMzI1ZWMwOTI3MTJmMDRjMDRhMmU0ODBjMDhmOGJjNTBlNw": {
+					"PWOP4wPnuIlSI23RTezNxSjQYBdxnw6PkrfqY7RKE5g": {
 						"salt_zyx", "parent_a", map[string][]any{
-							"_sd": {"NGNlMDZlNjk1YjE4NjVhMjVjZTVhMzlmNDUxZDk1NzA2ZjljZjYxMTk1YjJlNDE5N2QzMjZjYjc2NjkwY2ZjMw", "MmE3ZThhM2Y1YzBiNDU4Mjg5ZGRlYWE5YTQ3YTM4NzUyMTFhYzM1ZTM0NmU4MjA0NDUwMzUxNThlNjJlN2Q1ZA"},
+							"_sd": {"TOBuaVsYZaJc5aOfRR2VcG-c9hGVsuQZfTJst2aQz8M", "Kn6KP1wLRYKJ3eqppHo4dSEaw140boIERQNRWOYufV0"},
 						},
 					},
 				},
@@ -306,10 +312,10 @@ func TestMakeSDV2(t *testing.T) {
 		},
 		{
 			name: "Test 8 - Recursive: Two recursive parents with one or two children",
-			have: []any{
+			have: []Instruction{
 				&RecursiveInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&ChildInstructionV2{
 							Name:  "child_aa",
 							Value: "test_aa",
@@ -322,7 +328,7 @@ func TestMakeSDV2(t *testing.T) {
 				},
 				&RecursiveInstructionV2{
 					Name: "parent_b",
-					Children: []any{
+					Children: []Instruction{
 						&ChildInstructionV2{
 							Name:  "child_ba",
 							Value: "test_ba",
@@ -336,25 +342,25 @@ func TestMakeSDV2(t *testing.T) {
 			},
 			want: want{
 				claims: jwt.MapClaims{
-					"_sd": []any{"Mzk3OWYxYTZmNWZhYzhiZjJkNWE1MjQ5NDEwYzZlZjNiNDRmY2IxNGQxYjQ1ZjM3Y2ExNjM2YzcyYjcyNjRjYw", "OWZlZWZiZGI3NGYwODJmNjJjNWYwZjQ0OGE5MTAyNzBkNTQ1MjU0OTE2MWVlNGNmODc1MzZlNTI5NDM3YTU4OA"},
+					"_sd": []any{"BgXB4wzxhu3pM3qYYp70ReCE3u-Q777p_23odBc8us8", "OV2gAPbsdjQuhY38u8H-W3EAc9BJgJ_1QM9sCihAXFE"},
 				},
 				disclosureHashes: []string{
 					"WyJzYWx0X3p5eCIsImNoaWxkX2FhIiwidGVzdF9hYSJd",
 					"WyJzYWx0X3p5eCIsImNoaWxkX2FiIiwidGVzdF9hYiJd",
 					"WyJzYWx0X3p5eCIsImNoaWxkX2JhIiwidGVzdF9iYSJd",
 					"WyJzYWx0X3p5eCIsImNoaWxkX2JiIiwidGVzdF9iYiJd",
-					"WyJzYWx0X3p5eCIsInBhcmVudF9hIix7Il9zZCI6WyJZamt6TVRNM01HRmxNRGN6WXpOaFkySmxNR1ptTm1KaE5USm1PV1ZrTUdGaU1HVmtPV0pqT0RNeFpUQTFPVGRoTTJVeU16WTNabU0zT0RWaVpETmlaQSIsIllUTTNaR1U0WkRjeFl6WTVPVEU1TjJJeVpURmpOMlkwWWpOaU5XRTROR0ZrTkRFMVpXSTBZelV5WlRaaU1UTXdZVEV3WmpWak1EazJOemMzTVdZMU5nIl19XQ",
-					"WyJzYWx0X3p5eCIsInBhcmVudF9iIix7Il9zZCI6WyJaamsxWm1JelpUWTNaREV6TTJGak16STBNV1ZsTlRFM01qZzJNV1kzTlRSall6ZzVaVE14WkRBM1pUZ3lOelk0TnpOak5HUTBPVGcxTnpBd09EZzVNQSIsIk5XVXhOelU1WkdVd01tSTVZMlEzTlRnME4yVmhOekEzTWpBNU5UZzVZbU5tT1RGbFkyTXhNV00yWWpBNU5qVmpNMkpoTURGaU9EZGhaREV4T0Rnek1RIl19XQ",
+					"WyJzYWx0X3p5eCIsInBhcmVudF9hIix7Il9zZCI6WyJ1VEUzQ3VCenc2eS1EX2E2VXZudENyRHRtOGd4NEZsNlBpTm5fSGhiMDcwIiwibzMzbzF4eHBrWmV5NGNmMHM3V29TdFFWNjB4UzVyRXdvUTljQ1dkM0gxWSJdfV0",
+					"WyJzYWx0X3p5eCIsInBhcmVudF9iIix7Il9zZCI6WyItVi16NW4wVE9zTWtIdVVYS0dIM1ZNeUo0eDBINkNkb2M4VFVtRmNBaUpBIiwiWGhkWjNnSzV6WFdFZnFjSElKV0p2UGtlekJIR3NKWmNPNkFiaDYwUmlERSJdfV0",
 				},
 				inversSelectiveDisclosureClaim: map[string][]any{
-					"Mzk3OWYxYTZmNWZhYzhiZjJkNWE1MjQ5NDEwYzZlZjNiNDRmY2IxNGQxYjQ1ZjM3Y2ExNjM2YzcyYjcyNjRjYw": {
+					"BgXB4wzxhu3pM3qYYp70ReCE3u-Q777p_23odBc8us8": {
 						"salt_zyx", "parent_a", map[string][]string{
-							"_sd": {"YjkzMTM3MGFlMDczYzNhY2JlMGZmNmJhNTJmOWVkMGFiMGVkOWJjODMxZTA1OTdhM2UyMzY3ZmM3ODViZDNiZA", "YTM3ZGU4ZDcxYzY5OTE5N2IyZTFjN2Y0YjNiNWE4NGFkNDE1ZWI0YzUyZTZiMTMwYTEwZjVjMDk2Nzc3MWY1Ng"},
+							"_sd": {"uTE3CuBzw6y-D_a6UvntCrDtm8gx4Fl6PiNn_Hhb070", "o33o1xxpkZey4cf0s7WoStQV60xS5rEwoQ9cCWd3H1Y"},
 						},
 					},
-					"OWZlZWZiZGI3NGYwODJmNjJjNWYwZjQ0OGE5MTAyNzBkNTQ1MjU0OTE2MWVlNGNmODc1MzZlNTI5NDM3YTU4OA": {
+					"OV2gAPbsdjQuhY38u8H-W3EAc9BJgJ_1QM9sCihAXFE": {
 						"salt_zyx", "parent_b", map[string][]any{
-							"_sd": {"Zjk1ZmIzZTY3ZDEzM2FjMzI0MWVlNTE3Mjg2MWY3NTRjYzg5ZTMxZDA3ZTgyNzY4NzNjNGQ0OTg1NzAwODg5MA", "NWUxNzU5ZGUwMmI5Y2Q3NTg0N2VhNzA3MjA5NTg5YmNmOTFlY2MxMWM2YjA5NjVjM2JhMDFiODdhZDExODgzMQ"},
+							"_sd": {"-V-z5n0TOsMkHuUXKGH3VMyJ4x0H6Cdoc8TUmFcAiJA", "XhdZ3gK5zXWEfqcHIJWJvPkezBHGsJZcO6Abh60RiDE"},
 						},
 					},
 				},
@@ -362,13 +368,13 @@ func TestMakeSDV2(t *testing.T) {
 		},
 		{
 			name: "Test 9 - Recursive: Nested recursive parents",
-			have: []any{
+			have: []Instruction{
 				&RecursiveInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&RecursiveInstructionV2{
 							Name: "parent_b",
-							Children: []any{
+							Children: []Instruction{
 								&ChildInstructionV2{
 									Name:  "child_b1",
 									Value: "test_b1",
@@ -384,19 +390,19 @@ func TestMakeSDV2(t *testing.T) {
 			},
 			want: want{
 				claims: map[string]any{
-					"_sd": []any{"ZTM2OWYwMzg2NTI1MzlhZjhjNjIxNmUwMDQzYTA0OGVkMWVlMTM4MGQzNmI3MGExYWU2MDRlZGYxODk2YmQ0OA"},
+					"_sd": []any{"yN5COfnI19U5IDW6dX1a84QIeCuHuyVyccc_rJIkByw"},
 				},
 				disclosureHashes: []string{
 					"WyJzYWx0X3p5eCIsImNoaWxkX2IxIiwidGVzdF9iMSJd",
 					"WyJzYWx0X3p5eCIsImNoaWxkX2IyIiwidGVzdF9iMiJd",
-					"WyJzYWx0X3p5eCIsInBhcmVudF9hIix7Il9zZCI6WyJNV1l6T0RFMlpERXpPV00yWldZM1lXTTBaR0V4TnpOaU5tWTJaVEkwTTJObE5UUTRPVGhrWkdJNE9ESTJORFZoWmprM05qWTRNR1JsTldJME1UQm1NUSJdfV0",
-					"WyJzYWx0X3p5eCIsInBhcmVudF9iIix7Il9zZCI6WyJNV1EyWXpKa01HRTRZV0psTjJWak4yVmpNbU00TXpBMFpXUmpPV1kyWkRFMVl6UTFPV1V5TURNMFpEVmxObVppWm1WbVpXVmxZV001Wm1FMFlUZzNOQSIsIk56ZzBaR0UzTmpOa09EQTVaV1ptTUdNeE1tUTVOV000TkRNMU1EUTRNMk5qT0RsaVlXUm1aRE0yWmpoa1l6WmpPVFUyT0RFek1HVmlNVE01WTJJelpRIl19XQ",
+					"WyJzYWx0X3p5eCIsInBhcmVudF9hIix7Il9zZCI6WyI1dmJXanhWV25pLUpDVnVNZUtZT1ZPWFFHUXpMTjRseldWek03RkgxS1RJIl19XQ",
+					"WyJzYWx0X3p5eCIsInBhcmVudF9iIix7Il9zZCI6WyJIV3d0Q29xLWZzZnNMSU1FN2NuMjBWeEZuaUEwMWViN192N3VySi1rcUhRIiwiZUUyblk5Z0o3X0RCTFpYSVExQklQTWlicmYwMi1OeHNsV2dURHJFNXl6NCJdfV0",
 				},
 				inversSelectiveDisclosureClaim: map[string][]any{
-					"ZTM2OWYwMzg2NTI1MzlhZjhjNjIxNmUwMDQzYTA0OGVkMWVlMTM4MGQzNmI3MGExYWU2MDRlZGYxODk2YmQ0OA": {
+					"yN5COfnI19U5IDW6dX1a84QIeCuHuyVyccc_rJIkByw": {
 						"salt_zyx", "parent_a", map[string][]any{
 							"_sd": {
-								"MWYzODE2ZDEzOWM2ZWY3YWM0ZGExNzNiNmY2ZTI0M2NlNTQ4OThkZGI4ODI2NDVhZjk3NjY4MGRlNWI0MTBmMQ",
+								"5vbWjxVWni-JCVuMeKYOVOXQGQzLN4lzWVzM7FH1KTI",
 							},
 						},
 					},
@@ -427,21 +433,96 @@ func TestMakeSDV2(t *testing.T) {
 	}
 }
 
+func TestMakeSDV2Nested(t *testing.T) {
+	newSalt = func() string {
+		return "salt_zyx"
+	}
+
+	instructions := []Instruction{
+		&RecursiveInstructionV2{
+			Name: "address",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "country", Value: "SE", AlwaysVisible: true},
+				&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+				&ChildArrayInstructionV2{
+					Name:          "lines",
+					AlwaysVisible: true,
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "c/o Doe"},
+						&ChildInstructionV2{Value: "floor 2", SelectiveDisclosure: true},
+					},
+				},
+				&ParentInstructionV2{
+					Name: "region",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "code", Value: "AB"},
+						&ChildInstructionV2{Name: "name", Value: "Stockholm", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+	}
+
+	storage := jwt.MapClaims{}
+	disclosures := DisclosuresV2{}
+	err := makeSDV2(instructions, storage, disclosures)
+	assert.NoError(t, err)
+
+	address := instructions[0].(*RecursiveInstructionV2)
+	region := address.Children[3].(*ParentInstructionV2)
+	street := address.Children[1].(*ChildInstructionV2)
+	floor := address.Children[2].(*ChildArrayInstructionV2).Children[1].(*ChildInstructionV2)
+	name := region.Children[1].(*ChildInstructionV2)
+
+	assert.Equal(t, jwt.MapClaims{"_sd": []any{address.ClaimHash}}, storage)
+	assert.Len(t, disclosures, 5)
+
+	tts := []struct {
+		name string
+		have string
+		want string
+	}{
+		{
+			name: "recursive parent with plain, selective disclosure, array and object members",
+			have: address.DisclosureHash,
+			want: `["salt_zyx","address",{"_sd":["` + street.ClaimHash + `","` + region.ClaimHash + `"],"country":"SE","lines":["c/o Doe",{"...":"` + floor.ClaimHash + `"}]}]`,
+		},
+		{
+			name: "selective disclosure parent with plain and selective disclosure members",
+			have: region.DisclosureHash,
+			want: `["salt_zyx","region",{"_sd":["` + name.ClaimHash + `"],"code":"AB"}]`,
+		},
+		{
+			name: "array element",
+			have: floor.DisclosureHash,
+			want: `["salt_zyx","floor 2"]`,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := base64.RawURLEncoding.DecodeString(tt.have)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
 func TestRecursiveClaimHandler(t *testing.T) {
 	tts := []struct {
 		name string
-		have []any
+		have []Instruction
 		want string
 	}{
 		{
 			name: "Test 2",
-			have: []any{
+			have: []Instruction{
 				&RecursiveInstructionV2{
 					Name: "parent_a",
-					Children: []any{
+					Children: []Instruction{
 						&RecursiveInstructionV2{
 							Name: "parent_b",
-							Children: []any{
+							Children: []Instruction{
 								&ChildInstructionV2{
 									Name:  "child_a",
 									Value: "test_a",
@@ -460,7 +541,7 @@ func TestRecursiveClaimHandler(t *testing.T) {
 				return "salt_zyx"
 			}
 			disclosures := DisclosuresV2{}
-			err := recursiveClaimHandler(tt.have, tt.have[0], disclosures)
+			_, err := recursiveClaimHandler(tt.have, tt.have[0].(*RecursiveInstructionV2), disclosures)
 			assert.NoError(t, err)
 
 			parent := tt.have[0].(*RecursiveInstructionV2)
@@ -492,3 +573,180 @@ func TestRecursiveClaimHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeSDV2NestedRoundTrip(t *testing.T) {
+	instructions := InstructionsV2{
+		&RecursiveInstructionV2{
+			Name: "address",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "country", Value: "SE", AlwaysVisible: true},
+				&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+				&ChildArrayInstructionV2{
+					Name:          "lines",
+					AlwaysVisible: true,
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "c/o Doe"},
+						&ChildInstructionV2{Value: "floor 2", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+	}
+
+	tts := []struct {
+		name     string
+		disclose []string
+		want     any
+	}{
+		{
+			name:     "only the object",
+			disclose: []string{"address"},
+			want: map[string]any{
+				"country": "SE",
+				"lines":   []any{"c/o Doe"},
+			},
+		},
+		{
+			name:     "object and all members",
+			disclose: []string{"address", "street", ""},
+			want: map[string]any{
+				"country": "SE",
+				"street":  "Storgatan 1",
+				"lines":   []any{"c/o Doe", "floor 2"},
+			},
+		},
+		{
+			name:     "members without the object",
+			disclose: []string{"street"},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			presentation := mockPresentation(t, instructions, "test-key", tt.disclose...)
+			claims, _, err := Verify(presentation, "test-key")
+			if tt.want == nil {
+				assert.ErrorIs(t, err, ErrDisclosureNotReferenced)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, claims["address"])
+		})
+	}
+}
+
+func TestMakeSDV2ArrayElements(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildArrayInstructionV2{
+			Name: "addresses",
+			Children: []Instruction{
+				&ParentInstructionV2{
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "country", Value: "SE"},
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+					},
+				},
+				&ParentInstructionV2{
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "country", Value: "DK"},
+					},
+				},
+				&RecursiveInstructionV2{
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "city", Value: "Oslo"},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "x", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+	}
+
+	tts := []struct {
+		name     string
+		disclose []string
+		want     any
+	}{
+		{
+			name: "no disclosures",
+			want: []any{
+				map[string]any{"country": "DK"},
+				[]any{},
+			},
+		},
+		{
+			name:     "elements without their selective disclosable claims",
+			disclose: []string{""},
+			want: []any{
+				map[string]any{"country": "SE"},
+				map[string]any{"country": "DK"},
+				map[string]any{},
+				[]any{"x"},
+			},
+		},
+		{
+			name:     "elements with their selective disclosable claims",
+			disclose: []string{"", "street", "city"},
+			want: []any{
+				map[string]any{"country": "SE", "street": "Storgatan 1"},
+				map[string]any{"country": "DK"},
+				map[string]any{"city": "Oslo"},
+				[]any{"x"},
+			},
+		},
+		{
+			name:     "claim without its element",
+			disclose: []string{"street"},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			presentation := mockPresentation(t, instructions, "test-key", tt.disclose...)
+			claims, _, err := Verify(presentation, "test-key")
+			if tt.want == nil {
+				assert.ErrorIs(t, err, ErrDisclosureNotReferenced)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, claims["addresses"])
+		})
+	}
+}
+
+func TestMakeSDV2ArrayElementDisclosures(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildArrayInstructionV2{
+			Name: "nationalities",
+			Children: []Instruction{
+				&ChildInstructionV2{Value: "SE", SelectiveDisclosure: true},
+				&ParentInstructionV2{SelectiveDisclosure: true, Children: []Instruction{
+					&ChildInstructionV2{Name: "country", Value: "DK"},
+				}},
+				&RecursiveInstructionV2{Children: []Instruction{
+					&ChildInstructionV2{Name: "city", Value: "Oslo"},
+				}},
+				&ChildArrayInstructionV2{SelectiveDisclosure: true, Children: []Instruction{
+					&ChildInstructionV2{Value: "FI"},
+				}},
+			},
+		},
+	}
+
+	sdjwt, err := instructions.SDJWT(jwt.SigningMethodHS256, "test-key")
+	assert.NoError(t, err)
+
+	lengths := map[int]int{}
+	for _, disclosure := range sdjwt.Disclosures {
+		b, err := base64.RawURLEncoding.DecodeString(disclosure.disclosureHash)
+		assert.NoError(t, err)
+		decoded := []any{}
+		assert.NoError(t, json.Unmarshal(b, &decoded))
+		lengths[len(decoded)]++
+	}
+	assert.Equal(t, map[int]int{2: 4, 3: 1}, lengths, "elements are [salt, value], the city member is [salt, name, value]")
+}
@@ -0,0 +1,174 @@
+package gosdjwt
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// ErrJWKNotValid is returned when a JWK is not a valid public key
+	ErrJWKNotValid = errors.New("JWK is not valid")
+
+	// ErrJWKNotSupported is returned when the key type or curve of a JWK is not supported
+	ErrJWKNotSupported = errors.New("JWK is not supported")
+)
+
+// jwkCurve is an elliptic curve of EC JWKs
+type jwkCurve struct {
+	name  string
+	curve elliptic.Curve
+	ecdh  ecdh.Curve
+	size  int
+}
+
+var jwkCurves = []jwkCurve{
+	{name: "P-256", curve: elliptic.P256(), ecdh: ecdh.P256(), size: 32},
+	{name: "P-384", curve: elliptic.P384(), ecdh: ecdh.P384(), size: 48},
+	{name: "P-521", curve: elliptic.P521(), ecdh: ecdh.P521(), size: 66},
+}
+
+// jwkPrivateMembers are the JWK parameters of private and symmetric keys
+var jwkPrivateMembers = []string{"d", "p", "q", "dp", "dq", "qi", "oth", "k"}
+
+// privateMember returns the first private key parameter of the JWK, false is returned if it has none
+func privateMember(jwk map[string]any) (string, bool) {
+	for _, name := range jwkPrivateMembers {
+		if _, ok := jwk[name]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// ParseJWK returns the public key of a JWK, EC (P-256, P-384, P-521), RSA and OKP (Ed25519) keys are supported.
+// A JWK with private key parameters is not valid.
+func ParseJWK(jwk map[string]any) (crypto.PublicKey, error) {
+	if _, ok := jwk["d"]; ok {
+		return nil, fmt.Errorf("%w: private key parameters", ErrJWKNotValid)
+	}
+
+	kty, _ := jwk["kty"].(string)
+	switch kty {
+	case "EC":
+		return parseECJWK(jwk)
+	case "RSA":
+		return parseRSAJWK(jwk)
+	case "OKP":
+		return parseOKPJWK(jwk)
+	}
+	return nil, fmt.Errorf("%w: kty %q", ErrJWKNotSupported, kty)
+}
+
+func parseECJWK(jwk map[string]any) (crypto.PublicKey, error) {
+	crv, _ := jwk["crv"].(string)
+	for _, c := range jwkCurves {
+		if c.name != crv {
+			continue
+		}
+		x, err := jwkParameter(jwk, "x", c.size)
+		if err != nil {
+			return nil, err
+		}
+		y, err := jwkParameter(jwk, "y", c.size)
+		if err != nil {
+			return nil, err
+		}
+		// the uncompressed point is parsed to check that it is on the curve
+		if _, err := c.ecdh.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrJWKNotValid, err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: c.curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: crv %q", ErrJWKNotSupported, crv)
+}
+
+func parseRSAJWK(jwk map[string]any) (crypto.PublicKey, error) {
+	n, err := jwkParameter(jwk, "n", 0)
+	if err != nil {
+		return nil, err
+	}
+	e, err := jwkParameter(jwk, "e", 0)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("%w: e", ErrJWKNotValid)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+func parseOKPJWK(jwk map[string]any) (crypto.PublicKey, error) {
+	crv, _ := jwk["crv"].(string)
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("%w: crv %q", ErrJWKNotSupported, crv)
+	}
+	x, err := jwkParameter(jwk, "x", ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+// jwkParameter returns the decoded base64url parameter of a JWK, of size bytes unless size is 0
+func jwkParameter(jwk map[string]any, name string, size int) ([]byte, error) {
+	s, ok := jwk[name].(string)
+	if !ok || s == "" {
+		return nil, fmt.Errorf("%w: %s is missing", ErrJWKNotValid, name)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrJWKNotValid, name, err)
+	}
+	if size > 0 && len(b) != size {
+		return nil, fmt.Errorf("%w: %s has %d bytes, want %d", ErrJWKNotValid, name, len(b), size)
+	}
+	return b, nil
+}
+
+// PublicJWK returns the JWK of a public key, e.g. for Header.JWK or a jwks
+func PublicJWK(pub crypto.PublicKey) (map[string]any, error) {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		for _, c := range jwkCurves {
+			if c.curve != key.Curve {
+				continue
+			}
+			return map[string]any{
+				"kty": "EC",
+				"crv": c.name,
+				"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, c.size))),
+				"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, c.size))),
+			}, nil
+		}
+		return nil, fmt.Errorf("%w: curve %s", ErrJWKNotSupported, key.Curve.Params().Name)
+	case *rsa.PublicKey:
+		return map[string]any{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return map[string]any{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrJWKNotSupported, pub)
+}
@@ -0,0 +1,103 @@
+package gosdjwt
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicJWKRoundTrip(t *testing.T) {
+	p256, _, err := NewECDSAKeyPair(elliptic.P256())
+	assert.NoError(t, err)
+	p521, _, err := NewECDSAKeyPair(elliptic.P521())
+	assert.NoError(t, err)
+	rsaKey, _, err := NewRSAKeyPair(2048)
+	assert.NoError(t, err)
+	edKey, _, err := NewED25519KeyPair()
+	assert.NoError(t, err)
+
+	tts := []struct {
+		name string
+		have crypto.PublicKey
+		kty  string
+	}{
+		{name: "test 0 - P-256", have: p256, kty: "EC"},
+		{name: "test 1 - P-521", have: p521, kty: "EC"},
+		{name: "test 2 - RSA", have: rsaKey, kty: "RSA"},
+		{name: "test 3 - Ed25519", have: edKey, kty: "OKP"},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk, err := PublicJWK(tt.have)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.kty, jwk["kty"])
+
+			got, err := ParseJWK(jwk)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.have, got)
+		})
+	}
+}
+
+func TestParseJWK(t *testing.T) {
+	// RFC 7517 appendix A.1
+	rfcEC := map[string]any{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
+		"y":   "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM",
+		"kid": "1",
+	}
+
+	tts := []struct {
+		name string
+		have map[string]any
+		want error
+	}{
+		{name: "test 0 - RFC 7517 EC key", have: rfcEC},
+		{
+			name: "test 1 - point not on the curve",
+			have: map[string]any{"kty": "EC", "crv": "P-256", "x": rfcEC["x"], "y": rfcEC["x"]},
+			want: ErrJWKNotValid,
+		},
+		{
+			name: "test 2 - coordinate of the wrong size",
+			have: map[string]any{"kty": "EC", "crv": "P-256", "x": "AQ", "y": rfcEC["y"]},
+			want: ErrJWKNotValid,
+		},
+		{
+			name: "test 3 - private key",
+			have: map[string]any{"kty": "EC", "crv": "P-256", "x": rfcEC["x"], "y": rfcEC["y"], "d": "870MB6gfuTJ4HtUnUvYMyJpr5eUZNP4Bk43bVdj3eAE"},
+			want: ErrJWKNotValid,
+		},
+		{
+			name: "test 4 - unsupported curve",
+			have: map[string]any{"kty": "EC", "crv": "secp256k1", "x": rfcEC["x"], "y": rfcEC["y"]},
+			want: ErrJWKNotSupported,
+		},
+		{
+			name: "test 5 - unsupported key type",
+			have: map[string]any{"kty": "oct", "k": "c2VjcmV0"},
+			want: ErrJWKNotSupported,
+		},
+		{
+			name: "test 6 - RSA without e",
+			have: map[string]any{"kty": "RSA", "n": "AQAB"},
+			want: ErrJWKNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJWK(tt.have)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package gosdjwt
+
+// MergeInstructions deep merges instruction sets by claim path, where a later set takes precedence over an
+// earlier one. Can be used to layer a default instruction set with per credential type instructions.
+//
+// A claim that is only in one set is kept as it is, for a claim that is in both the later set decides:
+//   - the kind of instruction and its flags, e.g. SelectiveDisclosure, also for nested claims
+//   - the children of objects are merged by name, new children are added after the existing ones
+//   - a child without a value keeps the earlier value, so only its flags are overridden
+//   - an array without elements keeps the earlier elements, otherwise the elements are replaced
+//
+// The instruction sets are not modified, and hashes from an earlier issuance are not copied.
+// Use MergeInstructionsWithOptions to keep the earlier flags when a later set only overrides values.
+func MergeInstructions(sets ...InstructionsV2) InstructionsV2 {
+	return MergeInstructionsWithOptions(MergeOptions{}, sets...)
+}
+
+// MergeOptions changes how MergeInstructionsWithOptions merges a claim that is in both sets
+type MergeOptions struct {
+	// KeepFlags keeps the SelectiveDisclosure and AlwaysVisible flags of the earlier set, so a later set that only
+	// sets a value can not make a selective disclosable claim plain. The kind of instruction is still decided by
+	// the later set.
+	KeepFlags bool
+}
+
+// MergeInstructionsWithOptions deep merges instruction sets as MergeInstructions, changed by options
+func MergeInstructionsWithOptions(options MergeOptions, sets ...InstructionsV2) InstructionsV2 {
+	merged := InstructionsV2{}
+	for _, set := range sets {
+		merged = mergeChildren(merged, set, options)
+	}
+	return merged
+}
+
+func mergeChildren(base, override []Instruction, options MergeOptions) []Instruction {
+	merged := cloneInstructions(base)
+	index := map[string]int{}
+	for i, instruction := range merged {
+		if !isNilInstruction(instruction) {
+			index[instruction.name()] = i
+		}
+	}
+
+	for _, instruction := range override {
+		if isNilInstruction(instruction) {
+			merged = append(merged, nil)
+			continue
+		}
+		name := instruction.name()
+		i, ok := index[name]
+		if !ok {
+			index[name] = len(merged)
+			merged = append(merged, instruction.clone())
+			continue
+		}
+		merged[i] = mergeInstruction(merged[i], instruction, options)
+	}
+	return merged
+}
+
+func mergeInstruction(base, override Instruction, options MergeOptions) Instruction {
+	merged := override.clone()
+
+	if options.KeepFlags && !isNilInstruction(base) {
+		baseSD, baseAlwaysVisible := base.flags()
+		sd, alwaysVisible := merged.flags()
+		if baseSD != nil && sd != nil {
+			*sd, *alwaysVisible = *baseSD, *baseAlwaysVisible
+		}
+	}
+
+	switch m := merged.(type) {
+	case *ParentInstructionV2:
+		m.Children = mergeChildren(objectChildren(base), m.Children, options)
+	case *RecursiveInstructionV2:
+		m.Children = mergeChildren(objectChildren(base), m.Children, options)
+	case *ChildInstructionV2:
+		if b, ok := base.(*ChildInstructionV2); ok && m.Value == nil {
+			m.Value = b.Value
+		}
+	case *ChildArrayInstructionV2:
+		if b, ok := base.(*ChildArrayInstructionV2); ok && len(m.Children) == 0 {
+			m.Children = cloneInstructions(b.Children)
+		}
+	}
+	return merged
+}
+
+// objectChildren returns the children of an object instruction, or nil for any other instruction
+func objectChildren(instruction Instruction) []Instruction {
+	if isNilInstruction(instruction) {
+		return nil
+	}
+	children, elements := instruction.nested()
+	if elements {
+		return nil
+	}
+	return children
+}
+
+// cloneInstructions returns a deep copy of the instructions without hashes, nil instructions are kept as nil
+func cloneInstructions(instructions []Instruction) []Instruction {
+	if instructions == nil {
+		return nil
+	}
+	clones := make([]Instruction, 0, len(instructions))
+	for _, instruction := range instructions {
+		if isNilInstruction(instruction) {
+			clones = append(clones, nil)
+			continue
+		}
+		clones = append(clones, instruction.clone())
+	}
+	return clones
+}
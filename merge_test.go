@@ -0,0 +1,264 @@
+package gosdjwt
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeInstructions(t *testing.T) {
+	tts := []struct {
+		name string
+		have []InstructionsV2
+		want InstructionsV2
+	}{
+		{
+			name: "test 0 - later set takes precedence",
+			have: []InstructionsV2{
+				{
+					&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+					&ChildInstructionV2{Name: "given_name", Value: "John"},
+				},
+				{
+					&ChildInstructionV2{Name: "given_name", Value: "Jane", SelectiveDisclosure: true},
+					&ChildInstructionV2{Name: "family_name", Value: "Doe"},
+				},
+			},
+			want: InstructionsV2{
+				&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+				&ChildInstructionV2{Name: "given_name", Value: "Jane", SelectiveDisclosure: true},
+				&ChildInstructionV2{Name: "family_name", Value: "Doe"},
+			},
+		},
+		{
+			name: "test 1 - nested claims are merged and flags overridden",
+			have: []InstructionsV2{
+				{
+					&ParentInstructionV2{
+						Name: "address",
+						Children: []Instruction{
+							&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+							&ChildInstructionV2{Name: "country", Value: "SE"},
+						},
+					},
+				},
+				{
+					&ParentInstructionV2{
+						Name:                "address",
+						SelectiveDisclosure: true,
+						Children: []Instruction{
+							&ChildInstructionV2{Name: "street", SelectiveDisclosure: true},
+							&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+						},
+					},
+				},
+			},
+			want: InstructionsV2{
+				&ParentInstructionV2{
+					Name:                "address",
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+						&ChildInstructionV2{Name: "country", Value: "SE"},
+						&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+					},
+				},
+			},
+		},
+		{
+			name: "test 2 - kind of instruction is overridden",
+			have: []InstructionsV2{
+				{
+					&ParentInstructionV2{
+						Name: "address",
+						Children: []Instruction{
+							&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+						},
+					},
+					&ChildInstructionV2{Name: "place_of_birth", Value: "Stockholm"},
+				},
+				{
+					&RecursiveInstructionV2{Name: "address"},
+					&ParentInstructionV2{
+						Name: "place_of_birth",
+						Children: []Instruction{
+							&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+						},
+					},
+				},
+			},
+			want: InstructionsV2{
+				&RecursiveInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+					},
+				},
+				&ParentInstructionV2{
+					Name: "place_of_birth",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+					},
+				},
+			},
+		},
+		{
+			name: "test 3 - arrays",
+			have: []InstructionsV2{
+				{
+					&ChildArrayInstructionV2{
+						Name:     "nationalities",
+						Children: []Instruction{&ChildInstructionV2{Value: "SE"}},
+					},
+					&ChildArrayInstructionV2{
+						Name:     "phones",
+						Children: []Instruction{&ChildInstructionV2{Value: "1"}},
+					},
+				},
+				{
+					&ChildArrayInstructionV2{Name: "nationalities", SelectiveDisclosure: true},
+					&ChildArrayInstructionV2{
+						Name:     "phones",
+						Children: []Instruction{&ChildInstructionV2{Value: "2"}},
+					},
+				},
+			},
+			want: InstructionsV2{
+				&ChildArrayInstructionV2{
+					Name:                "nationalities",
+					SelectiveDisclosure: true,
+					Children:            []Instruction{&ChildInstructionV2{Value: "SE"}},
+				},
+				&ChildArrayInstructionV2{
+					Name:     "phones",
+					Children: []Instruction{&ChildInstructionV2{Value: "2"}},
+				},
+			},
+		},
+		{
+			name: "test 4 - three sets",
+			have: []InstructionsV2{
+				{&ChildInstructionV2{Name: "a", Value: "1"}},
+				{&ChildInstructionV2{Name: "a", Value: "2"}},
+				{&ChildInstructionV2{Name: "a", SelectiveDisclosure: true}},
+			},
+			want: InstructionsV2{
+				&ChildInstructionV2{Name: "a", Value: "2", SelectiveDisclosure: true},
+			},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeInstructions(tt.have...)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMergeInstructionsDoesNotModify(t *testing.T) {
+	defaults := InstructionsV2{
+		&ParentInstructionV2{
+			Name: "address",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+			},
+		},
+	}
+	overrides := InstructionsV2{
+		&ParentInstructionV2{
+			Name: "address",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "street", SelectiveDisclosure: true},
+			},
+		},
+	}
+
+	merged := MergeInstructions(defaults, overrides)
+	_, err := merged.SDJWT(jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	street := defaults[0].(*ParentInstructionV2).Children[0].(*ChildInstructionV2)
+	assert.False(t, street.SelectiveDisclosure)
+	assert.Empty(t, street.ClaimHash)
+	assert.Len(t, defaults[0].(*ParentInstructionV2).Children, 1)
+}
+
+func TestMergeInstructionsNil(t *testing.T) {
+	merged := MergeInstructions(
+		InstructionsV2{&ChildInstructionV2{Name: "given_name", Value: "John"}, nil},
+		InstructionsV2{(*ChildInstructionV2)(nil), &ChildInstructionV2{Name: "given_name", SelectiveDisclosure: true}},
+	)
+
+	assert.Equal(t, InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		nil,
+		nil,
+	}, merged)
+	assert.ErrorIs(t, merged.Validate(), ErrInstructionNil)
+}
+
+func TestMergeInstructionsWithOptions(t *testing.T) {
+	defaults := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ParentInstructionV2{
+			Name:                "address",
+			SelectiveDisclosure: true,
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "country", Value: "SE", AlwaysVisible: true},
+			},
+		},
+	}
+	overrides := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "Jane"},
+		&ParentInstructionV2{
+			Name: "address",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "country", Value: "DK"},
+				&ChildInstructionV2{Name: "city", Value: "Copenhagen", SelectiveDisclosure: true},
+			},
+		},
+	}
+
+	tts := []struct {
+		name    string
+		options MergeOptions
+		want    InstructionsV2
+	}{
+		{
+			name: "test 0 - later flags",
+			want: InstructionsV2{
+				&ChildInstructionV2{Name: "given_name", Value: "Jane"},
+				&ParentInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "country", Value: "DK"},
+						&ChildInstructionV2{Name: "city", Value: "Copenhagen", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+		{
+			name:    "test 1 - keep flags",
+			options: MergeOptions{KeepFlags: true},
+			want: InstructionsV2{
+				&ChildInstructionV2{Name: "given_name", Value: "Jane", SelectiveDisclosure: true},
+				&ParentInstructionV2{
+					Name:                "address",
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "country", Value: "DK", AlwaysVisible: true},
+						&ChildInstructionV2{Name: "city", Value: "Copenhagen", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MergeInstructionsWithOptions(tt.options, defaults, overrides))
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package gosdjwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrPolicyPathNotValid is returned when a path in a disclosure policy can not be parsed
+	ErrPolicyPathNotValid = errors.New("policy path is not valid")
+)
+
+// PolicyWildcard matches every element of an array in a policy path
+const PolicyWildcard = "*"
+
+// DisclosurePath points to a claim that should be selective disclosable.
+// Path is either a JSON Pointer (RFC 6901), e.g. "/address/street", or a dotted path, e.g. "address.street".
+// PolicyWildcard can be used as a segment to match all elements of an array.
+// A dotted path can not address a claim name that contains a dot, use a JSON Pointer for those. A dotted path
+// that could also be read as such a claim name, e.g. "a.b" for a document with a claim "a.b", is not valid.
+type DisclosurePath struct {
+	Path      string `json:"path" yaml:"path"`
+	Recursive bool   `json:"recursive,omitempty" yaml:"recursive,omitempty"`
+}
+
+// UnmarshalJSON accepts both a plain path string and a path object
+func (d *DisclosurePath) UnmarshalJSON(b []byte) error {
+	var path string
+	if err := json.Unmarshal(b, &path); err == nil {
+		d.Path = path
+		d.Recursive = false
+		return nil
+	}
+
+	type alias DisclosurePath
+	a := alias{}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return err
+	}
+	*d = DisclosurePath(a)
+	return nil
+}
+
+// DisclosurePolicy is a flat list of claims that should be selective disclosable
+type DisclosurePolicy []DisclosurePath
+
+// NewDisclosurePolicy returns a policy where each path is selective disclosable, but not recursive
+func NewDisclosurePolicy(paths ...string) DisclosurePolicy {
+	policy := DisclosurePolicy{}
+	for _, path := range paths {
+		policy = append(policy, DisclosurePath{Path: path})
+	}
+	return policy
+}
+
+// ConvertPolicy2SDJWT converts a JSON document to a SDJWT where the claims pointed out by the policy are selective disclosable.
+// A path pointing to an array makes each element of the array selective disclosable, same as a wildcard.
+func ConvertPolicy2SDJWT(document map[string]any, policy DisclosurePolicy) (InstructionsV2, error) {
+	rules, err := policy.rules(document)
+	if err != nil {
+		return nil, err
+	}
+	return ConvertJSON2SDJWT(document, rules)
+}
+
+// rules translates the policy to the rule language of ConvertJSON2SDJWT
+func (p DisclosurePolicy) rules(document map[string]any) (map[string]any, error) {
+	rules := map[string]any{}
+	for _, disclosurePath := range p {
+		segments, err := parsePolicyPath(disclosurePath.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(disclosurePath.Path, "/") {
+			if err := checkDottedPath(document, segments, disclosurePath.Path); err != nil {
+				return nil, err
+			}
+		}
+		rule := RuleSelectiveDisclosure
+		if disclosurePath.Recursive {
+			rule = RuleRecursiveSelectiveDisclosure
+		}
+		if _, err := addPolicyRule(rules, document, segments, rule, ""); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// parsePolicyPath splits a JSON Pointer or a dotted path into its segments
+func parsePolicyPath(path string) ([]string, error) {
+	if path == "" || path == "/" {
+		return nil, fmt.Errorf("%w: %q", ErrPolicyPathNotValid, path)
+	}
+
+	var segments []string
+	if strings.HasPrefix(path, "/") {
+		for _, segment := range strings.Split(path[1:], "/") {
+			segment = strings.ReplaceAll(segment, "~1", "/")
+			segment = strings.ReplaceAll(segment, "~0", "~")
+			segments = append(segments, segment)
+		}
+	} else {
+		segments = strings.Split(path, ".")
+	}
+
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("%w: %q", ErrPolicyPathNotValid, path)
+		}
+	}
+	return segments, nil
+}
+
+// checkDottedPath returns ErrPolicyPathNotValid if consecutive segments of a dotted path also form a claim name
+// that contains a dot, as the path would then be ambiguous
+func checkDottedPath(claim any, segments []string, path string) error {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	switch c := claim.(type) {
+	case map[string]any:
+		for n := 2; n <= len(segments); n++ {
+			if _, ok := c[strings.Join(segments[:n], ".")]; ok {
+				return fmt.Errorf("%w: %q is ambiguous, %q is a claim name, use a JSON Pointer", ErrPolicyPathNotValid, path, strings.Join(segments[:n], "."))
+			}
+		}
+		return checkDottedPath(c[segments[0]], segments[1:], path)
+	case []any:
+		for _, element := range c {
+			if err := checkDottedPath(element, segments[1:], path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addPolicyRule adds rule for the claim at segments to rules, rules is the current rule of claim and the updated rule is returned
+func addPolicyRule(rules, claim any, segments []string, rule, path string) (any, error) {
+	if len(segments) == 0 {
+		switch r := rules.(type) {
+		case map[string]any:
+			r[RuleParent] = rule
+			return r, nil
+		case []any:
+			for i := range r {
+				r[i] = rule
+			}
+			return r, nil
+		default:
+			return rule, nil
+		}
+	}
+
+	segment := segments[0]
+
+	switch c := claim.(type) {
+	case map[string]any:
+		claimPath := joinPath(path, segment)
+		child, ok := c[segment]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrRuleClaimNotFound, claimPath)
+		}
+
+		r, ok := rules.(map[string]any)
+		if !ok {
+			r = map[string]any{}
+			if s, isString := rules.(string); isString {
+				r[RuleParent] = s
+			}
+		}
+		childRule, err := addPolicyRule(r[segment], child, segments[1:], rule, claimPath)
+		if err != nil {
+			return nil, err
+		}
+		r[segment] = childRule
+		return r, nil
+
+	case []any:
+		r, ok := rules.([]any)
+		if !ok {
+			r = make([]any, len(c))
+			if s, isString := rules.(string); isString {
+				for i := range r {
+					r[i] = s
+				}
+			}
+		}
+
+		if segment == PolicyWildcard {
+			for i := range c {
+				elementRule, err := addPolicyRule(r[i], c[i], segments[1:], rule, fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return nil, err
+				}
+				r[i] = elementRule
+			}
+			return r, nil
+		}
+
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= len(c) {
+			return nil, fmt.Errorf("%w: %s[%s]", ErrRuleClaimNotFound, path, segment)
+		}
+		elementRule, err := addPolicyRule(r[i], c[i], segments[1:], rule, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		r[i] = elementRule
+		return r, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrRuleClaimNotFound, joinPath(path, segment))
+	}
+}
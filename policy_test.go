@@ -0,0 +1,213 @@
+package gosdjwt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var mockPolicyDocument = map[string]any{
+	"iss":       "https://example.com",
+	"birthdate": "1970-01-01",
+	"address": map[string]any{
+		"street": "Storgatan 1",
+		"city":   "Stockholm",
+	},
+	"nationalities": []any{"SE", "DK"},
+}
+
+func TestConvertPolicy2SDJWT(t *testing.T) {
+	tts := []struct {
+		name string
+		have DisclosurePolicy
+		want InstructionsV2
+	}{
+		{
+			name: "test 0 - JSON Pointer",
+			have: NewDisclosurePolicy("/address/street", "/nationalities/*", "/birthdate"),
+			want: InstructionsV2{
+				&ParentInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+					},
+				},
+				&ChildInstructionV2{Name: "birthdate", Value: "1970-01-01", SelectiveDisclosure: true},
+				&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "SE", SelectiveDisclosure: true},
+						&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+		{
+			name: "test 1 - dotted paths and array index",
+			have: NewDisclosurePolicy("address", "address.city", "nationalities.1"),
+			want: InstructionsV2{
+				&ParentInstructionV2{
+					Name:                "address",
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "city", Value: "Stockholm", SelectiveDisclosure: true},
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+					},
+				},
+				&ChildInstructionV2{Name: "birthdate", Value: "1970-01-01"},
+				&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "SE"},
+						&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+		{
+			name: "test 2 - recursive",
+			have: DisclosurePolicy{{Path: "/address", Recursive: true}},
+			want: InstructionsV2{
+				&RecursiveInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "city", Value: "Stockholm", SelectiveDisclosure: true},
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+					},
+				},
+				&ChildInstructionV2{Name: "birthdate", Value: "1970-01-01"},
+				&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "SE"},
+						&ChildInstructionV2{Value: "DK"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertPolicy2SDJWT(mockPolicyDocument, tt.have)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConvertPolicy2SDJWTErrors(t *testing.T) {
+	tts := []struct {
+		name string
+		have DisclosurePolicy
+		want error
+	}{
+		{
+			name: "absent claim",
+			have: NewDisclosurePolicy("/address/zip"),
+			want: ErrRuleClaimNotFound,
+		},
+		{
+			name: "array index out of range",
+			have: NewDisclosurePolicy("/nationalities/2"),
+			want: ErrRuleClaimNotFound,
+		},
+		{
+			name: "path below a string claim",
+			have: NewDisclosurePolicy("/birthdate/year"),
+			want: ErrRuleClaimNotFound,
+		},
+		{
+			name: "empty segment",
+			have: NewDisclosurePolicy("/address//street"),
+			want: ErrPolicyPathNotValid,
+		},
+		{
+			name: "empty path",
+			have: NewDisclosurePolicy(""),
+			want: ErrPolicyPathNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConvertPolicy2SDJWT(mockPolicyDocument, tt.have)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestConvertPolicy2SDJWTDottedNames(t *testing.T) {
+	document := map[string]any{
+		"a.b": "dotted",
+		"a":   map[string]any{"b": "nested"},
+	}
+
+	_, err := ConvertPolicy2SDJWT(document, NewDisclosurePolicy("a.b"))
+	assert.ErrorIs(t, err, ErrPolicyPathNotValid)
+
+	got, err := ConvertPolicy2SDJWT(document, NewDisclosurePolicy("/a.b"))
+	assert.NoError(t, err)
+	assert.Equal(t, InstructionsV2{
+		&ParentInstructionV2{Name: "a", Children: []Instruction{
+			&ChildInstructionV2{Name: "b", Value: "nested"},
+		}},
+		&ChildInstructionV2{Name: "a.b", Value: "dotted", SelectiveDisclosure: true},
+	}, got)
+
+	got, err = ConvertPolicy2SDJWT(document, NewDisclosurePolicy("/a/b"))
+	assert.NoError(t, err)
+	assert.Equal(t, InstructionsV2{
+		&ParentInstructionV2{Name: "a", Children: []Instruction{
+			&ChildInstructionV2{Name: "b", Value: "nested", SelectiveDisclosure: true},
+		}},
+		&ChildInstructionV2{Name: "a.b", Value: "dotted"},
+	}, got)
+}
+
+func TestParsePolicyPath(t *testing.T) {
+	tts := []struct {
+		name string
+		have string
+		want []string
+	}{
+		{
+			name: "JSON Pointer",
+			have: "/address/street",
+			want: []string{"address", "street"},
+		},
+		{
+			name: "JSON Pointer with escaped characters",
+			have: "/a~1b/c~0d",
+			want: []string{"a/b", "c~d"},
+		},
+		{
+			name: "dotted path",
+			have: "nationalities.*",
+			want: []string{"nationalities", "*"},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePolicyPath(tt.have)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDisclosurePolicyUnmarshalJSON(t *testing.T) {
+	policy := DisclosurePolicy{}
+	err := json.Unmarshal([]byte(`["/birthdate", {"path": "/address", "recursive": true}]`), &policy)
+	assert.NoError(t, err)
+	assert.Equal(t, DisclosurePolicy{
+		{Path: "/birthdate"},
+		{Path: "/address", Recursive: true},
+	}, policy)
+}
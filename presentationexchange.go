@@ -0,0 +1,532 @@
+package gosdjwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// LimitDisclosureRequired means that only the claims of the fields may be disclosed
+	LimitDisclosureRequired = "required"
+	// LimitDisclosurePreferred means that the holder should disclose only the claims of the fields
+	LimitDisclosurePreferred = "preferred"
+)
+
+var (
+	// ErrPresentationDefinitionNotValid is returned when a presentation definition is not valid or not supported
+	ErrPresentationDefinitionNotValid = errors.New("presentation definition is not valid")
+
+	// ErrPresentationDefinitionNotSatisfied is returned when credentials or presentations do not satisfy a
+	// presentation definition
+	ErrPresentationDefinitionNotSatisfied = errors.New("presentation definition is not satisfied")
+
+	// ErrPresentationSubmissionNotValid is returned when a presentation submission does not describe the vp_token
+	// for the presentation definition
+	ErrPresentationSubmissionNotValid = errors.New("presentation submission is not valid")
+)
+
+// PresentationDefinition is a DIF Presentation Exchange presentation definition
+type PresentationDefinition struct {
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Purpose string `json:"purpose,omitempty"`
+
+	// Format are the accepted formats by format, of input descriptors without their own
+	Format map[string]any `json:"format,omitempty"`
+
+	// InputDescriptors all have to be satisfied
+	InputDescriptors []InputDescriptor `json:"input_descriptors"`
+
+	// SubmissionRequirements are not supported, a definition with them is not valid
+	SubmissionRequirements json.RawMessage `json:"submission_requirements,omitempty"`
+
+	// once validates and compiles the definition, validation is the error Validate returns from then on
+	once       sync.Once
+	validation error
+}
+
+// InputDescriptor describes a credential the verifier requests
+type InputDescriptor struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name,omitempty"`
+	Purpose     string           `json:"purpose,omitempty"`
+	Format      map[string]any   `json:"format,omitempty"`
+	Constraints InputConstraints `json:"constraints"`
+}
+
+// InputConstraints are the fields of an input descriptor
+type InputConstraints struct {
+	// LimitDisclosure is LimitDisclosureRequired, LimitDisclosurePreferred or empty to disclose all claims
+	LimitDisclosure string       `json:"limit_disclosure,omitempty"`
+	Fields          []InputField `json:"fields,omitempty"`
+}
+
+// InputField selects a claim with the first of its JSONPaths that has a value accepted by its filter
+type InputField struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// Path are JSONPaths of the forms $.name, $['name'], $[0], $.* and $[*], where * selects all object members
+	// and array elements
+	Path    []string `json:"path"`
+	Purpose string   `json:"purpose,omitempty"`
+
+	// Filter is a JSON schema the value has to be valid against, see Schema
+	Filter         map[string]any `json:"filter,omitempty"`
+	Optional       bool           `json:"optional,omitempty"`
+	IntentToRetain bool           `json:"intent_to_retain,omitempty"`
+
+	// paths and filter are Path and Filter compiled by PresentationDefinition.Validate, once
+	paths  [][]any
+	filter *Schema
+}
+
+// PresentationSubmission describes which presentations of a vp_token satisfy which input descriptors
+type PresentationSubmission struct {
+	ID            string                 `json:"id"`
+	DefinitionID  string                 `json:"definition_id"`
+	DescriptorMap []SubmissionDescriptor `json:"descriptor_map"`
+}
+
+// SubmissionDescriptor maps an input descriptor to a presentation in the vp_token
+type SubmissionDescriptor struct {
+	ID     string `json:"id"`
+	Format string `json:"format"`
+
+	// Path is the JSONPath of the presentation in the vp_token
+	Path string `json:"path"`
+
+	// PathNested is not supported, a submission with it is not valid
+	PathNested *SubmissionDescriptor `json:"path_nested,omitempty"`
+}
+
+// ParsePresentationDefinition parses and validates a JSON presentation definition
+func ParsePresentationDefinition(b []byte) (*PresentationDefinition, error) {
+	definition := &PresentationDefinition{}
+	if err := json.Unmarshal(b, definition); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPresentationDefinitionNotValid, err)
+	}
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+// Validate returns an error if IDs are missing or not unique, JSONPaths or filters are not supported, or the
+// definition has submission requirements. The definition is validated and compiled by the first call, it must not
+// be changed after that.
+func (d *PresentationDefinition) Validate() error {
+	d.once.Do(func() { d.validation = d.validate() })
+	return d.validation
+}
+
+// validate validates the definition and compiles the fields of its input descriptors
+func (d *PresentationDefinition) validate() error {
+	if d.ID == "" {
+		return fmt.Errorf("%w: id is missing", ErrPresentationDefinitionNotValid)
+	}
+	if len(d.SubmissionRequirements) > 0 {
+		return fmt.Errorf("%w: submission_requirements is not supported", ErrPresentationDefinitionNotValid)
+	}
+	if len(d.InputDescriptors) == 0 {
+		return fmt.Errorf("%w: input_descriptors is empty", ErrPresentationDefinitionNotValid)
+	}
+
+	ids := map[string]bool{}
+	for i, descriptor := range d.InputDescriptors {
+		path := fmt.Sprintf("input_descriptors[%d]", i)
+		if descriptor.ID == "" {
+			return fmt.Errorf("%w: %s.id is missing", ErrPresentationDefinitionNotValid, path)
+		}
+		if ids[descriptor.ID] {
+			return fmt.Errorf("%w: %s.id %q is not unique", ErrPresentationDefinitionNotValid, path, descriptor.ID)
+		}
+		ids[descriptor.ID] = true
+
+		switch descriptor.Constraints.LimitDisclosure {
+		case "", LimitDisclosureRequired, LimitDisclosurePreferred:
+		default:
+			return fmt.Errorf("%w: %s.constraints.limit_disclosure %q", ErrPresentationDefinitionNotValid, path, descriptor.Constraints.LimitDisclosure)
+		}
+
+		for j := range descriptor.Constraints.Fields {
+			field := &d.InputDescriptors[i].Constraints.Fields[j]
+			fieldPath := fmt.Sprintf("%s.constraints.fields[%d]", path, j)
+			if err := field.compile(); err != nil {
+				return fmt.Errorf("%w: %s.%s", ErrPresentationDefinitionNotValid, fieldPath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// compile parses the paths and compiles the filter of the field
+func (f *InputField) compile() error {
+	if len(f.Path) == 0 {
+		return errors.New("path is empty")
+	}
+	paths := make([][]any, 0, len(f.Path))
+	for _, p := range f.Path {
+		path, err := parseJSONPath(p)
+		if err != nil {
+			return fmt.Errorf("path: %s", err)
+		}
+		paths = append(paths, path)
+	}
+
+	var filter *Schema
+	if f.Filter != nil {
+		var err error
+		if filter, err = NewSchema(f.Filter); err != nil {
+			return fmt.Errorf("filter: %s", err)
+		}
+	}
+	f.paths, f.filter = paths, filter
+	return nil
+}
+
+// jsonPathWildcard is the selector of a JSONPath *, it selects all members of an object and all elements of an
+// array, see selectClaimPaths
+type jsonPathWildcard struct{}
+
+// parseJSONPath parses a JSONPath into selectors like ClaimFilter.Path, with jsonPathWildcard for *
+func parseJSONPath(s string) ([]any, error) {
+	rest, ok := strings.CutPrefix(s, "$")
+	if !ok {
+		return nil, fmt.Errorf("JSONPath %q does not start with $", s)
+	}
+
+	path := []any{}
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".*"):
+			path = append(path, jsonPathWildcard{})
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath %q has an empty name", s)
+			}
+			path = append(path, name)
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['"), strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest[2:], rest[1:2]+"]")
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q has an unterminated name", s)
+			}
+			path = append(path, rest[2:end+2])
+			rest = rest[end+4:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q has an unterminated index", s)
+			}
+			index := rest[1:end]
+			if index == "*" {
+				path = append(path, jsonPathWildcard{})
+			} else if i, err := strconv.Atoi(index); err == nil && i >= 0 {
+				path = append(path, i)
+			} else {
+				return nil, fmt.Errorf("JSONPath %q has a not supported index %q", s, index)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSONPath %q is not supported", s)
+		}
+	}
+	return path, nil
+}
+
+// formats returns the SD-JWT formats the input descriptor accepts, in order of preference
+func (d *PresentationDefinition) formats(descriptor *InputDescriptor) []string {
+	formats := descriptor.Format
+	if len(formats) == 0 {
+		formats = d.Format
+	}
+	if len(formats) == 0 {
+		return []string{TypeSDJWTVC, TypeSDJWTVCLegacy}
+	}
+	accepted := []string{}
+	for _, format := range []string{TypeSDJWTVC, TypeSDJWTVCLegacy} {
+		if _, ok := formats[format]; ok {
+			accepted = append(accepted, format)
+		}
+	}
+	return accepted
+}
+
+// descriptor returns the input descriptor with id, or nil
+func (d *PresentationDefinition) descriptor(id string) *InputDescriptor {
+	for i := range d.InputDescriptors {
+		if d.InputDescriptors[i].ID == id {
+			return &d.InputDescriptors[i]
+		}
+	}
+	return nil
+}
+
+// match returns the claims the fields of the input descriptor select in claims, and false if a field that is
+// not optional has no accepted value
+func (d *InputDescriptor) match(claims map[string]any) ([]selectedClaim, bool) {
+	selected := []selectedClaim{}
+	for _, field := range d.Constraints.Fields {
+		s := field.selectClaims(claims)
+		if len(s) == 0 && !field.Optional {
+			return nil, false
+		}
+		selected = append(selected, s...)
+	}
+	return selected, true
+}
+
+// selectClaims returns the claims of the first path that has values accepted by the filter, the field has to be
+// compiled by PresentationDefinition.Validate
+func (f *InputField) selectClaims(claims map[string]any) []selectedClaim {
+	for _, path := range f.paths {
+		matches := []selectedClaim{}
+		for _, claim := range selectClaimPaths(claims, path) {
+			if f.filter == nil || f.filter.Validate(claim.value) == nil {
+				matches = append(matches, claim)
+			}
+		}
+		if len(matches) > 0 {
+			return matches
+		}
+	}
+	return nil
+}
+
+// InputDescriptorMatch is a credential that satisfies an input descriptor
+type InputDescriptorMatch struct {
+	Credential *StoredCredential
+
+	// Disclosures are the disclosures to present, only those the fields need if disclosure is limited, sorted
+	Disclosures []string
+}
+
+// Presentation returns the SD-JWT with only the disclosures of the match, ending with ~, see HolderKey.Present
+func (m *InputDescriptorMatch) Presentation() string {
+	return presentDisclosures(m.Credential.SDJWT, m.Disclosures)
+}
+
+// PresentationExchangeResult is the result of evaluating a presentation definition against the credentials
+// of a wallet
+type PresentationExchangeResult struct {
+	// Matches are the credentials that satisfy each input descriptor, by its ID
+	Matches map[string][]*InputDescriptorMatch
+}
+
+// Evaluate finds the credentials that satisfy each input descriptor with the disclosures to present for each, a
+// credential only satisfies input descriptors that accept the format of its typ. It returns ErrPresentationDefinitionNotSatisfied if an input descriptor has no credential.
+func (d *PresentationDefinition) Evaluate(credentials []*StoredCredential) (*PresentationExchangeResult, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := &PresentationExchangeResult{Matches: map[string][]*InputDescriptorMatch{}}
+	for _, credential := range credentials {
+		if credential.SDJWT == nil {
+			return nil, fmt.Errorf("%w: %s has no SD-JWT", ErrSDJWTNotValid, credential.ID)
+		}
+		claims, r, err := sdjwtReconstruction(credential.SDJWT)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", credential.ID, err)
+		}
+		typ := sdjwtType(credential.SDJWT)
+		for i := range d.InputDescriptors {
+			descriptor := &d.InputDescriptors[i]
+			if !slices.Contains(d.formats(descriptor), typ) {
+				continue
+			}
+			selected, ok := descriptor.match(claims)
+			if !ok {
+				continue
+			}
+
+			disclosures := credential.SDJWT.Disclosures.ArrayHashes()
+			if descriptor.Constraints.LimitDisclosure != "" {
+				disclosures = r.disclosuresOf(selected)
+			}
+			result.Matches[descriptor.ID] = append(result.Matches[descriptor.ID], &InputDescriptorMatch{
+				Credential:  credential,
+				Disclosures: disclosures,
+			})
+		}
+	}
+
+	for _, descriptor := range d.InputDescriptors {
+		if len(result.Matches[descriptor.ID]) == 0 {
+			return nil, fmt.Errorf("%w: input descriptor %s", ErrPresentationDefinitionNotSatisfied, descriptor.ID)
+		}
+	}
+	return result, nil
+}
+
+// Submission returns the vp_token of presentations by input descriptor ID, the presentation if there is one and
+// an array otherwise, with its presentation submission. The format of a presentation is its typ, which the input
+// descriptor has to accept.
+func (d *PresentationDefinition) Submission(presentations map[string]string) (any, *PresentationSubmission, error) {
+	if err := d.Validate(); err != nil {
+		return nil, nil, err
+	}
+	for id := range presentations {
+		if d.descriptor(id) == nil {
+			return nil, nil, fmt.Errorf("%w: %s is not an input descriptor", ErrPresentationSubmissionNotValid, id)
+		}
+	}
+
+	submission := &PresentationSubmission{
+		ID:            newUUID(),
+		DefinitionID:  d.ID,
+		DescriptorMap: []SubmissionDescriptor{},
+	}
+	vpToken := []string{}
+	for i := range d.InputDescriptors {
+		descriptor := &d.InputDescriptors[i]
+		presentation, ok := presentations[descriptor.ID]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: input descriptor %s", ErrPresentationDefinitionNotSatisfied, descriptor.ID)
+		}
+		format := sdjwtType(&SDJWT{JWT: splitSDJWT(presentation).JWT})
+		if !slices.Contains(d.formats(descriptor), format) {
+			return nil, nil, fmt.Errorf("%w: input descriptor %s does not accept format %q", ErrPresentationSubmissionNotValid, descriptor.ID, format)
+		}
+		submission.DescriptorMap = append(submission.DescriptorMap, SubmissionDescriptor{
+			ID:     descriptor.ID,
+			Format: format,
+			Path:   fmt.Sprintf("$[%d]", len(vpToken)),
+		})
+		vpToken = append(vpToken, presentation)
+	}
+
+	if len(vpToken) == 1 {
+		submission.DescriptorMap[0].Path = "$"
+		return vpToken[0], submission, nil
+	}
+	return vpToken, submission, nil
+}
+
+// Validate returns an error unless the submission is for the definition and maps each input descriptor once to
+// a SD-JWT presentation
+func (s *PresentationSubmission) Validate(d *PresentationDefinition) error {
+	if s.ID == "" {
+		return fmt.Errorf("%w: id is missing", ErrPresentationSubmissionNotValid)
+	}
+	if s.DefinitionID != d.ID {
+		return fmt.Errorf("%w: definition_id %q is not %q", ErrPresentationSubmissionNotValid, s.DefinitionID, d.ID)
+	}
+
+	ids := map[string]bool{}
+	for i, entry := range s.DescriptorMap {
+		path := fmt.Sprintf("descriptor_map[%d]", i)
+		descriptor := d.descriptor(entry.ID)
+		if descriptor == nil {
+			return fmt.Errorf("%w: %s.id %q is not an input descriptor", ErrPresentationSubmissionNotValid, path, entry.ID)
+		}
+		if ids[entry.ID] {
+			return fmt.Errorf("%w: %s.id %q is not unique", ErrPresentationSubmissionNotValid, path, entry.ID)
+		}
+		ids[entry.ID] = true
+
+		if !slices.Contains(d.formats(descriptor), entry.Format) {
+			return fmt.Errorf("%w: %s.format %q", ErrPresentationSubmissionNotValid, path, entry.Format)
+		}
+		if entry.PathNested != nil {
+			return fmt.Errorf("%w: %s.path_nested is not supported", ErrPresentationSubmissionNotValid, path)
+		}
+		if _, err := parseJSONPath(entry.Path); err != nil {
+			return fmt.Errorf("%w: %s.path: %s", ErrPresentationSubmissionNotValid, path, err)
+		}
+	}
+
+	for _, descriptor := range d.InputDescriptors {
+		if !ids[descriptor.ID] {
+			return fmt.Errorf("%w: input descriptor %s", ErrPresentationDefinitionNotSatisfied, descriptor.ID)
+		}
+	}
+	return nil
+}
+
+// VerifyPresentationExchange verifies the presentations of a vp_token, to the verifier aud with its nonce, that its
+// presentation submission maps to the input descriptors of the definition, and checks that they satisfy them. With
+// LimitDisclosureRequired, a presentation may not disclose claims that no field selects. The typ of a presentation
+// has to be the format of its submission descriptor. The presentations are returned by input descriptor ID.
+//
+// A revoked or suspended credential is not an error, its status is in Validation.Status of the presentation and has
+// to be checked by the caller.
+func (v *Verifier) VerifyPresentationExchange(ctx context.Context, definition *PresentationDefinition, vpToken any, submission *PresentationSubmission, aud, nonce string) (map[string]*VerifiedPresentation, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	if err := submission.Validate(definition); err != nil {
+		return nil, err
+	}
+
+	if presentations, ok := vpToken.([]string); ok {
+		token := []any{}
+		for _, presentation := range presentations {
+			token = append(token, presentation)
+		}
+		vpToken = token
+	}
+
+	verified := map[string]*VerifiedPresentation{}
+	for _, entry := range submission.DescriptorMap {
+		path, _ := parseJSONPath(entry.Path)
+		selected := selectClaimPaths(vpToken, path)
+		if len(selected) != 1 {
+			return nil, fmt.Errorf("%w: %s path %s", ErrPresentationSubmissionNotValid, entry.ID, entry.Path)
+		}
+		presentation, ok := selected[0].value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s path %s is not a SD-JWT", ErrPresentationSubmissionNotValid, entry.ID, entry.Path)
+		}
+
+		p, r, err := v.verifyPresentation(ctx, presentation, aud, nonce)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.ID, err)
+		}
+		if typ, _ := p.Validation.Header["typ"].(string); typ != entry.Format {
+			return nil, fmt.Errorf("%w: %s format %q is not the typ %q", ErrPresentationSubmissionNotValid, entry.ID, entry.Format, typ)
+		}
+		if err := checkInputDescriptor(definition.descriptor(entry.ID), p.Claims, r); err != nil {
+			return nil, err
+		}
+		verified[entry.ID] = p
+	}
+	return verified, nil
+}
+
+// checkInputDescriptor returns ErrPresentationDefinitionNotSatisfied unless the verified claims of a presentation,
+// with r their reconstruction, satisfy the input descriptor and disclose only what its fields select if disclosure
+// is limited
+func checkInputDescriptor(descriptor *InputDescriptor, claims map[string]any, r *reconstruction) error {
+	selected, ok := descriptor.match(claims)
+	if !ok {
+		return fmt.Errorf("%w: input descriptor %s", ErrPresentationDefinitionNotSatisfied, descriptor.ID)
+	}
+	if descriptor.Constraints.LimitDisclosure != LimitDisclosureRequired {
+		return nil
+	}
+
+	needed := map[string]bool{}
+	for _, disclosure := range r.disclosuresOf(selected) {
+		needed[disclosure] = true
+	}
+	for _, disclosed := range r.disclosed {
+		if !needed[disclosed.disclosure.disclosureHash] {
+			return fmt.Errorf("%w: input descriptor %s limits disclosure, %s is disclosed", ErrPresentationDefinitionNotSatisfied, descriptor.ID, disclosed.path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,482 @@
+package gosdjwt
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var mockPresentationDefinition = `{
+	"id": "pid-request",
+	"format": {"dc+sd-jwt": {"sd-jwt_alg_values": ["HS256"]}},
+	"input_descriptors": [
+		{
+			"id": "pid",
+			"constraints": {
+				"limit_disclosure": "required",
+				"fields": [
+					{"path": ["$.vct"], "filter": {"type": "string", "const": "https://example.com/pid"}},
+					{"path": ["$.address.country", "$.country"], "filter": {"type": "string", "enum": ["SE", "NO"]}},
+					{"path": ["$['family_name']"], "optional": true}
+				]
+			}
+		}
+	]
+}`
+
+func TestParseJSONPath(t *testing.T) {
+	tts := []struct {
+		name string
+		path string
+		want []any
+		err  bool
+	}{
+		{name: "test 0 - root", path: "$", want: []any{}},
+		{name: "test 1 - names", path: "$.address.country", want: []any{"address", "country"}},
+		{name: "test 2 - bracket names", path: `$['address']["street address"]`, want: []any{"address", "street address"}},
+		{name: "test 3 - index", path: "$.nationalities[1]", want: []any{"nationalities", 1}},
+		{name: "test 4 - wildcards", path: "$.nationalities[*].*", want: []any{"nationalities", jsonPathWildcard{}, jsonPathWildcard{}}},
+		{name: "test 5 - no root", path: "address", err: true},
+		{name: "test 6 - negative index", path: "$.nationalities[-1]", err: true},
+		{name: "test 7 - filter expression", path: "$.nationalities[?(@ == 'SE')]", err: true},
+		{name: "test 8 - recursive descent", path: "$..country", err: true},
+		{name: "test 9 - unterminated name", path: "$['address", err: true},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJSONPath(tt.path)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParsePresentationDefinition(t *testing.T) {
+	tts := []struct {
+		name       string
+		definition string
+		err        error
+	}{
+		{
+			name:       "test 0 - valid",
+			definition: mockPresentationDefinition,
+		},
+		{
+			name:       "test 1 - id missing",
+			definition: `{"input_descriptors":[{"id":"pid"}]}`,
+			err:        ErrPresentationDefinitionNotValid,
+		},
+		{
+			name:       "test 2 - no input descriptors",
+			definition: `{"id":"request","input_descriptors":[]}`,
+			err:        ErrPresentationDefinitionNotValid,
+		},
+		{
+			name:       "test 3 - input descriptor id not unique",
+			definition: `{"id":"request","input_descriptors":[{"id":"pid"},{"id":"pid"}]}`,
+			err:        ErrPresentationDefinitionNotValid,
+		},
+		{
+			name:       "test 4 - limit disclosure not valid",
+			definition: `{"id":"request","input_descriptors":[{"id":"pid","constraints":{"limit_disclosure":"always"}}]}`,
+			err:        ErrPresentationDefinitionNotValid,
+		},
+		{
+			name:       "test 5 - JSONPath not supported",
+			definition: `{"id":"request","input_descriptors":[{"id":"pid","constraints":{"fields":[{"path":["$..country"]}]}}]}`,
+			err:        ErrPresentationDefinitionNotValid,
+		},
+		{
+			name:       "test 6 - filter not valid",
+			definition: `{"id":"request","input_descriptors":[{"id":"pid","constraints":{"fields":[{"path":["$.vct"],"filter":{"type":"text"}}]}}]}`,
+			err:        ErrPresentationDefinitionNotValid,
+		},
+		{
+			name:       "test 7 - submission requirements",
+			definition: `{"id":"request","submission_requirements":[{"rule":"all","from":"A"}],"input_descriptors":[{"id":"pid"}]}`,
+			err:        ErrPresentationDefinitionNotValid,
+		},
+		{
+			name:       "test 8 - path empty",
+			definition: `{"id":"request","input_descriptors":[{"id":"pid","constraints":{"fields":[{"path":[]}]}}]}`,
+			err:        ErrPresentationDefinitionNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePresentationDefinition([]byte(tt.definition))
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPresentationDefinitionValidateCompilesFields(t *testing.T) {
+	definition, err := ParsePresentationDefinition([]byte(mockPresentationDefinition))
+	assert.NoError(t, err)
+
+	fields := definition.InputDescriptors[0].Constraints.Fields
+	assert.Equal(t, [][]any{{"vct"}}, fields[0].paths)
+	assert.NotNil(t, fields[0].filter)
+	assert.Equal(t, [][]any{{"address", "country"}, {"country"}}, fields[1].paths)
+	assert.Nil(t, fields[2].filter)
+}
+
+func TestPresentationDefinitionEvaluateConcurrently(t *testing.T) {
+	credentials := mockDCQLCredentials(t, nil)
+	definition := &PresentationDefinition{ID: "request", InputDescriptors: []InputDescriptor{
+		{ID: "pid", Constraints: InputConstraints{Fields: []InputField{{Path: []string{"$.address.country"}}}}},
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := definition.Evaluate(credentials)
+			assert.NoError(t, err)
+			assert.Len(t, result.Matches["pid"], 2)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPresentationDefinitionEvaluate(t *testing.T) {
+	credentials := mockDCQLCredentials(t, nil)
+
+	tts := []struct {
+		name        string
+		descriptor  InputDescriptor
+		credentials []string
+		disclosures int
+		err         error
+	}{
+		{
+			name: "test 0 - limit disclosure",
+			descriptor: InputDescriptor{ID: "pid", Constraints: InputConstraints{LimitDisclosure: LimitDisclosureRequired, Fields: []InputField{
+				{Path: []string{"$.address.country"}, Filter: map[string]any{"const": "SE"}},
+			}}},
+			credentials: []string{"pid"},
+			disclosures: 2,
+		},
+		{
+			name: "test 1 - all disclosures without limit",
+			descriptor: InputDescriptor{ID: "pid", Constraints: InputConstraints{Fields: []InputField{
+				{Path: []string{"$.address.country"}, Filter: map[string]any{"const": "SE"}},
+			}}},
+			credentials: []string{"pid"},
+			disclosures: 5,
+		},
+		{
+			name: "test 2 - second path",
+			descriptor: InputDescriptor{ID: "pid", Constraints: InputConstraints{LimitDisclosure: LimitDisclosurePreferred, Fields: []InputField{
+				{Path: []string{"$.family_name", "$.given_name"}},
+			}}},
+			credentials: []string{"pid", "diploma"},
+			disclosures: 1,
+		},
+		{
+			name: "test 3 - array element filter",
+			descriptor: InputDescriptor{ID: "pid", Constraints: InputConstraints{LimitDisclosure: LimitDisclosureRequired, Fields: []InputField{
+				{Path: []string{"$.nationalities[*]"}, Filter: map[string]any{"type": "string", "pattern": "^N"}},
+			}}},
+			credentials: []string{"diploma"},
+			disclosures: 1,
+		},
+		{
+			name: "test 4 - optional field",
+			descriptor: InputDescriptor{ID: "pid", Constraints: InputConstraints{LimitDisclosure: LimitDisclosureRequired, Fields: []InputField{
+				{Path: []string{"$.vct"}, Filter: map[string]any{"const": "https://example.com/diploma"}},
+				{Path: []string{"$.family_name"}, Optional: true},
+			}}},
+			credentials: []string{"diploma"},
+			disclosures: 0,
+		},
+		{
+			name: "test 5 - not satisfied",
+			descriptor: InputDescriptor{ID: "pid", Constraints: InputConstraints{Fields: []InputField{
+				{Path: []string{"$.address.country"}, Filter: map[string]any{"const": "DK"}},
+			}}},
+			err: ErrPresentationDefinitionNotSatisfied,
+		},
+		{
+			name:       "test 6 - other format",
+			descriptor: InputDescriptor{ID: "pid", Format: map[string]any{"mso_mdoc": map[string]any{}}},
+			err:        ErrPresentationDefinitionNotSatisfied,
+		},
+		{
+			name:       "test 7 - format other than the typ of the credentials",
+			descriptor: InputDescriptor{ID: "pid", Format: map[string]any{TypeSDJWTVCLegacy: map[string]any{}}},
+			err:        ErrPresentationDefinitionNotSatisfied,
+		},
+		{
+			name: "test 8 - object member wildcard",
+			descriptor: InputDescriptor{ID: "pid", Constraints: InputConstraints{LimitDisclosure: LimitDisclosureRequired, Fields: []InputField{
+				{Path: []string{"$.address.*"}, Filter: map[string]any{"const": "SE"}},
+			}}},
+			credentials: []string{"pid"},
+			disclosures: 2,
+		},
+		{
+			name: "test 9 - object member wildcard does not select scalars",
+			descriptor: InputDescriptor{ID: "pid", Constraints: InputConstraints{Fields: []InputField{
+				{Path: []string{"$.vct.*"}},
+			}}},
+			err: ErrPresentationDefinitionNotSatisfied,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			definition := &PresentationDefinition{ID: "request", InputDescriptors: []InputDescriptor{tt.descriptor}}
+			result, err := definition.Evaluate(credentials)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			got := []string{}
+			for _, match := range result.Matches["pid"] {
+				got = append(got, match.Credential.ID)
+			}
+			assert.Equal(t, tt.credentials, got)
+			assert.Len(t, result.Matches["pid"][0].Disclosures, tt.disclosures)
+		})
+	}
+}
+
+func TestPresentationDefinitionSubmission(t *testing.T) {
+	pid := mockDCQLCredentials(t, nil)[0].SDJWT.JWT + "~"
+	diploma := mockDCQLCredential(t, VC{Type: TypeSDJWTVCLegacy, VCT: "https://example.com/diploma", Issuer: "https://example.com/issuer"}).SDJWT.JWT + "~"
+	definition := &PresentationDefinition{ID: "request", InputDescriptors: []InputDescriptor{
+		{ID: "pid"},
+		{ID: "diploma", Format: map[string]any{TypeSDJWTVCLegacy: map[string]any{}}},
+	}}
+
+	vpToken, submission, err := definition.Submission(map[string]string{"pid": pid, "diploma": diploma})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{pid, diploma}, vpToken)
+	assert.NotEmpty(t, submission.ID)
+	assert.Equal(t, "request", submission.DefinitionID)
+	assert.Equal(t, []SubmissionDescriptor{
+		{ID: "pid", Format: TypeSDJWTVC, Path: "$[0]"},
+		{ID: "diploma", Format: TypeSDJWTVCLegacy, Path: "$[1]"},
+	}, submission.DescriptorMap)
+	assert.NoError(t, submission.Validate(definition))
+
+	_, _, err = definition.Submission(map[string]string{"pid": pid})
+	assert.ErrorIs(t, err, ErrPresentationDefinitionNotSatisfied)
+
+	_, _, err = definition.Submission(map[string]string{"pid": pid, "diploma": diploma, "mdl": "mdl~"})
+	assert.ErrorIs(t, err, ErrPresentationSubmissionNotValid)
+
+	_, _, err = definition.Submission(map[string]string{"pid": pid, "diploma": pid})
+	assert.ErrorIs(t, err, ErrPresentationSubmissionNotValid)
+
+	single := &PresentationDefinition{ID: "request", InputDescriptors: []InputDescriptor{{ID: "pid"}}}
+	vpToken, submission, err = single.Submission(map[string]string{"pid": pid})
+	assert.NoError(t, err)
+	assert.Equal(t, pid, vpToken)
+	assert.Equal(t, "$", submission.DescriptorMap[0].Path)
+}
+
+func TestPresentationSubmissionValidate(t *testing.T) {
+	definition := &PresentationDefinition{ID: "request", InputDescriptors: []InputDescriptor{{ID: "pid"}}}
+
+	tts := []struct {
+		name       string
+		definition *PresentationDefinition
+		submission PresentationSubmission
+		err        error
+	}{
+		{
+			name:       "test 0 - valid",
+			submission: PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVC, Path: "$"}}},
+		},
+		{
+			name:       "test 1 - id missing",
+			submission: PresentationSubmission{DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVC, Path: "$"}}},
+			err:        ErrPresentationSubmissionNotValid,
+		},
+		{
+			name:       "test 2 - other definition",
+			submission: PresentationSubmission{ID: "s", DefinitionID: "other", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVC, Path: "$"}}},
+			err:        ErrPresentationSubmissionNotValid,
+		},
+		{
+			name:       "test 3 - unknown input descriptor",
+			submission: PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVC, Path: "$[0]"}, {ID: "mdl", Format: TypeSDJWTVC, Path: "$[1]"}}},
+			err:        ErrPresentationSubmissionNotValid,
+		},
+		{
+			name:       "test 4 - input descriptor twice",
+			submission: PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVC, Path: "$[0]"}, {ID: "pid", Format: TypeSDJWTVC, Path: "$[1]"}}},
+			err:        ErrPresentationSubmissionNotValid,
+		},
+		{
+			name:       "test 5 - other format",
+			submission: PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: "jwt_vc", Path: "$"}}},
+			err:        ErrPresentationSubmissionNotValid,
+		},
+		{
+			name:       "test 6 - format the input descriptor does not accept",
+			definition: &PresentationDefinition{ID: "request", Format: map[string]any{TypeSDJWTVCLegacy: map[string]any{}}, InputDescriptors: []InputDescriptor{{ID: "pid"}}},
+			submission: PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVC, Path: "$"}}},
+			err:        ErrPresentationSubmissionNotValid,
+		},
+		{
+			name:       "test 7 - legacy format without a format in the definition",
+			submission: PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVCLegacy, Path: "$"}}},
+		},
+		{
+			name:       "test 8 - nested path",
+			submission: PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVC, Path: "$", PathNested: &SubmissionDescriptor{ID: "pid", Format: TypeSDJWTVC, Path: "$"}}}},
+			err:        ErrPresentationSubmissionNotValid,
+		},
+		{
+			name:       "test 9 - input descriptor missing",
+			submission: PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{}},
+			err:        ErrPresentationDefinitionNotSatisfied,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.definition == nil {
+				tt.definition = definition
+			}
+			err := tt.submission.Validate(tt.definition)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifierVerifyPresentationExchange(t *testing.T) {
+	ctx := context.Background()
+	credentials := mockDCQLCredentials(t, nil)
+	verifier := &Verifier{Key: "mura"}
+
+	definition, err := ParsePresentationDefinition([]byte(mockPresentationDefinition))
+	assert.NoError(t, err)
+
+	result, err := definition.Evaluate(credentials)
+	assert.NoError(t, err)
+	assert.Len(t, result.Matches["pid"], 1)
+	presentation := result.Matches["pid"][0].Presentation()
+
+	vpToken, submission, err := definition.Submission(map[string]string{"pid": presentation})
+	assert.NoError(t, err)
+	assert.Equal(t, TypeSDJWTVC, submission.DescriptorMap[0].Format)
+
+	t.Run("json round trip", func(t *testing.T) {
+		b, err := json.Marshal(map[string]any{"vp_token": []any{vpToken}, "presentation_submission": submission})
+		assert.NoError(t, err)
+
+		response := struct {
+			VPToken                any                     `json:"vp_token"`
+			PresentationSubmission *PresentationSubmission `json:"presentation_submission"`
+		}{}
+		assert.NoError(t, json.Unmarshal(b, &response))
+		response.PresentationSubmission.DescriptorMap[0].Path = "$[0]"
+
+		verified, err := verifier.VerifyPresentationExchange(ctx, definition, response.VPToken, response.PresentationSubmission, "https://verifier.example.com", "nonce")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"country": "SE"}, verified["pid"].Claims["address"])
+		assert.NotContains(t, verified["pid"].Claims, "given_name")
+	})
+
+	t.Run("more disclosed than limited", func(t *testing.T) {
+		_, err := verifier.VerifyPresentationExchange(ctx, definition, credentials[0].SDJWT.String(), submission, "https://verifier.example.com", "nonce")
+		assert.ErrorIs(t, err, ErrPresentationDefinitionNotSatisfied)
+	})
+
+	t.Run("field not disclosed", func(t *testing.T) {
+		_, err := verifier.VerifyPresentationExchange(ctx, definition, credentials[0].SDJWT.JWT+"~", submission, "https://verifier.example.com", "nonce")
+		assert.ErrorIs(t, err, ErrPresentationDefinitionNotSatisfied)
+	})
+
+	t.Run("path not in vp_token", func(t *testing.T) {
+		other := *submission
+		other.DescriptorMap = []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVC, Path: "$[3]"}}
+		_, err := verifier.VerifyPresentationExchange(ctx, definition, []string{presentation}, &other, "https://verifier.example.com", "nonce")
+		assert.ErrorIs(t, err, ErrPresentationSubmissionNotValid)
+	})
+
+	t.Run("format is not the typ", func(t *testing.T) {
+		legacy := &PresentationDefinition{ID: "request", InputDescriptors: []InputDescriptor{{ID: "pid"}}}
+		other := &PresentationSubmission{ID: "s", DefinitionID: "request", DescriptorMap: []SubmissionDescriptor{{ID: "pid", Format: TypeSDJWTVCLegacy, Path: "$"}}}
+		_, err := verifier.VerifyPresentationExchange(ctx, legacy, presentation, other, "https://verifier.example.com", "nonce")
+		assert.ErrorIs(t, err, ErrPresentationSubmissionNotValid)
+	})
+
+	t.Run("signature not valid", func(t *testing.T) {
+		_, err := (&Verifier{Key: "other"}).VerifyPresentationExchange(ctx, definition, vpToken, submission, "https://verifier.example.com", "nonce")
+		assert.Error(t, err)
+	})
+}
+
+func TestVerifierVerifyPresentationExchangeKeyBinding(t *testing.T) {
+	ctx := context.Background()
+	verifier := &Verifier{Key: "mura"}
+	aud := "https://verifier.example.com"
+
+	key, err := NewMemoryHolderKeyStore().Create(ctx, "ES256")
+	assert.NoError(t, err)
+	cnf, err := key.Confirmation()
+	assert.NoError(t, err)
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+	}
+	sdjwt, err := instructions.SDJWTVC(VC{VCT: "https://example.com/pid", Issuer: "https://example.com/issuer", Confirmation: cnf}, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	definition := &PresentationDefinition{ID: "request", InputDescriptors: []InputDescriptor{
+		{ID: "pid", Constraints: InputConstraints{Fields: []InputField{{Path: []string{"$.given_name"}}}}},
+	}}
+	presentation, err := key.Present(sdjwt.String(), aud, "nonce")
+	assert.NoError(t, err)
+	vpToken, submission, err := definition.Submission(map[string]string{"pid": presentation})
+	assert.NoError(t, err)
+
+	verified, err := verifier.VerifyPresentationExchange(ctx, definition, vpToken, submission, aud, "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, "John", verified["pid"].Claims["given_name"])
+	assert.Equal(t, "nonce", verified["pid"].KeyBinding["nonce"])
+
+	tts := []struct {
+		name    string
+		vpToken any
+		aud     string
+		nonce   string
+	}{
+		{name: "test 0 - no KB-JWT", vpToken: sdjwt.String(), aud: aud, nonce: "nonce"},
+		{name: "test 1 - other audience", vpToken: vpToken, aud: "https://other.example.com", nonce: "nonce"},
+		{name: "test 2 - other nonce", vpToken: vpToken, aud: aud, nonce: "other"},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.VerifyPresentationExchange(ctx, definition, tt.vpToken, submission, tt.aud, tt.nonce)
+			assert.ErrorIs(t, err, ErrKeyBindingNotValid)
+		})
+	}
+}
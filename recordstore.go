@@ -0,0 +1,235 @@
+package gosdjwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecordStore stores opaque records by ID, a CredentialStore of encoded credentials can be built on it
+type RecordStore interface {
+	// Put stores the record, replacing a record with the same ID
+	Put(ctx context.Context, id string, record []byte) error
+
+	// Get returns the record with id, or ErrCredentialNotFound
+	Get(ctx context.Context, id string) ([]byte, error)
+
+	// Delete removes the record with id, or returns ErrCredentialNotFound
+	Delete(ctx context.Context, id string) error
+
+	// IDs returns the IDs of all records
+	IDs(ctx context.Context) ([]string, error)
+}
+
+// MemoryRecordStore is a RecordStore in memory, it is safe for concurrent use
+type MemoryRecordStore struct {
+	mu      sync.Mutex
+	records map[string][]byte
+}
+
+// NewMemoryRecordStore returns an empty store
+func NewMemoryRecordStore() *MemoryRecordStore {
+	return &MemoryRecordStore{records: map[string][]byte{}}
+}
+
+// Put stores a copy of the record
+func (s *MemoryRecordStore) Put(ctx context.Context, id string, record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[id] = append([]byte{}, record...)
+	return nil
+}
+
+// Get returns a copy of the record with id
+func (s *MemoryRecordStore) Get(ctx context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCredentialNotFound, id)
+	}
+	return append([]byte{}, record...), nil
+}
+
+// Delete removes the record with id
+func (s *MemoryRecordStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrCredentialNotFound, id)
+	}
+	delete(s.records, id)
+	return nil
+}
+
+// IDs returns the sorted IDs of all records
+func (s *MemoryRecordStore) IDs(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.records))
+	for id := range s.records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// recordCodec turns encoded credentials into records and back
+type recordCodec interface {
+	seal(ctx context.Context, id string, plaintext []byte) ([]byte, error)
+	open(ctx context.Context, id string, record []byte) ([]byte, error)
+}
+
+// plainCodec stores the encoded credential as the record
+type plainCodec struct{}
+
+func (plainCodec) seal(ctx context.Context, id string, plaintext []byte) ([]byte, error) {
+	return plaintext, nil
+}
+
+func (plainCodec) open(ctx context.Context, id string, record []byte) ([]byte, error) {
+	return record, nil
+}
+
+// recordCredentialStore is a CredentialStore of JSON encoded credentials in a RecordStore, it is safe for
+// concurrent use within a process
+type recordCredentialStore struct {
+	records RecordStore
+	codec   recordCodec
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+func newRecordCredentialStore(records RecordStore, codec recordCodec) *recordCredentialStore {
+	return &recordCredentialStore{
+		records: records,
+		codec:   codec,
+		now:     time.Now,
+	}
+}
+
+// Put encodes the credential and stores it as a record
+func (s *recordCredentialStore) Put(ctx context.Context, credential *StoredCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := prepareCredential(credential, s.now()); err != nil {
+		return err
+	}
+	b, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	record, err := s.codec.seal(ctx, credential.ID, b)
+	if err != nil {
+		return err
+	}
+	return s.records.Put(ctx, credential.ID, record)
+}
+
+// Get decodes the credential with id
+func (s *recordCredentialStore) Get(ctx context.Context, id string) (*StoredCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read(ctx, id)
+}
+
+func (s *recordCredentialStore) read(ctx context.Context, id string) (*StoredCredential, error) {
+	if !credentialIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w: %q", ErrCredentialIDNotValid, id)
+	}
+	record, err := s.records.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.codec.open(ctx, id, record)
+	if err != nil {
+		return nil, err
+	}
+
+	credential := &StoredCredential{}
+	if err := json.Unmarshal(b, credential); err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	return credential, nil
+}
+
+// Delete removes the record of the credential with id
+func (s *recordCredentialStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !credentialIDPattern.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrCredentialIDNotValid, id)
+	}
+	return s.records.Delete(ctx, id)
+}
+
+// all decodes every credential in the store
+func (s *recordCredentialStore) all(ctx context.Context) ([]*StoredCredential, error) {
+	ids, err := s.records.IDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := []*StoredCredential{}
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		credential, err := s.read(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, nil
+}
+
+// Query decodes the credentials and returns those that match the query
+func (s *recordCredentialStore) Query(ctx context.Context, query CredentialQuery) ([]*StoredCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credentials, err := s.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	matches := []*StoredCredential{}
+	for _, credential := range credentials {
+		if query.Matches(credential, now) {
+			matches = append(matches, credential)
+		}
+	}
+	sortCredentials(matches)
+	return matches, nil
+}
+
+// Purge removes the records of the credentials that are expired at now
+func (s *recordCredentialStore) Purge(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credentials, err := s.all(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, credential := range credentials {
+		if !credential.Expired(now) {
+			continue
+		}
+		if err := s.records.Delete(ctx, credential.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
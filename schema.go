@@ -0,0 +1,506 @@
+package gosdjwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrSchemaNotValid is returned when a JSON Schema can not be used
+	ErrSchemaNotValid = errors.New("schema is not valid")
+
+	// ErrClaimsNotValid is returned when claims do not match a JSON Schema
+	ErrClaimsNotValid = errors.New("claims do not match the schema")
+)
+
+// maxSchemaDepth limits how deep schemas and $ref are followed
+const maxSchemaDepth = 64
+
+// SchemaError is a problem with the value at Path
+type SchemaError struct {
+	Path string
+	Err  error
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", jsonPath(e.Path), e.Err)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaErrors are all problems found while validating against a schema
+type SchemaErrors []*SchemaError
+
+func (e SchemaErrors) Error() string {
+	s := []string{}
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "; ")
+}
+
+// Unwrap makes errors.Is and errors.As match any of the problems
+func (e SchemaErrors) Unwrap() []error {
+	errs := []error{}
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Schema is a JSON Schema. The validation keywords type, enum, const, minLength, maxLength, pattern, minimum,
+// maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, properties, patternProperties, additionalProperties,
+// required, minProperties, maxProperties, items, minItems, maxItems, uniqueItems, allOf, anyOf, oneOf and not
+// are supported, and $ref to the schema itself or its $defs and definitions. Other keywords, e.g. format, are
+// annotations and ignored.
+type Schema struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+}
+
+// ParseSchema returns the JSON Schema in b
+func ParseSchema(b []byte) (*Schema, error) {
+	var root any
+	if err := json.Unmarshal(b, &root); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotValid, err)
+	}
+	return NewSchema(root)
+}
+
+// NewSchema returns the JSON Schema of a decoded schema document, an object or a boolean
+func NewSchema(schema any) (*Schema, error) {
+	s := &Schema{root: schema, patterns: map[string]*regexp.Regexp{}}
+	if err := s.check(schema, "#", 0); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// check compiles the patterns and resolves the references of the schema
+func (s *Schema) check(schema any, pointer string, depth int) error {
+	if depth > maxSchemaDepth {
+		return fmt.Errorf("%w: %s is nested too deep", ErrSchemaNotValid, pointer)
+	}
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	m, ok := schema.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%w: %s is not an object or boolean", ErrSchemaNotValid, pointer)
+	}
+
+	if ref, ok := m["$ref"]; ok {
+		refString, _ := ref.(string)
+		if _, err := s.resolve(refString); err != nil {
+			return err
+		}
+	}
+	if t, ok := m["type"]; ok {
+		types, ok := t.([]any)
+		if !ok {
+			types = []any{t}
+		}
+		for _, t := range types {
+			if !schemaTypes[fmt.Sprint(t)] {
+				return fmt.Errorf("%w: %s/type %v", ErrSchemaNotValid, pointer, t)
+			}
+		}
+	}
+	if pattern, ok := m["pattern"]; ok {
+		if err := s.compile(pattern, pointer+"/pattern"); err != nil {
+			return err
+		}
+	}
+
+	subschemas := map[string]any{}
+	for _, keyword := range []string{"additionalProperties", "items", "not"} {
+		if sub, ok := m[keyword]; ok {
+			subschemas[pointer+"/"+keyword] = sub
+		}
+	}
+	for _, keyword := range []string{"properties", "patternProperties", "$defs", "definitions"} {
+		if sub, ok := m[keyword]; ok {
+			props, ok := sub.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%w: %s/%s is not an object", ErrSchemaNotValid, pointer, keyword)
+			}
+			for name, prop := range props {
+				if keyword == "patternProperties" {
+					if err := s.compile(name, pointer+"/"+keyword); err != nil {
+						return err
+					}
+				}
+				subschemas[pointer+"/"+keyword+"/"+name] = prop
+			}
+		}
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if sub, ok := m[keyword]; ok {
+			list, ok := sub.([]any)
+			if !ok || len(list) == 0 {
+				return fmt.Errorf("%w: %s/%s is not a non-empty array", ErrSchemaNotValid, pointer, keyword)
+			}
+			for i, item := range list {
+				subschemas[fmt.Sprintf("%s/%s/%d", pointer, keyword, i)] = item
+			}
+		}
+	}
+
+	for subPointer, sub := range subschemas {
+		if err := s.check(sub, subPointer, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compile(pattern any, pointer string) error {
+	p, ok := pattern.(string)
+	if !ok {
+		return fmt.Errorf("%w: %s is not a string", ErrSchemaNotValid, pointer)
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrSchemaNotValid, pointer, err)
+	}
+	s.patterns[p] = re
+	return nil
+}
+
+// resolve returns the schema of a $ref, # or a JSON pointer into the schema document
+func (s *Schema) resolve(ref string) (any, error) {
+	if ref == "#" {
+		return s.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("%w: $ref %q is not local", ErrSchemaNotValid, ref)
+	}
+
+	schema := s.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		m, ok := schema.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: $ref %q is not found", ErrSchemaNotValid, ref)
+		}
+		if schema, ok = m[token]; !ok {
+			return nil, fmt.Errorf("%w: $ref %q is not found", ErrSchemaNotValid, ref)
+		}
+	}
+	return schema, nil
+}
+
+// Validate returns the problems of v, decoded JSON, or nil. The returned error is of type SchemaErrors.
+func (s *Schema) Validate(v any) error {
+	sv := &schemaValidator{schema: s}
+	sv.validate(s.root, v, "", 0)
+	if len(sv.errs) == 0 {
+		return nil
+	}
+	return sv.errs
+}
+
+var schemaTypes = map[string]bool{
+	"null":    true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+	"number":  true,
+	"integer": true,
+	"string":  true,
+}
+
+// schemaValidator collects problems while validating a value against a schema
+type schemaValidator struct {
+	schema *Schema
+	errs   SchemaErrors
+}
+
+func (sv *schemaValidator) add(path string, format string, a ...any) {
+	sv.errs = append(sv.errs, &SchemaError{Path: path, Err: fmt.Errorf("%w: "+format, append([]any{ErrClaimsNotValid}, a...)...)})
+}
+
+// valid returns true if v matches schema, without collecting problems
+func (sv *schemaValidator) valid(schema, v any, path string, depth int) bool {
+	sub := &schemaValidator{schema: sv.schema}
+	sub.validate(schema, v, path, depth)
+	return len(sub.errs) == 0
+}
+
+func (sv *schemaValidator) validate(schema, v any, path string, depth int) {
+	if depth > maxSchemaDepth {
+		sv.add(path, "schema is nested too deep")
+		return
+	}
+	if b, ok := schema.(bool); ok {
+		if !b {
+			sv.add(path, "no value is allowed")
+		}
+		return
+	}
+	m, _ := schema.(map[string]any)
+
+	if ref, ok := m["$ref"].(string); ok {
+		// checked by NewSchema
+		refSchema, _ := sv.schema.resolve(ref)
+		sv.validate(refSchema, v, path, depth+1)
+	}
+
+	if t, ok := m["type"]; ok {
+		types, ok := t.([]any)
+		if !ok {
+			types = []any{t}
+		}
+		matched := false
+		for _, t := range types {
+			matched = matched || schemaTypeOf(t, v)
+		}
+		if !matched {
+			sv.add(path, "type is not %v", t)
+			return
+		}
+	}
+	if enum, ok := m["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			found = found || schemaEqual(e, v)
+		}
+		if !found {
+			sv.add(path, "value is not one of %v", enum)
+		}
+	}
+	if c, ok := m["const"]; ok && !schemaEqual(c, v) {
+		sv.add(path, "value is not %v", c)
+	}
+
+	switch value := v.(type) {
+	case string:
+		sv.validateString(m, value, path)
+	case map[string]any:
+		sv.validateObject(m, value, path, depth)
+	case []any:
+		sv.validateArray(m, value, path, depth)
+	default:
+		if n, ok := schemaNumber(v); ok {
+			sv.validateNumber(m, n, path)
+		}
+	}
+
+	if allOf, ok := m["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			sv.validate(sub, v, path, depth+1)
+		}
+	}
+	if anyOf, ok := m["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			matched = matched || sv.valid(sub, v, path, depth+1)
+		}
+		if !matched {
+			sv.add(path, "value matches none of anyOf")
+		}
+	}
+	if oneOf, ok := m["oneOf"].([]any); ok {
+		matched := 0
+		for _, sub := range oneOf {
+			if sv.valid(sub, v, path, depth+1) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			sv.add(path, "value matches %d of oneOf", matched)
+		}
+	}
+	if not, ok := m["not"]; ok && sv.valid(not, v, path, depth+1) {
+		sv.add(path, "value matches not")
+	}
+}
+
+func (sv *schemaValidator) validateString(m map[string]any, s, path string) {
+	length := float64(utf8.RuneCountInString(s))
+	if min, ok := schemaNumber(m["minLength"]); ok && length < min {
+		sv.add(path, "shorter than %v", min)
+	}
+	if max, ok := schemaNumber(m["maxLength"]); ok && length > max {
+		sv.add(path, "longer than %v", max)
+	}
+	if pattern, ok := m["pattern"].(string); ok && !sv.schema.patterns[pattern].MatchString(s) {
+		sv.add(path, "does not match %s", pattern)
+	}
+}
+
+func (sv *schemaValidator) validateNumber(m map[string]any, n float64, path string) {
+	if min, ok := schemaNumber(m["minimum"]); ok && n < min {
+		sv.add(path, "less than %v", min)
+	}
+	if max, ok := schemaNumber(m["maximum"]); ok && n > max {
+		sv.add(path, "greater than %v", max)
+	}
+	if min, ok := schemaNumber(m["exclusiveMinimum"]); ok && n <= min {
+		sv.add(path, "not greater than %v", min)
+	}
+	if max, ok := schemaNumber(m["exclusiveMaximum"]); ok && n >= max {
+		sv.add(path, "not less than %v", max)
+	}
+	if multiple, ok := schemaNumber(m["multipleOf"]); ok && multiple > 0 {
+		if q := n / multiple; q != math.Trunc(q) {
+			sv.add(path, "not a multiple of %v", multiple)
+		}
+	}
+}
+
+func (sv *schemaValidator) validateObject(m map[string]any, object map[string]any, path string, depth int) {
+	required, _ := m["required"].([]any)
+	for _, r := range required {
+		name, _ := r.(string)
+		if _, ok := object[name]; !ok {
+			sv.add(joinPath(path, name), "required claim is missing")
+		}
+	}
+	size := float64(len(object))
+	if min, ok := schemaNumber(m["minProperties"]); ok && size < min {
+		sv.add(path, "fewer than %v claims", min)
+	}
+	if max, ok := schemaNumber(m["maxProperties"]); ok && size > max {
+		sv.add(path, "more than %v claims", max)
+	}
+
+	properties, _ := m["properties"].(map[string]any)
+	patternProperties, _ := m["patternProperties"].(map[string]any)
+	additional, hasAdditional := m["additionalProperties"]
+
+	// sorted to report problems in the same order every time
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		claimPath := joinPath(path, name)
+		matched := false
+		if prop, ok := properties[name]; ok {
+			matched = true
+			sv.validate(prop, object[name], claimPath, depth+1)
+		}
+		for pattern, prop := range patternProperties {
+			if sv.schema.patterns[pattern].MatchString(name) {
+				matched = true
+				sv.validate(prop, object[name], claimPath, depth+1)
+			}
+		}
+		if !matched && hasAdditional {
+			sv.validate(additional, object[name], claimPath, depth+1)
+		}
+	}
+}
+
+func (sv *schemaValidator) validateArray(m map[string]any, array []any, path string, depth int) {
+	size := float64(len(array))
+	if min, ok := schemaNumber(m["minItems"]); ok && size < min {
+		sv.add(path, "fewer than %v items", min)
+	}
+	if max, ok := schemaNumber(m["maxItems"]); ok && size > max {
+		sv.add(path, "more than %v items", max)
+	}
+	if unique, _ := m["uniqueItems"].(bool); unique {
+		for i := range array {
+			for j := 0; j < i; j++ {
+				if schemaEqual(array[i], array[j]) {
+					sv.add(fmt.Sprintf("%s[%d]", path, i), "item is not unique")
+				}
+			}
+		}
+	}
+	if items, ok := m["items"]; ok {
+		for i, item := range array {
+			sv.validate(items, item, fmt.Sprintf("%s[%d]", path, i), depth+1)
+		}
+	}
+}
+
+// schemaTypeOf returns true if v is of the JSON Schema type t
+func schemaTypeOf(t, v any) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := schemaNumber(v)
+		return ok
+	case "integer":
+		n, ok := schemaNumber(v)
+		return ok && n == math.Trunc(n)
+	}
+	return false
+}
+
+// schemaNumber returns v as a float64 if it is a number
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// schemaEqual returns true if a and b are equal JSON values, numbers are compared by value
+func schemaEqual(a, b any) bool {
+	if x, ok := schemaNumber(a); ok {
+		y, ok := schemaNumber(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, ok := y[k]; !ok || !schemaEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !schemaEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,145 @@
+package gosdjwt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"required": ["vct", "given_name"],
+		"properties": {
+			"vct": {"const": "https://example.com/pid"},
+			"given_name": {"type": "string", "minLength": 1, "maxLength": 10},
+			"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+			"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+			"gender": {"enum": ["female", "male", "other"]},
+			"address": {"$ref": "#/$defs/address"},
+			"nationalities": {"type": "array", "items": {"type": "string"}, "minItems": 1, "uniqueItems": true},
+			"birthdate": {"anyOf": [{"type": "string"}, {"type": "null"}]},
+			"id": {"oneOf": [{"type": "string"}, {"type": "number"}]},
+			"nickname": {"not": {"const": "root"}}
+		},
+		"patternProperties": {"^x_": {"type": "boolean"}},
+		"$defs": {
+			"address": {
+				"type": "object",
+				"properties": {"country": {"type": "string"}},
+				"additionalProperties": false
+			}
+		}
+	}`))
+	assert.NoError(t, err)
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"vct":           "https://example.com/pid",
+			"given_name":    "John",
+			"age":           float64(42),
+			"email":         "john@example.com",
+			"gender":        "male",
+			"address":       map[string]any{"country": "SE"},
+			"nationalities": []any{"SE", "DK"},
+			"birthdate":     nil,
+			"id":            float64(1),
+			"nickname":      "johnny",
+			"x_verified":    true,
+		}
+	}
+
+	tts := []struct {
+		name  string
+		edit  func(claims map[string]any)
+		paths []string
+	}{
+		{name: "test 0 - valid", edit: func(claims map[string]any) {}},
+		{name: "test 1 - required", edit: func(claims map[string]any) { delete(claims, "given_name") }, paths: []string{"given_name"}},
+		{name: "test 2 - const", edit: func(claims map[string]any) { claims["vct"] = "other" }, paths: []string{"vct"}},
+		{name: "test 3 - type", edit: func(claims map[string]any) { claims["given_name"] = float64(1) }, paths: []string{"given_name"}},
+		{name: "test 4 - integer", edit: func(claims map[string]any) { claims["age"] = 4.2 }, paths: []string{"age"}},
+		{name: "test 5 - exclusive maximum", edit: func(claims map[string]any) { claims["age"] = float64(150) }, paths: []string{"age"}},
+		{name: "test 6 - max length", edit: func(claims map[string]any) { claims["given_name"] = "Johnjohnjohn" }, paths: []string{"given_name"}},
+		{name: "test 7 - pattern", edit: func(claims map[string]any) { claims["email"] = "john" }, paths: []string{"email"}},
+		{name: "test 8 - enum", edit: func(claims map[string]any) { claims["gender"] = "unknown" }, paths: []string{"gender"}},
+		{
+			name: "test 9 - additional properties of a $ref",
+			edit: func(claims map[string]any) {
+				claims["address"] = map[string]any{"country": "SE", "street": "Storgatan"}
+			},
+			paths: []string{"address.street"},
+		},
+		{
+			name:  "test 10 - items and unique items",
+			edit:  func(claims map[string]any) { claims["nationalities"] = []any{"SE", float64(1), "SE"} },
+			paths: []string{"nationalities[2]", "nationalities[1]"},
+		},
+		{name: "test 11 - min items", edit: func(claims map[string]any) { claims["nationalities"] = []any{} }, paths: []string{"nationalities"}},
+		{name: "test 12 - anyOf", edit: func(claims map[string]any) { claims["birthdate"] = true }, paths: []string{"birthdate"}},
+		{name: "test 13 - oneOf", edit: func(claims map[string]any) { claims["id"] = false }, paths: []string{"id"}},
+		{name: "test 14 - not", edit: func(claims map[string]any) { claims["nickname"] = "root" }, paths: []string{"nickname"}},
+		{name: "test 15 - pattern properties", edit: func(claims map[string]any) { claims["x_verified"] = "yes" }, paths: []string{"x_verified"}},
+		{name: "test 16 - unknown claims are allowed", edit: func(claims map[string]any) { claims["other"] = "claim" }},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.edit(claims)
+
+			err := schema.Validate(claims)
+			if tt.paths == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrClaimsNotValid)
+
+			var errs SchemaErrors
+			assert.True(t, errors.As(err, &errs))
+			paths := []string{}
+			for _, e := range errs {
+				paths = append(paths, e.Path)
+			}
+			assert.Equal(t, tt.paths, paths)
+		})
+	}
+}
+
+func TestParseSchemaNotValid(t *testing.T) {
+	tts := []struct {
+		name string
+		have string
+	}{
+		{name: "test 0 - not JSON", have: `{`},
+		{name: "test 1 - not an object", have: `"string"`},
+		{name: "test 2 - unknown type", have: `{"type": "date"}`},
+		{name: "test 3 - pattern", have: `{"properties": {"a": {"pattern": "("}}}`},
+		{name: "test 4 - $ref not found", have: `{"$ref": "#/$defs/missing"}`},
+		{name: "test 5 - remote $ref", have: `{"$ref": "https://example.com/schema.json"}`},
+		{name: "test 6 - empty allOf", have: `{"allOf": []}`},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSchema([]byte(tt.have))
+			assert.ErrorIs(t, err, ErrSchemaNotValid)
+		})
+	}
+}
+
+func TestSchemaRecursiveRef(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"properties": {"name": {"type": "string"}, "child": {"$ref": "#"}}
+	}`))
+	assert.NoError(t, err)
+
+	assert.NoError(t, schema.Validate(map[string]any{"name": "a", "child": map[string]any{"child": map[string]any{"name": "c"}}}))
+	assert.ErrorIs(t, schema.Validate(map[string]any{"child": map[string]any{"child": map[string]any{"name": false}}}), ErrClaimsNotValid)
+
+	loop, err := ParseSchema([]byte(`{"$ref": "#"}`))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, loop.Validate("a"), ErrClaimsNotValid)
+}
@@ -0,0 +1,135 @@
+package gosdjwt
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ClaimSDAlways is the sd of claim metadata for a claim that is always selective disclosable
+	ClaimSDAlways = "always"
+
+	// ClaimSDAllowed is the sd of claim metadata for a claim that the issuer may make selective disclosable
+	ClaimSDAllowed = "allowed"
+
+	// ClaimSDNever is the sd of claim metadata for a claim that is never selective disclosable
+	ClaimSDNever = "never"
+)
+
+var (
+	// ErrClaimSDAlways is returned when a claim with sd always in the type metadata is not selective disclosable
+	ErrClaimSDAlways = errors.New("claim must be selective disclosable by the type metadata")
+
+	// ErrClaimSDNever is returned when a claim with sd never in the type metadata is selective disclosable
+	ErrClaimSDNever = errors.New("claim can not be selective disclosable by the type metadata")
+
+	// ErrClaimSDNotValid is returned when the sd of claim metadata is not always, allowed or never
+	ErrClaimSDNotValid = errors.New("claim metadata sd is not valid")
+)
+
+// sdRules walks an instruction tree with the claim metadata of a type
+type sdRules struct {
+	t     *ResolvedType
+	apply bool
+	v     *validator
+}
+
+// CheckTypeMetadata returns the claims whose selective disclosure does not follow the sd of their claim metadata,
+// or nil. The returned error is of type InstructionErrors.
+func (i InstructionsV2) CheckTypeMetadata(t *ResolvedType) error {
+	w := &sdRules{t: t, v: &validator{}}
+	w.children(i, nil, "", false)
+	if len(w.v.errs) == 0 {
+		return nil
+	}
+	return w.v.errs
+}
+
+// ApplyTypeMetadata returns a copy of the instructions where claims with sd always are selective disclosable and
+// claims with sd never are not, claims with sd allowed keep their instructions. Instructions that can not follow
+// the type metadata, e.g. an always visible claim with sd always, are returned as InstructionErrors.
+func (i InstructionsV2) ApplyTypeMetadata(t *ResolvedType) (InstructionsV2, error) {
+	applied := InstructionsV2(cloneInstructions(i))
+
+	w := &sdRules{t: t, apply: true, v: &validator{}}
+	w.children(applied, nil, "", false)
+
+	if err := applied.CheckTypeMetadata(t); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// children walks the children of an object, recursive is true for the children of a RecursiveInstructionV2
+func (w *sdRules) children(children []Instruction, path []any, claimPath string, recursive bool) {
+	for _, child := range children {
+		if isNilInstruction(child) {
+			continue
+		}
+		name := child.name()
+		w.instruction(child, append(path[:len(path):len(path)], name), joinPath(claimPath, name), recursive)
+	}
+}
+
+func (w *sdRules) elements(elements []Instruction, path []any, claimPath string) {
+	for index, element := range elements {
+		if isNilInstruction(element) {
+			continue
+		}
+		w.instruction(element, append(path[:len(path):len(path)], index), fmt.Sprintf("%s[%d]", claimPath, index), false)
+	}
+}
+
+func (w *sdRules) instruction(instruction Instruction, path []any, claimPath string, recursive bool) {
+	rule := ""
+	if claim := w.t.Claim(path...); claim != nil {
+		rule = claim.SD
+	}
+
+	// sd is nil for a recursive parent, whose children are disclosed with it
+	sd, alwaysVisible := instruction.flags()
+	if children, elements := instruction.nested(); elements {
+		w.elements(children, path, claimPath)
+	} else {
+		w.children(children, path, claimPath, sd == nil)
+	}
+
+	switch rule {
+	case "", ClaimSDAllowed:
+		return
+	case ClaimSDAlways, ClaimSDNever:
+	default:
+		w.v.add(claimPath, fmt.Errorf("%w: %q", ErrClaimSDNotValid, rule))
+		return
+	}
+
+	if w.apply {
+		switch {
+		case sd == nil:
+		case rule == ClaimSDAlways && !recursive && !*alwaysVisible:
+			*sd = true
+		case rule == ClaimSDNever && recursive:
+			*sd, *alwaysVisible = false, true
+		case rule == ClaimSDNever:
+			*sd = false
+		}
+		return
+	}
+
+	// a recursive parent is always disclosed, and so are its children unless they are always visible
+	selectiveDisclosure := true
+	switch {
+	case sd == nil:
+	case recursive:
+		selectiveDisclosure = !*alwaysVisible
+	default:
+		selectiveDisclosure = instruction.isSelectiveDisclosure()
+	}
+
+	if rule == ClaimSDAlways && !selectiveDisclosure {
+		w.v.add(claimPath, ErrClaimSDAlways)
+	}
+	if rule == ClaimSDNever && selectiveDisclosure {
+		w.v.add(claimPath, ErrClaimSDNever)
+	}
+}
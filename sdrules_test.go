@@ -0,0 +1,187 @@
+package gosdjwt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var mockSDRulesType = &ResolvedType{
+	Types: []*TypeMetadata{
+		{
+			VCT: "https://example.com/pid",
+			Claims: []ClaimMetadata{
+				{Path: []any{"given_name"}, SD: ClaimSDAlways},
+				{Path: []any{"country"}, SD: ClaimSDNever},
+				{Path: []any{"address", "street"}, SD: ClaimSDAlways},
+				{Path: []any{"address", "country"}, SD: ClaimSDNever},
+				{Path: []any{"nationalities", nil}, SD: ClaimSDAlways},
+				{Path: []any{"email"}, SD: ClaimSDAllowed},
+			},
+		},
+	},
+}
+
+func TestCheckTypeMetadata(t *testing.T) {
+	tts := []struct {
+		name  string
+		have  InstructionsV2
+		paths []string
+	}{
+		{
+			name: "test 0 - follows the type metadata",
+			have: InstructionsV2{
+				&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+				&ChildInstructionV2{Name: "country", Value: "SE"},
+				&ChildInstructionV2{Name: "email", Value: "john@example.com"},
+				&ParentInstructionV2{Name: "address", Children: []Instruction{
+					&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+					&ChildInstructionV2{Name: "country", Value: "SE"},
+				}},
+				&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{
+					&ChildInstructionV2{Value: "SE", SelectiveDisclosure: true},
+				}},
+			},
+		},
+		{
+			name: "test 1 - always and never broken",
+			have: InstructionsV2{
+				&ChildInstructionV2{Name: "given_name", Value: "John"},
+				&ChildInstructionV2{Name: "country", Value: "SE", SelectiveDisclosure: true},
+				&ParentInstructionV2{Name: "address", Children: []Instruction{
+					&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+				}},
+				&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{
+					&ChildInstructionV2{Value: "SE", SelectiveDisclosure: true},
+					&ChildInstructionV2{Value: "DK"},
+				}},
+			},
+			paths: []string{"given_name", "country", "address.street", "nationalities[1]"},
+		},
+		{
+			name: "test 2 - children of a recursive parent",
+			have: InstructionsV2{
+				&RecursiveInstructionV2{Name: "address", Children: []Instruction{
+					&ChildInstructionV2{Name: "street", Value: "Storgatan 1", AlwaysVisible: true},
+					&ChildInstructionV2{Name: "country", Value: "SE"},
+				}},
+			},
+			paths: []string{"address.street", "address.country"},
+		},
+		{
+			name: "test 3 - recursive parent is never visible",
+			have: InstructionsV2{
+				&RecursiveInstructionV2{Name: "country", Value: "SE"},
+			},
+			paths: []string{"country"},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.have.CheckTypeMetadata(mockSDRulesType)
+			if tt.paths == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			errs, ok := err.(InstructionErrors)
+			assert.True(t, ok)
+			paths := []string{}
+			for _, e := range errs {
+				paths = append(paths, e.Path)
+			}
+			assert.Equal(t, tt.paths, paths)
+		})
+	}
+}
+
+func TestApplyTypeMetadata(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John"},
+		&ChildInstructionV2{Name: "country", Value: "SE", SelectiveDisclosure: true},
+		&ChildInstructionV2{Name: "email", Value: "john@example.com", SelectiveDisclosure: true},
+		&RecursiveInstructionV2{Name: "address", Children: []Instruction{
+			&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+			&ChildInstructionV2{Name: "country", Value: "SE"},
+		}},
+		&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{
+			&ChildInstructionV2{Value: "SE"},
+		}},
+	}
+
+	applied, err := instructions.ApplyTypeMetadata(mockSDRulesType)
+	assert.NoError(t, err)
+	assert.NoError(t, applied.CheckTypeMetadata(mockSDRulesType))
+	assert.NoError(t, applied.Validate())
+
+	assert.Equal(t, InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ChildInstructionV2{Name: "country", Value: "SE"},
+		&ChildInstructionV2{Name: "email", Value: "john@example.com", SelectiveDisclosure: true},
+		&RecursiveInstructionV2{Name: "address", Children: []Instruction{
+			&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+			&ChildInstructionV2{Name: "country", Value: "SE", AlwaysVisible: true},
+		}},
+		&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{
+			&ChildInstructionV2{Value: "SE", SelectiveDisclosure: true},
+		}},
+	}, applied)
+
+	assert.False(t, instructions[0].(*ChildInstructionV2).SelectiveDisclosure, "instructions are not changed")
+
+	t.Run("selective disclosable child of a recursive parent with sd never", func(t *testing.T) {
+		applied, err := InstructionsV2{
+			&RecursiveInstructionV2{Name: "address", Children: []Instruction{
+				&ChildInstructionV2{Name: "country", Value: "SE", SelectiveDisclosure: true},
+			}},
+		}.ApplyTypeMetadata(mockSDRulesType)
+		assert.NoError(t, err)
+		assert.NoError(t, applied.Validate())
+
+		country := applied[0].(*RecursiveInstructionV2).Children[0].(*ChildInstructionV2)
+		assert.True(t, country.AlwaysVisible)
+		assert.False(t, country.SelectiveDisclosure)
+	})
+
+	t.Run("always visible claim with sd always", func(t *testing.T) {
+		_, err := InstructionsV2{
+			&ChildInstructionV2{Name: "given_name", Value: "John", AlwaysVisible: true},
+		}.ApplyTypeMetadata(mockSDRulesType)
+		assert.ErrorIs(t, err, ErrClaimSDAlways)
+	})
+
+	t.Run("sd that is not valid", func(t *testing.T) {
+		_, err := InstructionsV2{
+			&ChildInstructionV2{Name: "given_name", Value: "John"},
+		}.ApplyTypeMetadata(&ResolvedType{Types: []*TypeMetadata{{Claims: []ClaimMetadata{{Path: []any{"given_name"}, SD: "sometimes"}}}}})
+		assert.ErrorIs(t, err, ErrClaimSDNotValid)
+	})
+}
+
+func TestSDJWTVCTypeMetadata(t *testing.T) {
+	resolved, err := mockTypeMetadataResolver().Resolve(context.Background(), "https://example.com/pid", "")
+	assert.NoError(t, err)
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ParentInstructionV2{Name: "address", Children: []Instruction{
+			&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+		}},
+	}
+	vc := VC{VCT: "https://example.com/pid", Issuer: "https://example.com", TypeMetadata: resolved}
+
+	_, err = instructions.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+	assert.ErrorIs(t, err, ErrClaimSDAlways, "address.street is sd always in the extended type")
+
+	applied, err := instructions.ApplyTypeMetadata(resolved)
+	assert.NoError(t, err)
+	_, err = applied.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	vc.VCT = "https://example.com/identity"
+	_, err = applied.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+	assert.ErrorIs(t, err, ErrVCClaimNotValid)
+}
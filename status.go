@@ -0,0 +1,238 @@
+package gosdjwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrStatusClaimNotValid is returned when the status claim of a credential is not a status list reference
+	ErrStatusClaimNotValid = errors.New("status claim is not valid")
+
+	// ErrStatusListFetch is returned when a status list token can not be fetched
+	ErrStatusListFetch = errors.New("status list token can not be fetched")
+
+	// ErrStatusListTokenNotValid is returned when a status list token does not match the reference
+	ErrStatusListTokenNotValid = errors.New("status list token is not valid")
+)
+
+// maxStatusListTokenSize limits the size of a fetched status list token
+const maxStatusListTokenSize = 10 << 20
+
+// StatusListFetcher returns the status list token published at uri
+type StatusListFetcher interface {
+	Fetch(ctx context.Context, uri string) (string, error)
+}
+
+// HTTPStatusListFetcher fetches status list tokens over HTTP
+type HTTPStatusListFetcher struct {
+	// Client is used for the requests, http.DefaultClient is used if nil
+	Client *http.Client
+}
+
+// Fetch returns the status list token published at uri
+func (f *HTTPStatusListFetcher) Fetch(ctx context.Context, uri string) (string, error) {
+	b, err := httpGet(ctx, f.Client, uri, "application/"+TypeStatusListJWT, maxStatusListTokenSize)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrStatusListFetch, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// StatusResult is the status of a credential in its status list
+type StatusResult struct {
+	URI    string
+	Index  int
+	Status uint8
+}
+
+// Valid returns true if the credential is neither revoked nor suspended
+func (s *StatusResult) Valid() bool {
+	return s.Status == StatusValid
+}
+
+// String returns valid, invalid, suspended, or the hex value of an application specific status
+func (s *StatusResult) String() string {
+	switch s.Status {
+	case StatusValid:
+		return "valid"
+	case StatusInvalid:
+		return "invalid"
+	case StatusSuspended:
+		return "suspended"
+	}
+	return fmt.Sprintf("0x%02x", s.Status)
+}
+
+// cachedStatusList is a verified status list and when it has to be fetched again
+type cachedStatusList struct {
+	list    *StatusList
+	expires time.Time
+}
+
+// StatusChecker looks up the status of credentials in their status list.
+// Status list tokens are cached until their ttl has passed or they expire, whichever is first, a token
+// without ttl and exp is fetched every time. It is safe for concurrent use, the zero value is ready to use.
+type StatusChecker struct {
+	// Fetcher fetches the status list tokens, a HTTPStatusListFetcher is used if nil
+	Fetcher StatusListFetcher
+
+	// Key verifies the signature of status list tokens, a string is used as a HMAC secret
+	Key any
+
+	// MaxSize is the largest number of statuses in a status list, DefaultStatusListMaxSize is used if zero
+	MaxSize int
+
+	now   func() time.Time
+	mu    sync.Mutex
+	cache map[string]cachedStatusList
+}
+
+// NewStatusChecker returns a status checker that fetches status list tokens with fetcher and verifies them with key
+func NewStatusChecker(fetcher StatusListFetcher, key any) *StatusChecker {
+	return &StatusChecker{
+		Fetcher: fetcher,
+		Key:     key,
+		now:     time.Now,
+		cache:   map[string]cachedStatusList{},
+	}
+}
+
+// statusReference returns the idx and uri of the status_list in a status claim
+func statusReference(status any) (int, string, error) {
+	s, ok := status.(map[string]any)
+	if !ok {
+		return 0, "", ErrStatusClaimNotValid
+	}
+	ref, ok := s["status_list"].(map[string]any)
+	if !ok {
+		return 0, "", fmt.Errorf("%w: status_list is missing", ErrStatusClaimNotValid)
+	}
+	idx, ok := ref["idx"].(float64)
+	if !ok || idx < 0 || idx != float64(int(idx)) {
+		return 0, "", fmt.Errorf("%w: idx", ErrStatusClaimNotValid)
+	}
+	uri, ok := ref["uri"].(string)
+	if !ok || uri == "" {
+		return 0, "", fmt.Errorf("%w: uri", ErrStatusClaimNotValid)
+	}
+	return int(idx), uri, nil
+}
+
+// Check returns the status of the credential with the status claim, nil is returned if there is no status claim
+func (c *StatusChecker) Check(ctx context.Context, claims map[string]any) (*StatusResult, error) {
+	status, ok := claims["status"]
+	if !ok {
+		return nil, nil
+	}
+	idx, uri, err := statusReference(status)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := c.statusList(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := list.Get(idx)
+	if err != nil {
+		return nil, err
+	}
+	return &StatusResult{URI: uri, Index: idx, Status: value}, nil
+}
+
+// clock returns the current time
+func (c *StatusChecker) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// statusList returns the status list at uri, from the cache if it is still fresh
+func (c *StatusChecker) statusList(ctx context.Context, uri string) (*StatusList, error) {
+	now := c.clock()
+
+	c.mu.Lock()
+	cached, ok := c.cache[uri]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.list, nil
+	}
+
+	var fetcher StatusListFetcher = &HTTPStatusListFetcher{}
+	if c.Fetcher != nil {
+		fetcher = c.Fetcher
+	}
+	token, err := fetcher.Fetch(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	list, expires, err := c.parseStatusListToken(token, uri, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if !expires.IsZero() {
+		c.mu.Lock()
+		if c.cache == nil {
+			c.cache = map[string]cachedStatusList{}
+		}
+		c.cache[uri] = cachedStatusList{list: list, expires: expires}
+		c.mu.Unlock()
+	}
+	return list, nil
+}
+
+// parseStatusListToken verifies a status list token and returns its status list and when it has to be fetched again
+func (c *StatusChecker) parseStatusListToken(token, uri string, now time.Time) (*StatusList, time.Time, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithTimeFunc(c.clock))
+	parsed, err := parser.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return keyOf(c.Key), nil
+	})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: %s", ErrStatusListTokenNotValid, err)
+	}
+
+	if typ, _ := parsed.Header["typ"].(string); typ != TypeStatusListJWT {
+		return nil, time.Time{}, fmt.Errorf("%w: typ %q", ErrStatusListTokenNotValid, typ)
+	}
+	if sub, _ := claims["sub"].(string); sub != uri {
+		return nil, time.Time{}, fmt.Errorf("%w: sub %q does not match %q", ErrStatusListTokenNotValid, sub, uri)
+	}
+
+	statusList, ok := claims["status_list"].(map[string]any)
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("%w: status_list is missing", ErrStatusListTokenNotValid)
+	}
+	bits, _ := statusList["bits"].(float64)
+	lst, _ := statusList["lst"].(string)
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultStatusListMaxSize
+	}
+	list, err := decodeStatusList(uri, int(bits), lst, maxSize)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var expires time.Time
+	if ttl, ok := claims["ttl"].(float64); ok && ttl > 0 {
+		expires = now.Add(time.Duration(ttl) * time.Second)
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		if expires.IsZero() || exp.Time.Before(expires) {
+			expires = exp.Time
+		}
+	}
+	return list, expires, nil
+}
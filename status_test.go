@@ -0,0 +1,263 @@
+package gosdjwt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockStatusListServer serves the token returned by token, and counts the requests
+type mockStatusListServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newMockStatusListServer(t *testing.T, token func(uri string) string) *mockStatusListServer {
+	s := &mockStatusListServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		assert.Equal(t, "application/statuslist+jwt", r.Header.Get("Accept"))
+		if r.URL.Path != "/statuslists/1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/statuslist+jwt")
+		w.Write([]byte(token(s.URL + r.URL.Path)))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func mockStatusListToken(t *testing.T, list *StatusList, token StatusListToken, key string) string {
+	signed, err := list.Token(token, jwt.SigningMethodHS256, key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func TestVerifierStatus(t *testing.T) {
+	var list *StatusList
+	server := newMockStatusListServer(t, func(uri string) string {
+		return mockStatusListToken(t, list, StatusListToken{}, "status-key")
+	})
+
+	list, err := NewStatusList(server.URL+"/statuslists/1", 2, 16)
+	assert.NoError(t, err)
+	assert.NoError(t, list.Set(1, StatusInvalid))
+	assert.NoError(t, list.Set(2, StatusSuspended))
+	assert.NoError(t, list.Set(3, 3))
+
+	verifier := &Verifier{
+		Key:           "mura",
+		VC:            true,
+		StatusChecker: NewStatusChecker(&HTTPStatusListFetcher{}, "status-key"),
+	}
+
+	tts := []struct {
+		name      string
+		idx       int
+		want      string
+		wantValid bool
+	}{
+		{name: "valid", idx: 0, want: "valid", wantValid: true},
+		{name: "revoked", idx: 1, want: "invalid"},
+		{name: "suspended", idx: 2, want: "suspended"},
+		{name: "application specific", idx: 3, want: "0x03"},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			vc := VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer, Status: list.Reference(tt.idx)}
+			sdjwt, err := InstructionsV2{}.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+			assert.NoError(t, err)
+
+			_, validation, err := verifier.Verify(context.Background(), mockVCPresentation(sdjwt))
+			assert.NoError(t, err)
+			assert.Equal(t, &StatusResult{URI: list.URI, Index: tt.idx, Status: validation.Status.Status}, validation.Status)
+			assert.Equal(t, tt.want, validation.Status.String())
+			assert.Equal(t, tt.wantValid, validation.Status.Valid())
+		})
+	}
+
+	t.Run("no status claim", func(t *testing.T) {
+		sdjwt, err := InstructionsV2{}.SDJWTVC(VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer}, jwt.SigningMethodHS256, "mura")
+		assert.NoError(t, err)
+
+		_, validation, err := verifier.Verify(context.Background(), mockVCPresentation(sdjwt))
+		assert.NoError(t, err)
+		assert.Nil(t, validation.Status)
+	})
+}
+
+func TestStatusCheckerZeroValue(t *testing.T) {
+	var list *StatusList
+	server := newMockStatusListServer(t, func(uri string) string {
+		return mockStatusListToken(t, list, StatusListToken{TTL: time.Minute}, "status-key")
+	})
+
+	list, err := NewStatusList(server.URL+"/statuslists/1", 1, 8)
+	assert.NoError(t, err)
+	assert.NoError(t, list.Set(1, StatusInvalid))
+
+	checker := &StatusChecker{Key: "status-key"}
+	claims := map[string]any{"status": map[string]any{
+		"status_list": map[string]any{"idx": float64(1), "uri": list.URI},
+	}}
+	for i := 0; i < 2; i++ {
+		result, err := checker.Check(context.Background(), claims)
+		assert.NoError(t, err)
+		if assert.NotNil(t, result) {
+			assert.Equal(t, StatusInvalid, result.Status)
+		}
+	}
+	assert.Equal(t, int32(1), server.requests.Load())
+}
+
+func TestStatusCheckerCache(t *testing.T) {
+	now := time.Unix(1686920170, 0)
+
+	tts := []struct {
+		name         string
+		token        func(issued time.Time) StatusListToken
+		after        time.Duration
+		wantRequests int32
+	}{
+		{
+			name:         "within ttl",
+			token:        func(issued time.Time) StatusListToken { return StatusListToken{IssuedAt: issued, TTL: time.Minute} },
+			after:        59 * time.Second,
+			wantRequests: 1,
+		},
+		{
+			name:         "after ttl",
+			token:        func(issued time.Time) StatusListToken { return StatusListToken{IssuedAt: issued, TTL: time.Minute} },
+			after:        61 * time.Second,
+			wantRequests: 2,
+		},
+		{
+			name: "exp before ttl",
+			token: func(issued time.Time) StatusListToken {
+				return StatusListToken{IssuedAt: issued, TTL: time.Hour, ExpiresAt: issued.Add(30 * time.Second)}
+			},
+			after:        31 * time.Second,
+			wantRequests: 2,
+		},
+		{
+			name:         "without ttl and exp",
+			token:        func(issued time.Time) StatusListToken { return StatusListToken{IssuedAt: issued} },
+			after:        time.Second,
+			wantRequests: 2,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			var list *StatusList
+			clock := now
+			server := newMockStatusListServer(t, func(uri string) string {
+				return mockStatusListToken(t, list, tt.token(clock), "status-key")
+			})
+			list, err := NewStatusList(server.URL+"/statuslists/1", 1, 8)
+			assert.NoError(t, err)
+
+			checker := NewStatusChecker(&HTTPStatusListFetcher{Client: server.Client()}, "status-key")
+			checker.now = func() time.Time { return clock }
+
+			claims := map[string]any{"status": map[string]any{
+				"status_list": map[string]any{"idx": float64(0), "uri": list.URI},
+			}}
+
+			_, err = checker.Check(context.Background(), claims)
+			assert.NoError(t, err)
+
+			clock = now.Add(tt.after)
+			_, err = checker.Check(context.Background(), claims)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.wantRequests, server.requests.Load())
+		})
+	}
+}
+
+func TestStatusCheckerErrors(t *testing.T) {
+	var (
+		list  *StatusList
+		token func(uri string) string
+	)
+	server := newMockStatusListServer(t, func(uri string) string {
+		return token(uri)
+	})
+	list, err := NewStatusList(server.URL+"/statuslists/1", 1, 8)
+	assert.NoError(t, err)
+
+	other, err := NewStatusList(server.URL+"/statuslists/2", 1, 8)
+	assert.NoError(t, err)
+
+	tts := []struct {
+		name   string
+		token  func(uri string) string
+		status any
+		want   error
+	}{
+		{
+			name:   "status claim without status_list",
+			status: map[string]any{"other": true},
+			want:   ErrStatusClaimNotValid,
+		},
+		{
+			name:   "not found",
+			status: map[string]any{"status_list": map[string]any{"idx": float64(0), "uri": server.URL + "/statuslists/2"}},
+			want:   ErrStatusListFetch,
+		},
+		{
+			name: "signed with another key",
+			token: func(uri string) string {
+				return mockStatusListToken(t, list, StatusListToken{}, "other-key")
+			},
+			want: ErrStatusListTokenNotValid,
+		},
+		{
+			name: "sub does not match",
+			token: func(uri string) string {
+				return mockStatusListToken(t, other, StatusListToken{}, "status-key")
+			},
+			want: ErrStatusListTokenNotValid,
+		},
+		{
+			name: "not a status list token",
+			token: func(uri string) string {
+				signed, err := sign(jwt.MapClaims{"sub": uri}, nil, jwt.SigningMethodHS256, []byte("status-key"))
+				assert.NoError(t, err)
+				return signed
+			},
+			want: ErrStatusListTokenNotValid,
+		},
+		{
+			name: "index outside of the status list",
+			token: func(uri string) string {
+				return mockStatusListToken(t, list, StatusListToken{}, "status-key")
+			},
+			status: map[string]any{"status_list": map[string]any{"idx": float64(8), "uri": list.URI}},
+			want:   ErrStatusListIndexNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			token = tt.token
+			status := tt.status
+			if status == nil {
+				status = map[string]any{"status_list": map[string]any{"idx": float64(0), "uri": list.URI}}
+			}
+
+			checker := NewStatusChecker(&HTTPStatusListFetcher{}, "status-key")
+			_, err := checker.Check(context.Background(), map[string]any{"status": status})
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
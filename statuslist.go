@@ -0,0 +1,345 @@
+package gosdjwt
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// StatusValid is the status of a valid credential
+	StatusValid uint8 = 0x00
+
+	// StatusInvalid is the status of a revoked credential
+	StatusInvalid uint8 = 0x01
+
+	// StatusSuspended is the status of a suspended credential
+	StatusSuspended uint8 = 0x02
+
+	// TypeStatusListJWT is the typ header of a status list token
+	TypeStatusListJWT = "statuslist+jwt"
+
+	// DefaultStatusListMaxSize is the largest number of statuses in a decoded status list, unless configured otherwise
+	DefaultStatusListMaxSize = 1 << 24
+)
+
+var (
+	// ErrStatusListBitsNotValid is returned when the number of bits per status is not 1, 2, 4 or 8
+	ErrStatusListBitsNotValid = errors.New("status list bits must be 1, 2, 4 or 8")
+
+	// ErrStatusListIndexNotValid is returned when an index is outside of the status list
+	ErrStatusListIndexNotValid = errors.New("status list index is not valid")
+
+	// ErrStatusListFull is returned when there is no index left to allocate
+	ErrStatusListFull = errors.New("status list is full")
+
+	// ErrStatusNotValid is returned when a status does not fit in the bits of the status list
+	ErrStatusNotValid = errors.New("status does not fit in the status list bits")
+
+	// ErrStatusListNotValid is returned when an encoded status list can not be decoded
+	ErrStatusListNotValid = errors.New("status list is not valid")
+)
+
+// StatusList is a Token Status List, a compressed array of statuses where each credential has an index.
+// It is safe for concurrent use.
+type StatusList struct {
+	// URI is where the status list token is published, used as sub and in references
+	URI string
+
+	mu       sync.Mutex
+	bits     int
+	size     int
+	statuses []byte
+
+	// allocated is made on the first Allocate, a status list that is only read never needs it
+	allocated []bool
+	free      int
+}
+
+// NewStatusList returns a status list with room for size statuses of bits each, all valid
+func NewStatusList(uri string, bits, size int) (*StatusList, error) {
+	if err := checkStatusListBits(bits); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: size %d", ErrStatusListIndexNotValid, size)
+	}
+	return &StatusList{
+		URI:      uri,
+		bits:     bits,
+		size:     size,
+		statuses: make([]byte, (size*bits+7)/8),
+	}, nil
+}
+
+func checkStatusListBits(bits int) error {
+	switch bits {
+	case 1, 2, 4, 8:
+		return nil
+	}
+	return fmt.Errorf("%w: %d", ErrStatusListBitsNotValid, bits)
+}
+
+// Bits returns the number of bits per status
+func (s *StatusList) Bits() int {
+	return s.bits
+}
+
+// Size returns the number of statuses in the list
+func (s *StatusList) Size() int {
+	return s.size
+}
+
+// Allocate returns a random unused index for a new credential, random indexes keep credentials issued
+// close in time from sharing neighbouring indexes
+func (s *StatusList) Allocate() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.allocation()
+	if s.free == 0 {
+		return 0, ErrStatusListFull
+	}
+
+	start, err := rand.Int(rand.Reader, big.NewInt(int64(s.size)))
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < s.size; i++ {
+		idx := (int(start.Int64()) + i) % s.size
+		if !s.allocated[idx] {
+			s.allocated[idx] = true
+			s.free--
+			return idx, nil
+		}
+	}
+	return 0, ErrStatusListFull
+}
+
+// allocation makes the allocation state if there is none, where an index with a status other than valid is allocated
+func (s *StatusList) allocation() {
+	if s.allocated != nil {
+		return
+	}
+	s.allocated = make([]bool, s.size)
+	s.free = s.size
+	for idx := 0; idx < s.size; idx++ {
+		if s.get(idx) != StatusValid {
+			s.allocated[idx] = true
+			s.free--
+		}
+	}
+}
+
+// EncodeAllocation returns the allocated indexes as a compressed and base64url encoded 1 bit array, to persist the
+// allocation state together with the statuses, see RestoreAllocation
+func (s *StatusList) EncodeAllocation() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.allocation()
+	bitmap := make([]byte, (s.size+7)/8)
+	for idx, allocated := range s.allocated {
+		if allocated {
+			bitmap[idx/8] |= 1 << uint(idx%8)
+		}
+	}
+	return compressStatuses(bitmap)
+}
+
+// RestoreAllocation marks the indexes of an EncodeAllocation of the status list as allocated, in addition to the
+// indexes with a status other than valid
+func (s *StatusList) RestoreAllocation(encoded string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bitmap, err := decompressStatuses(encoded, (s.size+7)/8)
+	if err != nil {
+		return err
+	}
+	if len(bitmap) != (s.size+7)/8 {
+		return fmt.Errorf("%w: allocation is not of %d indexes", ErrStatusListNotValid, s.size)
+	}
+
+	s.allocation()
+	for idx := 0; idx < s.size; idx++ {
+		if bitmap[idx/8]&(1<<uint(idx%8)) != 0 && !s.allocated[idx] {
+			s.allocated[idx] = true
+			s.free--
+		}
+	}
+	return nil
+}
+
+// Set sets the status of the credential at idx
+func (s *StatusList) Set(idx int, status uint8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if idx < 0 || idx >= s.size {
+		return fmt.Errorf("%w: %d", ErrStatusListIndexNotValid, idx)
+	}
+	if int(status) >= 1<<s.bits {
+		return fmt.Errorf("%w: %d", ErrStatusNotValid, status)
+	}
+
+	byteIdx, shift := idx*s.bits/8, uint(idx*s.bits%8)
+	mask := byte((1<<s.bits)-1) << shift
+	s.statuses[byteIdx] = s.statuses[byteIdx]&^mask | status<<shift
+	return nil
+}
+
+// Get returns the status of the credential at idx
+func (s *StatusList) Get(idx int) (uint8, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if idx < 0 || idx >= s.size {
+		return 0, fmt.Errorf("%w: %d", ErrStatusListIndexNotValid, idx)
+	}
+	return s.get(idx), nil
+}
+
+func (s *StatusList) get(idx int) uint8 {
+	byteIdx, shift := idx*s.bits/8, uint(idx*s.bits%8)
+	return (s.statuses[byteIdx] >> shift) & byte((1<<s.bits)-1)
+}
+
+// Reference returns the status claim of the credential at idx, e.g. for VC.Status
+func (s *StatusList) Reference(idx int) map[string]any {
+	return map[string]any{
+		"status_list": map[string]any{
+			"idx": idx,
+			"uri": s.URI,
+		},
+	}
+}
+
+// Encode returns the statuses compressed with DEFLATE in the ZLIB format and base64url encoded, the lst claim
+func (s *StatusList) Encode() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return compressStatuses(s.statuses)
+}
+
+func compressStatuses(b []byte) (string, error) {
+	buf := &bytes.Buffer{}
+	w, err := zlib.NewWriterLevel(buf, zlib.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(b); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decompressStatuses decodes and decompresses lst, a decompressed array larger than max bytes is not valid
+func decompressStatuses(lst string, max int) ([]byte, error) {
+	compressed, err := base64.RawURLEncoding.DecodeString(lst)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrStatusListNotValid, err)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrStatusListNotValid, err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrStatusListNotValid, err)
+	}
+	if len(b) > max {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrStatusListNotValid, max)
+	}
+	return b, nil
+}
+
+// DecodeStatusList returns the status list of an encoded lst claim with bits per status, a list of more than
+// DefaultStatusListMaxSize statuses is not valid. Indexes with a status other than valid are allocated, see
+// RestoreAllocation for the allocation of indexes that are still valid.
+func DecodeStatusList(uri string, bits int, lst string) (*StatusList, error) {
+	return decodeStatusList(uri, bits, lst, DefaultStatusListMaxSize)
+}
+
+// decodeStatusList is DecodeStatusList where a list of more than maxSize statuses is not valid
+func decodeStatusList(uri string, bits int, lst string, maxSize int) (*StatusList, error) {
+	if err := checkStatusListBits(bits); err != nil {
+		return nil, err
+	}
+	statuses, err := decompressStatuses(lst, (maxSize*bits+7)/8)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatusList{
+		URI:      uri,
+		bits:     bits,
+		size:     len(statuses) * 8 / bits,
+		statuses: statuses,
+	}, nil
+}
+
+// StatusListToken holds the optional claims and header of a status list token
+type StatusListToken struct {
+	// IssuedAt is the iat claim, now is used if zero
+	IssuedAt time.Time
+
+	// ExpiresAt is the optional exp claim
+	ExpiresAt time.Time
+
+	// TTL is the optional ttl claim, how long the token can be cached
+	TTL time.Duration
+
+	// Header is added to the JOSE header, its Type is replaced by statuslist+jwt
+	Header Header
+}
+
+// Token returns a signed status list token.
+// signingKey is the private key of signingMethod, a string is used as a HMAC secret.
+func (s *StatusList) Token(token StatusListToken, signingMethod jwt.SigningMethod, signingKey any) (string, error) {
+	lst, err := s.Encode()
+	if err != nil {
+		return "", err
+	}
+
+	if token.IssuedAt.IsZero() {
+		token.IssuedAt = time.Now()
+	}
+	claims := jwt.MapClaims{
+		"sub": s.URI,
+		"iat": token.IssuedAt.Unix(),
+		"status_list": map[string]any{
+			"bits": s.bits,
+			"lst":  lst,
+		},
+	}
+	if !token.ExpiresAt.IsZero() {
+		claims["exp"] = token.ExpiresAt.Unix()
+	}
+	if token.TTL > 0 {
+		claims["ttl"] = int64(token.TTL.Seconds())
+	}
+
+	header := token.Header
+	header.Type = TypeStatusListJWT
+	params, err := header.params()
+	if err != nil {
+		return "", err
+	}
+
+	return sign(claims, params, signingMethod, keyOf(signingKey))
+}
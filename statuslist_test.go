@@ -0,0 +1,234 @@
+package gosdjwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusListEncodeDecode(t *testing.T) {
+	tts := []struct {
+		name     string
+		bits     int
+		statuses []uint8
+		want     string
+	}{
+		{
+			name:     "test 0 - 1 bit",
+			bits:     1,
+			statuses: []uint8{1, 0, 0, 1, 1, 1, 0, 1, 1, 1, 0, 0, 0, 1, 0, 1},
+			want:     "eNrbuRgAAhcBXQ",
+		},
+		{
+			name:     "test 1 - 2 bits",
+			bits:     2,
+			statuses: []uint8{1, 2, 0, 3, 0, 1, 0, 1, 1, 2, 3, 3},
+			want:     "eNo76fITAAPfAgc",
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := NewStatusList("https://example.com/statuslists/1", tt.bits, len(tt.statuses))
+			assert.NoError(t, err)
+			for idx, status := range tt.statuses {
+				assert.NoError(t, list.Set(idx, status))
+			}
+
+			encoded, err := list.Encode()
+			assert.NoError(t, err)
+
+			// compressed output differs between zlib implementations, so both the example from the
+			// specification and the own encoding are decoded
+			for _, lst := range []string{tt.want, encoded} {
+				decoded, err := DecodeStatusList(list.URI, tt.bits, lst)
+				assert.NoError(t, err)
+				for idx, want := range tt.statuses {
+					status, err := decoded.Get(idx)
+					assert.NoError(t, err)
+					assert.Equal(t, want, status)
+				}
+			}
+		})
+	}
+
+	_, err := DecodeStatusList("https://example.com/statuslists/1", 1, "not zlib")
+	assert.ErrorIs(t, err, ErrStatusListNotValid)
+}
+
+func TestStatusListSet(t *testing.T) {
+	for _, bits := range []int{1, 2, 4, 8} {
+		list, err := NewStatusList("https://example.com/statuslists/1", bits, 10)
+		assert.NoError(t, err)
+
+		max := uint8(1<<bits - 1)
+		assert.NoError(t, list.Set(3, max))
+		assert.NoError(t, list.Set(4, StatusValid))
+
+		got, err := list.Get(3)
+		assert.NoError(t, err)
+		assert.Equal(t, max, got)
+
+		got, err = list.Get(2)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusValid, got)
+
+		if bits < 8 {
+			assert.ErrorIs(t, list.Set(3, max+1), ErrStatusNotValid)
+		}
+		assert.ErrorIs(t, list.Set(10, StatusInvalid), ErrStatusListIndexNotValid)
+		_, err = list.Get(-1)
+		assert.ErrorIs(t, err, ErrStatusListIndexNotValid)
+	}
+
+	_, err := NewStatusList("https://example.com/statuslists/1", 3, 10)
+	assert.ErrorIs(t, err, ErrStatusListBitsNotValid)
+}
+
+func TestStatusListAllocate(t *testing.T) {
+	list, err := NewStatusList("https://example.com/statuslists/1", 1, 16)
+	assert.NoError(t, err)
+
+	allocated := map[int]bool{}
+	for i := 0; i < list.Size(); i++ {
+		idx, err := list.Allocate()
+		assert.NoError(t, err)
+		assert.False(t, allocated[idx])
+		allocated[idx] = true
+	}
+
+	_, err = list.Allocate()
+	assert.ErrorIs(t, err, ErrStatusListFull)
+}
+
+func TestStatusListDecodeAllocated(t *testing.T) {
+	list, err := NewStatusList("https://example.com/statuslists/1", 2, 16)
+	assert.NoError(t, err)
+	for idx := 0; idx < list.Size(); idx++ {
+		if idx != 5 {
+			assert.NoError(t, list.Set(idx, StatusSuspended))
+		}
+	}
+	lst, err := list.Encode()
+	assert.NoError(t, err)
+
+	decoded, err := DecodeStatusList(list.URI, 2, lst)
+	assert.NoError(t, err)
+	assert.Nil(t, decoded.allocated)
+
+	idx, err := decoded.Allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, idx)
+
+	_, err = decoded.Allocate()
+	assert.ErrorIs(t, err, ErrStatusListFull)
+}
+
+func TestStatusListRestoreAllocation(t *testing.T) {
+	list, err := NewStatusList("https://example.com/statuslists/1", 1, 16)
+	assert.NoError(t, err)
+
+	allocated := map[int]bool{}
+	for i := 0; i < 10; i++ {
+		idx, err := list.Allocate()
+		assert.NoError(t, err)
+		allocated[idx] = true
+	}
+
+	lst, err := list.Encode()
+	assert.NoError(t, err)
+	allocation, err := list.EncodeAllocation()
+	assert.NoError(t, err)
+
+	restored, err := DecodeStatusList(list.URI, 1, lst)
+	assert.NoError(t, err)
+	assert.NoError(t, restored.RestoreAllocation(allocation))
+
+	for i := 10; i < restored.Size(); i++ {
+		idx, err := restored.Allocate()
+		assert.NoError(t, err)
+		assert.False(t, allocated[idx])
+		allocated[idx] = true
+	}
+	_, err = restored.Allocate()
+	assert.ErrorIs(t, err, ErrStatusListFull)
+
+	small, err := NewStatusList(list.URI, 1, 8)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, small.RestoreAllocation(allocation), ErrStatusListNotValid)
+}
+
+func TestStatusListDecodeMaxSize(t *testing.T) {
+	list, err := NewStatusList("https://example.com/statuslists/1", 1, 1<<16)
+	assert.NoError(t, err)
+	lst, err := list.Encode()
+	assert.NoError(t, err)
+
+	_, err = decodeStatusList(list.URI, 1, lst, 1<<16)
+	assert.NoError(t, err)
+
+	_, err = decodeStatusList(list.URI, 1, lst, 1<<16-8)
+	assert.ErrorIs(t, err, ErrStatusListNotValid)
+}
+
+func TestStatusListToken(t *testing.T) {
+	list, err := NewStatusList("https://example.com/statuslists/1", 2, 16)
+	assert.NoError(t, err)
+
+	idx, err := list.Allocate()
+	assert.NoError(t, err)
+	assert.NoError(t, list.Set(idx, StatusSuspended))
+
+	issuedAt := time.Unix(1686920170, 0)
+	token, err := list.Token(StatusListToken{
+		IssuedAt:  issuedAt,
+		ExpiresAt: issuedAt.Add(time.Hour),
+		TTL:       10 * time.Minute,
+		Header:    Header{KeyID: "key-1"},
+	}, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	parsed, err := jwt.NewParser(jwt.WithTimeFunc(func() time.Time { return issuedAt })).ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return []byte("mura"), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, TypeStatusListJWT, parsed.Header["typ"])
+	assert.Equal(t, "key-1", parsed.Header["kid"])
+
+	lst, err := list.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, jwt.MapClaims{
+		"sub": "https://example.com/statuslists/1",
+		"iat": float64(1686920170),
+		"exp": float64(1686923770),
+		"ttl": float64(600),
+		"status_list": map[string]any{
+			"bits": float64(2),
+			"lst":  lst,
+		},
+	}, claims)
+}
+
+func TestStatusListReference(t *testing.T) {
+	list, err := NewStatusList("https://example.com/statuslists/1", 1, 8)
+	assert.NoError(t, err)
+
+	idx, err := list.Allocate()
+	assert.NoError(t, err)
+
+	vc := VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer, Status: list.Reference(idx)}
+	sdjwt, err := InstructionsV2{}.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	claims, _, err := VerifyVC(mockVCPresentation(sdjwt), "mura")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"status_list": map[string]any{
+			"idx": float64(idx),
+			"uri": "https://example.com/statuslists/1",
+		},
+	}, claims["status"])
+}
@@ -0,0 +1,381 @@
+package gosdjwt
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// TagName is the struct tag used by ConvertStruct2SDJWT
+	TagName = "sdjwt"
+
+	// TagSelectiveDisclosure makes a field selective disclosable, on slices each element is selective disclosable
+	TagSelectiveDisclosure = "sd"
+
+	// TagRecursive makes a struct or map field recursive selective disclosable
+	TagRecursive = "recursive"
+
+	// TagElements makes each element of a slice field selective disclosable
+	TagElements = "elements"
+
+	// TagAlways makes a field always visible
+	TagAlways = "always"
+)
+
+var (
+	// ErrStructTagNotValid is returned when a sdjwt struct tag can not be applied to a field
+	ErrStructTagNotValid = errors.New("sdjwt struct tag is not valid")
+
+	// ErrNotAStruct is returned when the value to convert is not a struct
+	ErrNotAStruct = errors.New("value is not a struct")
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// fieldTag is the parsed sdjwt struct tag of a field
+type fieldTag struct {
+	sd        bool
+	recursive bool
+	elements  bool
+	always    bool
+}
+
+func parseFieldTag(tag, path string) (fieldTag, error) {
+	ft := fieldTag{}
+	if tag == "" {
+		return ft, nil
+	}
+	for _, option := range strings.Split(tag, ",") {
+		switch strings.TrimSpace(option) {
+		case TagSelectiveDisclosure:
+			ft.sd = true
+		case TagRecursive:
+			ft.recursive = true
+		case TagElements:
+			ft.elements = true
+		case TagAlways:
+			ft.always = true
+		case "":
+		default:
+			return ft, fmt.Errorf("%w: %s: unknown option %q", ErrStructTagNotValid, path, option)
+		}
+	}
+	if ft.always && (ft.sd || ft.recursive || ft.elements) {
+		return ft, fmt.Errorf("%w: %s: %q can not be combined with other options", ErrStructTagNotValid, path, TagAlways)
+	}
+	return ft, nil
+}
+
+// ConvertStruct2SDJWT converts an annotated struct to a SDJWT.
+//
+// Claim names are taken from the json struct tag, and fields tagged `json:"-"` or `sdjwt:"-"` are skipped.
+// The sdjwt struct tag takes a comma separated list of options:
+//
+//	sd         the field is selective disclosable, on a slice each element is selective disclosable
+//	recursive  the struct or map is selective disclosable and so are all of its children, on a slice each element is recursive
+//	elements   each element of the slice is selective disclosable
+//	always     the field is always visible, also within a recursive parent
+//
+// Nested structs and maps become objects and slices become arrays, also as elements of a slice.
+// Nil pointers are left out, except as slice elements where they become null, and map keys are sorted.
+func ConvertStruct2SDJWT(v any) (InstructionsV2, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, ErrNotAStruct
+		}
+		rv = rv.Elem()
+	}
+
+	var (
+		children []Instruction
+		err      error
+	)
+	switch rv.Kind() {
+	case reflect.Struct:
+		children, err = convertStructFields(rv, "", false)
+	case reflect.Map:
+		children, err = convertMapEntries(rv, "", false)
+	default:
+		return nil, ErrNotAStruct
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return InstructionsV2(children), nil
+}
+
+func convertStructFields(rv reflect.Value, path string, inRecursive bool) ([]Instruction, error) {
+	children := []Instruction{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		sdjwtTag := field.Tag.Get(TagName)
+		if sdjwtTag == "-" {
+			continue
+		}
+
+		name, omitEmpty, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		fv := rv.Field(i)
+
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := fv
+			for embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() {
+					break
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				embeddedChildren, err := convertStructFields(embedded, path, inRecursive)
+				if err != nil {
+					return nil, err
+				}
+				children = append(children, embeddedChildren...)
+				continue
+			}
+		}
+
+		if omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		claimPath := joinPath(path, name)
+		tag, err := parseFieldTag(sdjwtTag, claimPath)
+		if err != nil {
+			return nil, err
+		}
+
+		child, ok, err := convertField(name, fv, tag, claimPath, inRecursive)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			children = append(children, child)
+		}
+	}
+	return children, nil
+}
+
+func convertMapEntries(rv reflect.Value, path string, inRecursive bool) ([]Instruction, error) {
+	if rv.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("%w: %s: map keys must be strings", ErrStructTagNotValid, path)
+	}
+
+	keys := []string{}
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+
+	children := []Instruction{}
+	for _, key := range keys {
+		claimPath := joinPath(path, key)
+		child, ok, err := convertField(key, rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())), fieldTag{}, claimPath, inRecursive)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			children = append(children, child)
+		}
+	}
+	return children, nil
+}
+
+// convertField converts one field to an instruction, false is returned if the field should be left out
+func convertField(name string, fv reflect.Value, tag fieldTag, path string, inRecursive bool) (Instruction, bool, error) {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil, false, nil
+		}
+		fv = fv.Elem()
+	}
+
+	alwaysVisible := inRecursive && tag.always
+
+	switch {
+	case isObject(fv):
+		recursive := (inRecursive || tag.recursive) && !tag.always
+		if tag.elements {
+			return nil, false, fmt.Errorf("%w: %s: %q is only valid for slices", ErrStructTagNotValid, path, TagElements)
+		}
+
+		var (
+			children []Instruction
+			err      error
+		)
+		if fv.Kind() == reflect.Struct {
+			children, err = convertStructFields(fv, path, recursive)
+		} else {
+			children, err = convertMapEntries(fv, path, recursive)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		if recursive {
+			return &RecursiveInstructionV2{
+				Name:     name,
+				Children: children,
+			}, true, nil
+		}
+		return &ParentInstructionV2{
+			Name:                name,
+			SelectiveDisclosure: tag.sd,
+			AlwaysVisible:       alwaysVisible,
+			Children:            children,
+		}, true, nil
+
+	case isArray(fv):
+		if tag.recursive && !hasObjectElements(fv.Type()) {
+			return nil, false, fmt.Errorf("%w: %s: %q is only valid for slices of structs or maps", ErrStructTagNotValid, path, TagRecursive)
+		}
+
+		array := &ChildArrayInstructionV2{
+			Name:          name,
+			AlwaysVisible: alwaysVisible,
+		}
+		elementTag := fieldTag{sd: tag.sd || tag.elements, recursive: tag.recursive}
+		for i := 0; i < fv.Len(); i++ {
+			child, ok, err := convertField("", fv.Index(i), elementTag, fmt.Sprintf("%s[%d]", path, i), false)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				child = &ChildInstructionV2{SelectiveDisclosure: elementTag.sd}
+			}
+			array.Children = append(array.Children, child)
+		}
+		return array, true, nil
+
+	default:
+		if tag.recursive || tag.elements {
+			return nil, false, fmt.Errorf("%w: %s: option is not valid for %s", ErrStructTagNotValid, path, fv.Kind())
+		}
+		value, err := jsonValue(fv)
+		if err != nil {
+			return nil, false, err
+		}
+		return &ChildInstructionV2{
+			Name:                name,
+			Value:               value,
+			SelectiveDisclosure: (inRecursive || tag.sd) && !alwaysVisible,
+			AlwaysVisible:       alwaysVisible,
+		}, true, nil
+	}
+}
+
+// jsonFieldName returns the claim name of a field from its json struct tag
+func jsonFieldName(field reflect.StructField) (string, bool, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	omitEmpty := false
+	for _, option := range strings.Split(options, ",") {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
+
+// isEmptyValue follows the omitempty rules of encoding/json
+func isEmptyValue(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return fv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return fv.IsNil()
+	case reflect.Struct:
+		return false
+	}
+	return fv.IsZero()
+}
+
+func implementsMarshaler(fv reflect.Value) bool {
+	t := fv.Type()
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+// hasObjectElements returns true if the elements of a slice type can be encoded as objects
+func hasObjectElements(t reflect.Type) bool {
+	elem := t.Elem()
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Interface || isObject(reflect.Zero(elem))
+}
+
+// isObject returns true if the value is encoded as a JSON object with claims of its own
+func isObject(fv reflect.Value) bool {
+	if implementsMarshaler(fv) {
+		return false
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		return true
+	case reflect.Map:
+		return fv.Type().Key().Kind() == reflect.String
+	}
+	return false
+}
+
+// isArray returns true if the value is encoded as a JSON array
+func isArray(fv reflect.Value) bool {
+	if implementsMarshaler(fv) {
+		return false
+	}
+	switch fv.Kind() {
+	case reflect.Slice:
+		return fv.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Array:
+		return true
+	}
+	return false
+}
+
+// jsonValue returns the value as it will be represented in JSON, basic kinds are kept as is
+func jsonValue(fv reflect.Value) (any, error) {
+	switch fv.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if !implementsMarshaler(fv) {
+			return fv.Interface(), nil
+		}
+	}
+
+	b, err := json.Marshal(fv.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
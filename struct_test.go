@@ -0,0 +1,261 @@
+package gosdjwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAddress struct {
+	Street string `json:"street" sdjwt:"sd"`
+	City   string `json:"city"`
+}
+
+type mockCredential struct {
+	ISS           string            `json:"iss" sdjwt:"always"`
+	GivenName     string            `json:"given_name" sdjwt:"sd"`
+	FamilyName    *string           `json:"family_name,omitempty" sdjwt:"sd"`
+	Address       mockAddress       `json:"address"`
+	Place         *mockAddress      `json:"place_of_birth" sdjwt:"recursive"`
+	Nationalities []string          `json:"nationalities" sdjwt:"elements"`
+	Extra         map[string]string `json:"extra,omitempty"`
+	Issued        time.Time         `json:"issued"`
+	Internal      string            `json:"-"`
+	Skipped       string            `json:"skipped" sdjwt:"-"`
+}
+
+func TestConvertStruct2SDJWT(t *testing.T) {
+	tts := []struct {
+		name string
+		have any
+		want InstructionsV2
+	}{
+		{
+			name: "test 0 - all field kinds",
+			have: &mockCredential{
+				ISS:       "https://example.com",
+				GivenName: "John",
+				Address: mockAddress{
+					Street: "Storgatan 1",
+					City:   "Stockholm",
+				},
+				Place: &mockAddress{
+					Street: "Kungsgatan 2",
+					City:   "Uppsala",
+				},
+				Nationalities: []string{"SE", "DK"},
+				Extra: map[string]string{
+					"b": "2",
+					"a": "1",
+				},
+				Issued:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Internal: "secret",
+				Skipped:  "skipped",
+			},
+			want: InstructionsV2{
+				&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+				&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+				&ParentInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+						&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+					},
+				},
+				&RecursiveInstructionV2{
+					Name: "place_of_birth",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Kungsgatan 2", SelectiveDisclosure: true},
+						&ChildInstructionV2{Name: "city", Value: "Uppsala", SelectiveDisclosure: true},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "SE", SelectiveDisclosure: true},
+						&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+					},
+				},
+				&ParentInstructionV2{
+					Name: "extra",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "a", Value: "1"},
+						&ChildInstructionV2{Name: "b", Value: "2"},
+					},
+				},
+				&ChildInstructionV2{Name: "issued", Value: "2024-01-02T03:04:05Z"},
+			},
+		},
+		{
+			name: "test 1 - nil pointers and empty values",
+			have: mockCredential{},
+			want: InstructionsV2{
+				&ChildInstructionV2{Name: "iss", Value: ""},
+				&ChildInstructionV2{Name: "given_name", Value: "", SelectiveDisclosure: true},
+				&ParentInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "", SelectiveDisclosure: true},
+						&ChildInstructionV2{Name: "city", Value: ""},
+					},
+				},
+				&ChildArrayInstructionV2{Name: "nationalities"},
+				&ChildInstructionV2{Name: "issued", Value: "0001-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name: "test 2 - map",
+			have: map[string]any{
+				"b": 1,
+				"a": []int{1, 2},
+			},
+			want: InstructionsV2{
+				&ChildArrayInstructionV2{
+					Name: "a",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: 1},
+						&ChildInstructionV2{Value: 2},
+					},
+				},
+				&ChildInstructionV2{Name: "b", Value: 1},
+			},
+		},
+		{
+			name: "test 3 - slices of structs and nested slices",
+			have: struct {
+				Addresses []*mockAddress `json:"addresses" sdjwt:"sd"`
+				Places    []mockAddress  `json:"places" sdjwt:"recursive"`
+				Matrix    [][]string     `json:"matrix"`
+			}{
+				Addresses: []*mockAddress{{Street: "Storgatan 1", City: "Stockholm"}, nil},
+				Places:    []mockAddress{{Street: "Kungsgatan 2", City: "Uppsala"}},
+				Matrix:    [][]string{{"a", "b"}},
+			},
+			want: InstructionsV2{
+				&ChildArrayInstructionV2{
+					Name: "addresses",
+					Children: []Instruction{
+						&ParentInstructionV2{
+							SelectiveDisclosure: true,
+							Children: []Instruction{
+								&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+								&ChildInstructionV2{Name: "city", Value: "Stockholm"},
+							},
+						},
+						&ChildInstructionV2{SelectiveDisclosure: true},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Name: "places",
+					Children: []Instruction{
+						&RecursiveInstructionV2{
+							Children: []Instruction{
+								&ChildInstructionV2{Name: "street", Value: "Kungsgatan 2", SelectiveDisclosure: true},
+								&ChildInstructionV2{Name: "city", Value: "Uppsala", SelectiveDisclosure: true},
+							},
+						},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Name: "matrix",
+					Children: []Instruction{
+						&ChildArrayInstructionV2{
+							Children: []Instruction{
+								&ChildInstructionV2{Value: "a"},
+								&ChildInstructionV2{Value: "b"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertStruct2SDJWT(tt.have)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConvertStruct2SDJWTErrors(t *testing.T) {
+	tts := []struct {
+		name string
+		have any
+		want error
+	}{
+		{
+			name: "not a struct",
+			have: "test",
+			want: ErrNotAStruct,
+		},
+		{
+			name: "unknown option",
+			have: struct {
+				A string `json:"a" sdjwt:"unknown"`
+			}{},
+			want: ErrStructTagNotValid,
+		},
+		{
+			name: "always combined with sd",
+			have: struct {
+				A string `json:"a" sdjwt:"sd,always"`
+			}{},
+			want: ErrStructTagNotValid,
+		},
+		{
+			name: "elements on a string",
+			have: struct {
+				A string `json:"a" sdjwt:"elements"`
+			}{},
+			want: ErrStructTagNotValid,
+		},
+		{
+			name: "recursive on a slice",
+			have: struct {
+				A []string `json:"a" sdjwt:"recursive"`
+			}{},
+			want: ErrStructTagNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConvertStruct2SDJWT(tt.have)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestConvertStruct2SDJWTRoundTrip(t *testing.T) {
+	credential := &mockCredential{
+		ISS:       "https://example.com",
+		GivenName: "John",
+		Address: mockAddress{
+			Street: "Storgatan 1",
+			City:   "Stockholm",
+		},
+		Place: &mockAddress{
+			Street: "Kungsgatan 2",
+			City:   "Uppsala",
+		},
+		Nationalities: []string{"FI", "NO"},
+	}
+
+	instructions, err := ConvertStruct2SDJWT(credential)
+	assert.NoError(t, err)
+
+	sdjwt, err := instructions.SDJWT(jwt.SigningMethodHS256, "test-key")
+	assert.NoError(t, err)
+
+	claims, _, err := Verify(sdjwt.String(), "test-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "John", claims["given_name"])
+	assert.Equal(t, map[string]any{"street": "Storgatan 1", "city": "Stockholm"}, claims["address"])
+	assert.Equal(t, map[string]any{"street": "Kungsgatan 2", "city": "Uppsala"}, claims["place_of_birth"])
+	assert.Equal(t, []any{"FI", "NO"}, claims["nationalities"])
+}
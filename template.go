@@ -0,0 +1,308 @@
+package gosdjwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	// PlaceholderTypeString accepts a string value
+	PlaceholderTypeString = "string"
+
+	// PlaceholderTypeNumber accepts a number value
+	PlaceholderTypeNumber = "number"
+
+	// PlaceholderTypeBoolean accepts a boolean value
+	PlaceholderTypeBoolean = "boolean"
+
+	// PlaceholderTypeObject accepts an object value
+	PlaceholderTypeObject = "object"
+
+	// PlaceholderTypeArray accepts an array value
+	PlaceholderTypeArray = "array"
+)
+
+var (
+	// ErrTemplateNotValid is returned when a template can not be compiled
+	ErrTemplateNotValid = errors.New("template is not valid")
+
+	// ErrTemplateValueMissing is returned when a required value is not bound
+	ErrTemplateValueMissing = errors.New("template value is missing")
+
+	// ErrTemplateValueType is returned when a bound value does not match the type of its placeholder
+	ErrTemplateValueType = errors.New("template value has the wrong type")
+
+	// ErrTemplateValueNotExpected is returned for a value with no placeholder in the template, e.g. a claim the
+	// template does not have or an array value beyond the elements of the template
+	ErrTemplateValueNotExpected = errors.New("template value has no placeholder in the template")
+)
+
+// Placeholder is the value of a template claim that is bound at issuance.
+// An empty Type accepts any value, Optional claims are left out when no value is bound.
+type Placeholder struct {
+	Type     string
+	Optional bool
+
+	// rule is the rule of a placeholder made by CompileRulesTemplate, the bound value is converted with it as
+	// ConvertJSON2SDJWT does
+	rule any
+}
+
+// Template is a compiled instruction tree where the values of placeholders are bound per issuance.
+// The tree is validated and copied when compiled, changes to the instructions afterwards do not affect the template.
+type Template struct {
+	instructions InstructionsV2
+}
+
+// CompileTemplate compiles instructions into a template.
+// A ChildInstructionV2 with a Placeholder, or *Placeholder, value is bound from the value with the same path,
+// any other value is kept as it is.
+func CompileTemplate(instructions InstructionsV2) (*Template, error) {
+	if err := instructions.Validate(); err != nil {
+		return nil, err
+	}
+	v := &validator{}
+	checkPlaceholders(instructions, "", false, v)
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+	return &Template{instructions: cloneInstructions(instructions)}, nil
+}
+
+// CompileRulesTemplate compiles a rules document, as used by ConvertJSON2SDJWT, into a template.
+// Every claim in the rules becomes a required placeholder of any type, where a RuleParent key makes an object.
+// A bound value is converted with the rule of its claim as ConvertJSON2SDJWT does, e.g. an array bound to a
+// RuleSelectiveDisclosure claim has a disclosure for every element and not one for the array.
+// Rules for array elements are not supported.
+func CompileRulesTemplate(rules map[string]any) (*Template, error) {
+	document, err := rulesDocument(rules, "")
+	if err != nil {
+		return nil, err
+	}
+	instructions, err := ConvertJSON2SDJWT(document, rules)
+	if err != nil {
+		return nil, err
+	}
+	return CompileTemplate(instructions)
+}
+
+// rulesDocument builds a document with a placeholder for every claim in rules
+func rulesDocument(rules map[string]any, path string) (map[string]any, error) {
+	document := map[string]any{}
+	for name, rule := range rules {
+		if name == RuleParent {
+			continue
+		}
+		claimPath := joinPath(path, name)
+		switch r := rule.(type) {
+		case string:
+			document[name] = Placeholder{rule: r}
+		case map[string]any:
+			children, err := rulesDocument(r, claimPath)
+			if err != nil {
+				return nil, err
+			}
+			document[name] = children
+		default:
+			return nil, fmt.Errorf("%w: %s: only string and object rules are supported", ErrTemplateNotValid, claimPath)
+		}
+	}
+	return document, nil
+}
+
+// checkPlaceholders adds a problem for every placeholder with an unknown type, elements is true for array elements
+func checkPlaceholders(instructions []Instruction, path string, elements bool, v *validator) {
+	for index, instruction := range instructions {
+		claimPath := joinPath(path, instruction.name())
+		if elements {
+			claimPath = fmt.Sprintf("%s[%d]", path, index)
+		}
+		children, childElements := instruction.nested()
+		checkPlaceholders(children, claimPath, childElements, v)
+
+		child, ok := instruction.(*ChildInstructionV2)
+		if !ok {
+			continue
+		}
+		p, ok := placeholderOf(child.Value)
+		if !ok {
+			continue
+		}
+		switch p.Type {
+		case "", PlaceholderTypeString, PlaceholderTypeNumber, PlaceholderTypeBoolean, PlaceholderTypeObject, PlaceholderTypeArray:
+		default:
+			v.add(claimPath, fmt.Errorf("%w: unknown placeholder type %q", ErrTemplateNotValid, p.Type))
+		}
+	}
+}
+
+func placeholderOf(value any) (Placeholder, bool) {
+	switch p := value.(type) {
+	case Placeholder:
+		return p, true
+	case *Placeholder:
+		if p != nil {
+			return *p, true
+		}
+	}
+	return Placeholder{}, false
+}
+
+// Bind returns a new instruction tree with the placeholders replaced by values, which is a map[string]any or a
+// struct encoded with encoding/json. Numbers are bound as json.Number to keep their precision. All missing,
+// mistyped and unexpected values are returned as InstructionErrors.
+func (t *Template) Bind(values any) (InstructionsV2, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	document := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("%w: values must be an object", ErrTemplateValueType)
+	}
+
+	v := &validator{}
+	instructions := InstructionsV2(bindChildren(t.instructions, document, "", false, v))
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+	return instructions, nil
+}
+
+// bindChildren binds the children of an object from values, recursive is true for the children of a recursive
+// parent. A value without a child is a problem.
+func bindChildren(children []Instruction, values map[string]any, path string, recursive bool, v *validator) []Instruction {
+	bound := []Instruction{}
+	names := map[string]bool{}
+	for _, child := range children {
+		names[child.name()] = true
+		value, ok := values[child.name()]
+		if instruction, ok := child.bind(boundValue{value: value, ok: ok}, joinPath(path, child.name()), recursive, v); ok {
+			bound = append(bound, instruction)
+		}
+	}
+
+	unexpected := []string{}
+	for name := range values {
+		if !names[name] {
+			unexpected = append(unexpected, name)
+		}
+	}
+	slices.Sort(unexpected)
+	for _, name := range unexpected {
+		v.add(joinPath(path, name), ErrTemplateValueNotExpected)
+	}
+	return bound
+}
+
+// bindElements binds the elements of an array from values, a value without an element is a problem
+func bindElements(elements []Instruction, values []any, path string, v *validator) []Instruction {
+	bound := []Instruction{}
+	for index, element := range elements {
+		value := boundValue{}
+		if index < len(values) {
+			value = boundValue{value: values[index], ok: true}
+		}
+		if instruction, ok := element.bind(value, fmt.Sprintf("%s[%d]", path, index), false, v); ok {
+			bound = append(bound, instruction)
+		}
+	}
+	for index := len(elements); index < len(values); index++ {
+		v.add(fmt.Sprintf("%s[%d]", path, index), ErrTemplateValueNotExpected)
+	}
+	return bound
+}
+
+// boundValue is the value at the path of an instruction, ok is false if there is none
+type boundValue struct {
+	value any
+	ok    bool
+}
+
+func (p *ParentInstructionV2) bind(value boundValue, path string, recursive bool, v *validator) (Instruction, bool) {
+	values, ok := value.value.(map[string]any)
+	if value.ok && !ok {
+		v.add(path, fmt.Errorf("%w: want %s", ErrTemplateValueType, PlaceholderTypeObject))
+	}
+	bound := p.clone().(*ParentInstructionV2)
+	bound.Children = bindChildren(p.Children, values, path, false, v)
+	return bound, true
+}
+
+func (r *RecursiveInstructionV2) bind(value boundValue, path string, recursive bool, v *validator) (Instruction, bool) {
+	values, ok := value.value.(map[string]any)
+	if value.ok && !ok {
+		v.add(path, fmt.Errorf("%w: want %s", ErrTemplateValueType, PlaceholderTypeObject))
+	}
+	bound := r.clone().(*RecursiveInstructionV2)
+	bound.Children = bindChildren(r.Children, values, path, true, v)
+	return bound, true
+}
+
+func (c *ChildArrayInstructionV2) bind(value boundValue, path string, recursive bool, v *validator) (Instruction, bool) {
+	values, ok := value.value.([]any)
+	if value.ok && !ok {
+		v.add(path, fmt.Errorf("%w: want %s", ErrTemplateValueType, PlaceholderTypeArray))
+	}
+	bound := c.clone().(*ChildArrayInstructionV2)
+	bound.Children = bindElements(c.Children, values, path, v)
+	return bound, true
+}
+
+func (c *ChildInstructionV2) bind(value boundValue, path string, recursive bool, v *validator) (Instruction, bool) {
+	p, ok := placeholderOf(c.Value)
+	if !ok {
+		if value.ok {
+			v.add(path, ErrTemplateValueNotExpected)
+		}
+		return c.clone(), true
+	}
+	if !value.ok || value.value == nil {
+		if !p.Optional {
+			v.add(path, ErrTemplateValueMissing)
+		}
+		return nil, false
+	}
+	if !p.accepts(value.value) {
+		v.add(path, fmt.Errorf("%w: want %s", ErrTemplateValueType, p.Type))
+		return nil, false
+	}
+	if p.rule != nil {
+		instruction, err := convertClaim(c.Name, value.value, p.rule, path, recursive)
+		if err != nil {
+			v.add(path, err)
+			return nil, false
+		}
+		return instruction, true
+	}
+	bound := c.clone().(*ChildInstructionV2)
+	bound.Value = value.value
+	return bound, true
+}
+
+// accepts returns true if the JSON decoded value is of the placeholder type
+func (p Placeholder) accepts(value any) bool {
+	switch p.Type {
+	case PlaceholderTypeString:
+		_, ok := value.(string)
+		return ok
+	case PlaceholderTypeNumber:
+		_, ok := value.(json.Number)
+		return ok
+	case PlaceholderTypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case PlaceholderTypeObject:
+		_, ok := value.(map[string]any)
+		return ok
+	case PlaceholderTypeArray:
+		_, ok := value.([]any)
+		return ok
+	}
+	return true
+}
@@ -0,0 +1,330 @@
+package gosdjwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var mockTemplateInstructions = InstructionsV2{
+	&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+	&ChildInstructionV2{Name: "given_name", Value: Placeholder{Type: PlaceholderTypeString}, SelectiveDisclosure: true},
+	&ChildInstructionV2{Name: "age", Value: &Placeholder{Type: PlaceholderTypeNumber, Optional: true}, SelectiveDisclosure: true},
+	&ParentInstructionV2{
+		Name: "address",
+		Children: []Instruction{
+			&ChildInstructionV2{Name: "street", Value: Placeholder{}, SelectiveDisclosure: true},
+		},
+	},
+	&ChildArrayInstructionV2{
+		Name: "nationalities",
+		Children: []Instruction{
+			&ChildInstructionV2{Value: Placeholder{Type: PlaceholderTypeString}, SelectiveDisclosure: true},
+		},
+	},
+}
+
+type mockTemplateValues struct {
+	GivenName     string            `json:"given_name"`
+	Age           int               `json:"age,omitempty"`
+	Address       map[string]string `json:"address"`
+	Nationalities []string          `json:"nationalities"`
+}
+
+func TestTemplateBind(t *testing.T) {
+	tts := []struct {
+		name string
+		have any
+		want InstructionsV2
+	}{
+		{
+			name: "test 0 - map",
+			have: map[string]any{
+				"given_name":    "John",
+				"age":           42,
+				"address":       map[string]any{"street": "Storgatan 1"},
+				"nationalities": []any{"SE"},
+			},
+			want: InstructionsV2{
+				&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+				&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+				&ChildInstructionV2{Name: "age", Value: json.Number("42"), SelectiveDisclosure: true},
+				&ParentInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "SE", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+		{
+			name: "test 1 - struct without optional value",
+			have: mockTemplateValues{
+				GivenName:     "Jane",
+				Address:       map[string]string{"street": "Kungsgatan 2"},
+				Nationalities: []string{"DK"},
+			},
+			want: InstructionsV2{
+				&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+				&ChildInstructionV2{Name: "given_name", Value: "Jane", SelectiveDisclosure: true},
+				&ParentInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Kungsgatan 2", SelectiveDisclosure: true},
+					},
+				},
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+					},
+				},
+			},
+		},
+	}
+
+	template, err := CompileTemplate(mockTemplateInstructions)
+	assert.NoError(t, err)
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := template.Bind(tt.have)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplateBindIsReusable(t *testing.T) {
+	template, err := CompileTemplate(mockTemplateInstructions)
+	assert.NoError(t, err)
+
+	for _, name := range []string{"John", "Jane"} {
+		instructions, err := template.Bind(map[string]any{
+			"given_name":    name,
+			"address":       map[string]any{"street": "Storgatan 1"},
+			"nationalities": []any{"SE"},
+		})
+		assert.NoError(t, err)
+
+		presentation := mockPresentation(t, instructions, "mura", "given_name")
+		claims, _, err := Verify(presentation, "mura")
+		assert.NoError(t, err)
+		assert.Equal(t, name, claims["given_name"])
+	}
+
+	given := mockTemplateInstructions[1].(*ChildInstructionV2)
+	assert.Empty(t, given.ClaimHash)
+	assert.Equal(t, Placeholder{Type: PlaceholderTypeString}, given.Value)
+}
+
+func TestTemplateBindErrors(t *testing.T) {
+	template, err := CompileTemplate(mockTemplateInstructions)
+	assert.NoError(t, err)
+
+	_, err = template.Bind(map[string]any{
+		"age":           "42",
+		"address":       "Storgatan 1",
+		"nationalities": []any{1},
+	})
+
+	var got InstructionErrors
+	assert.True(t, errors.As(err, &got))
+	assert.Equal(t, []string{"given_name", "age", "address", "address.street", "nationalities[0]"}, instructionErrorPaths(got))
+	assert.ErrorIs(t, err, ErrTemplateValueMissing)
+	assert.ErrorIs(t, err, ErrTemplateValueType)
+
+	_, err = template.Bind("not an object")
+	assert.ErrorIs(t, err, ErrTemplateValueType)
+
+	t.Run("more array values than elements", func(t *testing.T) {
+		_, err := template.Bind(map[string]any{
+			"given_name":    "John",
+			"address":       map[string]any{"street": "Storgatan 1"},
+			"nationalities": []any{"SE", "DK", "NO"},
+		})
+
+		var got InstructionErrors
+		assert.True(t, errors.As(err, &got))
+		assert.Equal(t, []string{"nationalities[1]", "nationalities[2]"}, instructionErrorPaths(got))
+		assert.ErrorIs(t, err, ErrTemplateValueNotExpected)
+	})
+
+	t.Run("values without a placeholder", func(t *testing.T) {
+		_, err := template.Bind(map[string]any{
+			"iss":           "https://other.example.com",
+			"given_name":    "John",
+			"family_name":   "Doe",
+			"address":       map[string]any{"street": "Storgatan 1", "city": "Stockholm"},
+			"nationalities": []any{"SE"},
+		})
+
+		var got InstructionErrors
+		assert.True(t, errors.As(err, &got))
+		assert.Equal(t, []string{"iss", "address.city", "family_name"}, instructionErrorPaths(got))
+		assert.ErrorIs(t, err, ErrTemplateValueNotExpected)
+	})
+}
+
+func TestTemplateBindLargeNumber(t *testing.T) {
+	template, err := CompileTemplate(mockTemplateInstructions)
+	assert.NoError(t, err)
+
+	instructions, err := template.Bind(map[string]any{
+		"given_name":    "John",
+		"age":           int64(1<<53 + 1),
+		"address":       map[string]any{"street": "Storgatan 1"},
+		"nationalities": []any{"SE"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("9007199254740993"), instructions[2].(*ChildInstructionV2).Value)
+
+	sdjwt, err := instructions.SDJWT(jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+	for _, disclosure := range sdjwt.Disclosures {
+		if disclosure.name == "age" {
+			b, err := base64.RawURLEncoding.DecodeString(disclosure.disclosureHash)
+			assert.NoError(t, err)
+			assert.Contains(t, string(b), "9007199254740993")
+		}
+	}
+}
+
+func TestCompileTemplateCopiesInstructions(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: Placeholder{}, SelectiveDisclosure: true},
+	}
+	template, err := CompileTemplate(instructions)
+	assert.NoError(t, err)
+
+	instructions[0].(*ChildInstructionV2).Name = "_sd"
+
+	got, err := template.Bind(map[string]any{"given_name": "John"})
+	assert.NoError(t, err)
+	assert.Equal(t, InstructionsV2{&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true}}, got)
+}
+
+func instructionErrorPaths(errs InstructionErrors) []string {
+	paths := []string{}
+	for _, err := range errs {
+		paths = append(paths, err.Path)
+	}
+	return paths
+}
+
+func TestCompileRulesTemplate(t *testing.T) {
+	template, err := CompileRulesTemplate(map[string]any{
+		"iss":        RuleNone,
+		"given_name": RuleSelectiveDisclosure,
+		"address": map[string]any{
+			RuleParent: RuleRecursiveSelectiveDisclosure,
+			"street":   RuleSelectiveDisclosure,
+		},
+	})
+	assert.NoError(t, err)
+
+	got, err := template.Bind(map[string]any{
+		"iss":        "https://example.com",
+		"given_name": "John",
+		"address":    map[string]any{"street": "Storgatan 1"},
+	})
+	assert.NoError(t, err)
+
+	want := InstructionsV2{
+		&RecursiveInstructionV2{
+			Name: "address",
+			Children: []Instruction{
+				&ChildInstructionV2{Name: "street", Value: "Storgatan 1", SelectiveDisclosure: true},
+			},
+		},
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+	}
+	assert.Equal(t, want, got)
+
+	_, err = template.Bind(map[string]any{"iss": "https://example.com"})
+	assert.ErrorIs(t, err, ErrTemplateValueMissing)
+}
+
+func TestCompileRulesTemplateConvertsAsConvertJSON2SDJWT(t *testing.T) {
+	rules := map[string]any{
+		"nationalities": RuleSelectiveDisclosure,
+		"address": map[string]any{
+			RuleParent: RuleRecursiveSelectiveDisclosure,
+			"lines":    RuleNone,
+		},
+	}
+	document := map[string]any{
+		"nationalities": []any{"SE", "DK"},
+		"address":       map[string]any{"lines": []any{"Storgatan 1", "Stockholm"}},
+	}
+
+	template, err := CompileRulesTemplate(rules)
+	assert.NoError(t, err)
+
+	got, err := template.Bind(document)
+	assert.NoError(t, err)
+
+	want, err := ConvertJSON2SDJWT(document, rules)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	nationalities := got[1].(*ChildArrayInstructionV2)
+	assert.False(t, nationalities.SelectiveDisclosure)
+	for _, element := range nationalities.Children {
+		assert.True(t, element.(*ChildInstructionV2).SelectiveDisclosure)
+	}
+}
+
+func TestCompileTemplateErrors(t *testing.T) {
+	tts := []struct {
+		name string
+		have func() error
+		want error
+	}{
+		{
+			name: "unknown placeholder type",
+			have: func() error {
+				_, err := CompileTemplate(InstructionsV2{
+					&ChildInstructionV2{Name: "a", Value: Placeholder{Type: "date"}},
+				})
+				return err
+			},
+			want: ErrTemplateNotValid,
+		},
+		{
+			name: "instructions not valid",
+			have: func() error {
+				_, err := CompileTemplate(InstructionsV2{
+					&ChildInstructionV2{Name: "_sd", Value: Placeholder{}},
+				})
+				return err
+			},
+			want: ErrInstructionNameReserved,
+		},
+		{
+			name: "array element rules",
+			have: func() error {
+				_, err := CompileRulesTemplate(map[string]any{"a": []any{RuleSelectiveDisclosure}})
+				return err
+			},
+			want: ErrTemplateNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.have(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package gosdjwt
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxExtends limits how many types are resolved for a vct, the type itself and the types it extends
+const maxExtends = 16
+
+var (
+	// ErrTypeMetadataNotFound is returned when the type metadata of a vct is not in the registry and can not be fetched
+	ErrTypeMetadataNotFound = errors.New("type metadata is not found")
+
+	// ErrTypeMetadataNotValid is returned when type metadata can not be decoded or does not match its vct
+	ErrTypeMetadataNotValid = errors.New("type metadata is not valid")
+
+	// ErrIntegrityNotValid is returned when a document does not match its integrity metadata
+	ErrIntegrityNotValid = errors.New("integrity is not valid")
+)
+
+// TypeMetadata is the type metadata of a SD-JWT VC type
+type TypeMetadata struct {
+	VCT         string `json:"vct"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Extends is the vct of the type this type extends
+	Extends          string `json:"extends,omitempty"`
+	ExtendsIntegrity string `json:"extends#integrity,omitempty"`
+
+	Display []TypeDisplay   `json:"display,omitempty"`
+	Claims  []ClaimMetadata `json:"claims,omitempty"`
+
+	// Schema is an embedded JSON Schema, it can not be used together with SchemaURI
+	Schema             map[string]any `json:"schema,omitempty"`
+	SchemaURI          string         `json:"schema_uri,omitempty"`
+	SchemaURIIntegrity string         `json:"schema_uri#integrity,omitempty"`
+}
+
+// TypeDisplay is how to display a type for a locale
+type TypeDisplay struct {
+	Locale      string `json:"locale"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Rendering holds rendering methods, e.g. simple or svg_templates
+	Rendering map[string]any `json:"rendering,omitempty"`
+}
+
+// ClaimMetadata is the metadata of the claims selected by Path
+type ClaimMetadata struct {
+	// Path selects claims, strings select object members, integers array elements and null all array elements
+	Path    []any          `json:"path"`
+	Display []ClaimDisplay `json:"display,omitempty"`
+
+	// SD is if the claim is selective disclosable, always, allowed or never
+	SD    string `json:"sd,omitempty"`
+	SVGID string `json:"svg_id,omitempty"`
+}
+
+// ClaimDisplay is how to display a claim for a locale
+type ClaimDisplay struct {
+	Locale      string `json:"locale"`
+	Label       string `json:"label"`
+	Description string `json:"description,omitempty"`
+}
+
+// ResolvedType is the type metadata of a vct together with the types it extends
+type ResolvedType struct {
+	// Types has the type of the vct first, followed by the type it extends, and so on
+	Types []*TypeMetadata
+
+	schemas []*Schema
+}
+
+// TypeMetadataResolver resolves type metadata and schemas from a registry of documents, and over HTTP if Client
+// is set. Integrity is checked whenever a document is referenced with integrity metadata. Resolved types are
+// cached by vct and integrity until a document is registered. It is safe for concurrent use.
+type TypeMetadataResolver struct {
+	// Client fetches https vct and schema_uri that are not in the registry, nothing is fetched if nil
+	Client *http.Client
+
+	mu       sync.Mutex
+	registry map[string][]byte
+	cache    map[string]*ResolvedType
+}
+
+// NewTypeMetadataResolver returns a resolver with an empty registry that fetches documents with client, if set
+func NewTypeMetadataResolver(client *http.Client) *TypeMetadataResolver {
+	return &TypeMetadataResolver{
+		Client:   client,
+		registry: map[string][]byte{},
+	}
+}
+
+// Register adds a type metadata document by its vct, or a JSON Schema document by its schema_uri
+func (r *TypeMetadataResolver) Register(uri string, document []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.registry == nil {
+		r.registry = map[string][]byte{}
+	}
+	r.registry[uri] = document
+	r.cache = nil
+}
+
+// document returns the registered or fetched document at uri, checked against integrity if it is set
+func (r *TypeMetadataResolver) document(ctx context.Context, uri, integrity string) ([]byte, error) {
+	r.mu.Lock()
+	b, ok := r.registry[uri]
+	r.mu.Unlock()
+
+	if !ok {
+		if _, err := httpsURL(uri); r.Client == nil || err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrTypeMetadataNotFound, uri)
+		}
+		var err error
+		if b, err = httpGet(ctx, r.Client, uri, "application/json", maxMetadataSize); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrTypeMetadataNotFound, err)
+		}
+	}
+
+	if integrity != "" {
+		if err := CheckIntegrity(b, integrity); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, uri)
+		}
+	}
+	return b, nil
+}
+
+// Resolve returns the type metadata of vct and the types it extends, integrity is the optional vct#integrity.
+// The returned type is shared through the cache and must not be modified.
+func (r *TypeMetadataResolver) Resolve(ctx context.Context, vct, integrity string) (*ResolvedType, error) {
+	key := vct + " " + integrity
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	resolved, err := r.resolve(ctx, vct, integrity)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache == nil {
+		r.cache = map[string]*ResolvedType{}
+	}
+	r.cache[key] = resolved
+	return resolved, nil
+}
+
+// resolve fetches and decodes the type metadata of vct and the types it extends
+func (r *TypeMetadataResolver) resolve(ctx context.Context, vct, integrity string) (*ResolvedType, error) {
+	resolved := &ResolvedType{}
+	seen := map[string]bool{}
+
+	for vct != "" {
+		if seen[vct] {
+			return nil, fmt.Errorf("%w: %s extends itself", ErrTypeMetadataNotValid, vct)
+		}
+		if len(resolved.Types) >= maxExtends {
+			return nil, fmt.Errorf("%w: %s has more than %d types to resolve", ErrTypeMetadataNotValid, resolved.Types[0].VCT, maxExtends)
+		}
+		seen[vct] = true
+
+		b, err := r.document(ctx, vct, integrity)
+		if err != nil {
+			return nil, err
+		}
+		metadata := &TypeMetadata{}
+		if err := json.Unmarshal(b, metadata); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrTypeMetadataNotValid, vct, err)
+		}
+		if metadata.VCT == "" {
+			return nil, fmt.Errorf("%w: %s: vct is missing", ErrTypeMetadataNotValid, vct)
+		}
+		if metadata.VCT != vct {
+			return nil, fmt.Errorf("%w: vct %q does not match %q", ErrTypeMetadataNotValid, metadata.VCT, vct)
+		}
+
+		schema, err := r.schema(ctx, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved.Types = append(resolved.Types, metadata)
+		if schema != nil {
+			resolved.schemas = append(resolved.schemas, schema)
+		}
+		vct, integrity = metadata.Extends, metadata.ExtendsIntegrity
+	}
+
+	return resolved, nil
+}
+
+// schema returns the embedded or referenced schema of the type, or nil
+func (r *TypeMetadataResolver) schema(ctx context.Context, metadata *TypeMetadata) (*Schema, error) {
+	switch {
+	case metadata.Schema != nil && metadata.SchemaURI != "":
+		return nil, fmt.Errorf("%w: %s has both schema and schema_uri", ErrTypeMetadataNotValid, metadata.VCT)
+	case metadata.Schema != nil:
+		return NewSchema(metadata.Schema)
+	case metadata.SchemaURI != "":
+		b, err := r.document(ctx, metadata.SchemaURI, metadata.SchemaURIIntegrity)
+		if err != nil {
+			return nil, err
+		}
+		return ParseSchema(b)
+	}
+	return nil, nil
+}
+
+// VCT returns the vct of the type
+func (t *ResolvedType) VCT() string {
+	return t.Types[0].VCT
+}
+
+// Validate checks the claims against the schemas of the type and the types it extends.
+// Selective disclosable claims that are not disclosed are missing from claims, schemas should not require them.
+func (t *ResolvedType) Validate(claims map[string]any) error {
+	errs := SchemaErrors{}
+	for _, schema := range t.schemas {
+		err := schema.Validate(claims)
+		var schemaErrs SchemaErrors
+		switch {
+		case err == nil:
+		case errors.As(err, &schemaErrs):
+			errs = append(errs, schemaErrs...)
+		default:
+			return err
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Display returns the display of the type for locale, from the closest type that has a display.
+// A locale without region matches a display with one, e.g. en matches en-US. The first display is returned if
+// none matches, nil if no type has a display.
+func (t *ResolvedType) Display(locale string) *TypeDisplay {
+	for _, metadata := range t.Types {
+		if len(metadata.Display) == 0 {
+			continue
+		}
+		for i, display := range metadata.Display {
+			if localeMatches(display.Locale, locale) {
+				return &metadata.Display[i]
+			}
+		}
+		return &metadata.Display[0]
+	}
+	return nil
+}
+
+// Claims returns the claim metadata of the type merged with the types it extends, a type replaces the metadata
+// of the same path in the type it extends
+func (t *ResolvedType) Claims() []ClaimMetadata {
+	claims := []ClaimMetadata{}
+	seen := map[string]bool{}
+	for _, metadata := range t.Types {
+		for _, claim := range metadata.Claims {
+			key := fmt.Sprint(claim.Path)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			claims = append(claims, claim)
+		}
+	}
+	return claims
+}
+
+// Claim returns the metadata of the claim at path, e.g. Claim("address", "street") or Claim("nationalities", 0),
+// or nil if there is none
+func (t *ResolvedType) Claim(path ...any) *ClaimMetadata {
+	for _, claim := range t.Claims() {
+		if claimPathMatches(claim.Path, path) {
+			return &claim
+		}
+	}
+	return nil
+}
+
+// ClaimDisplay returns the display of the claim at path for locale, see Display for how the locale is matched
+func (t *ResolvedType) ClaimDisplay(locale string, path ...any) *ClaimDisplay {
+	claim := t.Claim(path...)
+	if claim == nil || len(claim.Display) == 0 {
+		return nil
+	}
+	for i, display := range claim.Display {
+		if localeMatches(display.Locale, locale) {
+			return &claim.Display[i]
+		}
+	}
+	return &claim.Display[0]
+}
+
+// localeMatches returns true if locale is have, or its language without region
+func localeMatches(have, locale string) bool {
+	if strings.EqualFold(have, locale) {
+		return true
+	}
+	language, _, _ := strings.Cut(have, "-")
+	return !strings.Contains(locale, "-") && strings.EqualFold(language, locale)
+}
+
+// claimPathMatches returns true if the claim path selects path
+func claimPathMatches(claimPath, path []any) bool {
+	if len(claimPath) != len(path) {
+		return false
+	}
+	for i, selector := range claimPath {
+		switch s := selector.(type) {
+		case nil:
+			if _, ok := schemaNumber(path[i]); !ok {
+				return false
+			}
+		case string:
+			if s != path[i] {
+				return false
+			}
+		default:
+			n, ok := schemaNumber(s)
+			m, isNumber := schemaNumber(path[i])
+			if !ok || !isNumber || n != m {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// integrityHashes are the hash functions of integrity metadata, strongest first
+var integrityHashes = []struct {
+	name string
+	sum  func([]byte) []byte
+}{
+	{name: "sha512", sum: func(b []byte) []byte { sum := sha512.Sum512(b); return sum[:] }},
+	{name: "sha384", sum: func(b []byte) []byte { sum := sha512.Sum384(b); return sum[:] }},
+	{name: "sha256", sum: func(b []byte) []byte { sum := sha256.Sum256(b); return sum[:] }},
+}
+
+// Integrity returns the integrity metadata of a document, e.g. for vct#integrity
+func Integrity(document []byte) string {
+	sum := sha256.Sum256(document)
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// CheckIntegrity checks a document against W3C Subresource Integrity metadata, e.g. sha256-<base64 digest>.
+// Of several digests only those of the strongest hash function are used, and one of them has to match.
+func CheckIntegrity(document []byte, integrity string) error {
+	digests := map[string][]string{}
+	for _, token := range strings.Fields(integrity) {
+		token, _, _ = strings.Cut(token, "?")
+		name, digest, ok := strings.Cut(token, "-")
+		if ok {
+			digests[name] = append(digests[name], digest)
+		}
+	}
+
+	for _, h := range integrityHashes {
+		if len(digests[h.name]) == 0 {
+			continue
+		}
+		sum := base64.StdEncoding.EncodeToString(h.sum(document))
+		for _, digest := range digests[h.name] {
+			if subtle.ConstantTimeCompare([]byte(sum), []byte(digest)) == 1 {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s digest does not match", ErrIntegrityNotValid, h.name)
+	}
+	return fmt.Errorf("%w: no supported digest in %q", ErrIntegrityNotValid, integrity)
+}
@@ -0,0 +1,331 @@
+package gosdjwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	mockBaseType = []byte(`{
+		"vct": "https://example.com/identity",
+		"name": "Identity",
+		"display": [
+			{"locale": "en-US", "name": "Identity"},
+			{"locale": "sv-SE", "name": "Identitet"}
+		],
+		"claims": [
+			{"path": ["given_name"], "display": [{"locale": "en-US", "label": "Given name"}, {"locale": "sv-SE", "label": "Förnamn"}]},
+			{"path": ["address", "street"], "sd": "always"}
+		],
+		"schema": {
+			"type": "object",
+			"required": ["given_name"],
+			"properties": {"given_name": {"type": "string"}}
+		}
+	}`)
+
+	mockPIDSchema = []byte(`{
+		"type": "object",
+		"properties": {"nationalities": {"type": "array", "items": {"type": "string", "minLength": 2, "maxLength": 2}}}
+	}`)
+)
+
+func mockPIDType(extendsIntegrity string) []byte {
+	b, _ := json.Marshal(TypeMetadata{
+		VCT:              "https://example.com/pid",
+		Name:             "PID",
+		Extends:          "https://example.com/identity",
+		ExtendsIntegrity: extendsIntegrity,
+		Claims: []ClaimMetadata{
+			{Path: []any{"given_name"}, Display: []ClaimDisplay{{Locale: "en-US", Label: "First name"}}},
+			{Path: []any{"nationalities", nil}, SD: "allowed"},
+		},
+		SchemaURI:          "https://example.com/pid.schema.json",
+		SchemaURIIntegrity: Integrity(mockPIDSchema),
+	})
+	return b
+}
+
+func mockTypeMetadataResolver() *TypeMetadataResolver {
+	r := NewTypeMetadataResolver(nil)
+	r.Register("https://example.com/identity", mockBaseType)
+	r.Register("https://example.com/pid", mockPIDType(Integrity(mockBaseType)))
+	r.Register("https://example.com/pid.schema.json", mockPIDSchema)
+	return r
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	document := []byte(`{"vct": "https://example.com/pid"}`)
+
+	tts := []struct {
+		name string
+		have string
+		want error
+	}{
+		{name: "test 0 - sha256", have: Integrity(document)},
+		{name: "test 1 - with options", have: Integrity(document) + "?ct=application/json"},
+		{name: "test 2 - one of several", have: "sha256-AAAA " + Integrity(document)},
+		{name: "test 3 - wrong digest", have: Integrity([]byte("other")), want: ErrIntegrityNotValid},
+		{name: "test 4 - strongest hash function is used", have: Integrity(document) + " sha384-AAAA", want: ErrIntegrityNotValid},
+		{name: "test 5 - unsupported hash function", have: "md5-AAAA", want: ErrIntegrityNotValid},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, CheckIntegrity(document, tt.have), tt.want)
+		})
+	}
+}
+
+func TestTypeMetadataResolve(t *testing.T) {
+	resolved, err := mockTypeMetadataResolver().Resolve(context.Background(), "https://example.com/pid", "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "https://example.com/pid", resolved.VCT())
+	assert.Len(t, resolved.Types, 2)
+	assert.Equal(t, "Identity", resolved.Types[1].Name)
+
+	t.Run("display from the extended type", func(t *testing.T) {
+		assert.Equal(t, "Identitet", resolved.Display("sv").Name)
+		assert.Equal(t, "Identity", resolved.Display("fi-FI").Name)
+	})
+
+	t.Run("claim metadata of the type replaces the extended type", func(t *testing.T) {
+		assert.Len(t, resolved.Claims(), 3)
+		assert.Equal(t, "First name", resolved.ClaimDisplay("sv-SE", "given_name").Label)
+		assert.Equal(t, "always", resolved.Claim("address", "street").SD)
+		assert.Equal(t, "allowed", resolved.Claim("nationalities", 1).SD)
+		assert.Nil(t, resolved.Claim("nationalities"))
+	})
+
+	t.Run("schemas of all types", func(t *testing.T) {
+		assert.NoError(t, resolved.Validate(map[string]any{"given_name": "John", "nationalities": []any{"SE"}}))
+		assert.ErrorIs(t, resolved.Validate(map[string]any{"nationalities": []any{"SE"}}), ErrClaimsNotValid)
+		assert.ErrorIs(t, resolved.Validate(map[string]any{"given_name": "John", "nationalities": []any{"SWE"}}), ErrClaimsNotValid)
+	})
+}
+
+func TestTypeMetadataResolveNotValid(t *testing.T) {
+	tts := []struct {
+		name      string
+		register  map[string][]byte
+		integrity string
+		want      error
+	}{
+		{
+			name: "test 0 - not found",
+			want: ErrTypeMetadataNotFound,
+		},
+		{
+			name:      "test 1 - vct#integrity does not match",
+			register:  map[string][]byte{"https://example.com/identity": mockBaseType},
+			integrity: Integrity([]byte("other")),
+			want:      ErrIntegrityNotValid,
+		},
+		{
+			name: "test 2 - extends#integrity does not match",
+			register: map[string][]byte{
+				"https://example.com/identity":        mockBaseType,
+				"https://example.com/pid":             mockPIDType(Integrity([]byte("other"))),
+				"https://example.com/pid.schema.json": mockPIDSchema,
+			},
+			want: ErrIntegrityNotValid,
+		},
+		{
+			name: "test 3 - schema_uri#integrity does not match",
+			register: map[string][]byte{
+				"https://example.com/identity":        mockBaseType,
+				"https://example.com/pid":             mockPIDType(""),
+				"https://example.com/pid.schema.json": []byte(`{"type": "object"}`),
+			},
+			want: ErrIntegrityNotValid,
+		},
+		{
+			name: "test 4 - extends itself",
+			register: map[string][]byte{
+				"https://example.com/pid":      []byte(`{"vct": "https://example.com/pid", "extends": "https://example.com/identity"}`),
+				"https://example.com/identity": []byte(`{"vct": "https://example.com/identity", "extends": "https://example.com/pid"}`),
+			},
+			want: ErrTypeMetadataNotValid,
+		},
+		{
+			name:     "test 5 - vct does not match",
+			register: map[string][]byte{"https://example.com/pid": mockBaseType},
+			want:     ErrTypeMetadataNotValid,
+		},
+		{
+			name:     "test 6 - schema and schema_uri",
+			register: map[string][]byte{"https://example.com/pid": []byte(`{"vct": "https://example.com/pid", "schema": {}, "schema_uri": "https://example.com/schema.json"}`)},
+			want:     ErrTypeMetadataNotValid,
+		},
+		{
+			name:     "test 7 - vct missing",
+			register: map[string][]byte{"https://example.com/pid": []byte(`{"name": "PID"}`)},
+			want:     ErrTypeMetadataNotValid,
+		},
+		{
+			name:     "test 8 - too many types",
+			register: mockTypeChain(maxExtends + 1),
+			want:     ErrTypeMetadataNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewTypeMetadataResolver(nil)
+			for uri, document := range tt.register {
+				r.Register(uri, document)
+			}
+			vct := "https://example.com/pid"
+			if tt.integrity != "" {
+				vct = "https://example.com/identity"
+			}
+
+			_, err := r.Resolve(context.Background(), vct, tt.integrity)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+// mockTypeChain returns n types from https://example.com/pid, each extending the next
+func mockTypeChain(n int) map[string][]byte {
+	types := map[string][]byte{}
+	vct := "https://example.com/pid"
+	for i := 1; i <= n; i++ {
+		extends := fmt.Sprintf("https://example.com/type-%d", i)
+		if i == n {
+			extends = ""
+		}
+		types[vct] = []byte(fmt.Sprintf(`{"vct": %q, "extends": %q}`, vct, extends))
+		vct = extends
+	}
+	return types
+}
+
+func TestTypeMetadataResolveMaxTypes(t *testing.T) {
+	r := NewTypeMetadataResolver(nil)
+	for uri, document := range mockTypeChain(maxExtends) {
+		r.Register(uri, document)
+	}
+	resolved, err := r.Resolve(context.Background(), "https://example.com/pid", "")
+	assert.NoError(t, err)
+	assert.Len(t, resolved.Types, maxExtends)
+}
+
+func TestTypeMetadataResolveHTTP(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pid":
+			w.Write([]byte(`{"vct": "` + server.URL + `/pid", "schema_uri": "` + server.URL + `/pid.schema.json"}`))
+		case "/pid.schema.json":
+			w.Write(mockPIDSchema)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	resolved, err := NewTypeMetadataResolver(server.Client()).Resolve(context.Background(), server.URL+"/pid", "")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, resolved.Validate(map[string]any{"nationalities": []any{"SWE"}}), ErrClaimsNotValid)
+
+	_, err = NewTypeMetadataResolver(server.Client()).Resolve(context.Background(), server.URL+"/other", "")
+	assert.ErrorIs(t, err, ErrTypeMetadataNotFound)
+
+	_, err = NewTypeMetadataResolver(nil).Resolve(context.Background(), server.URL+"/pid", "")
+	assert.ErrorIs(t, err, ErrTypeMetadataNotFound, "nothing is fetched without a client")
+}
+
+func TestTypeMetadataResolveCache(t *testing.T) {
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"vct": "` + server.URL + `/pid"}`))
+	}))
+	defer server.Close()
+
+	r := NewTypeMetadataResolver(server.Client())
+	first, err := r.Resolve(context.Background(), server.URL+"/pid", "")
+	assert.NoError(t, err)
+	second, err := r.Resolve(context.Background(), server.URL+"/pid", "")
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, 1, requests)
+
+	t.Run("register clears the cache", func(t *testing.T) {
+		r.Register(server.URL+"/pid", []byte(`{"vct": "`+server.URL+`/pid", "name": "Registered"}`))
+		got, err := r.Resolve(context.Background(), server.URL+"/pid", "")
+		assert.NoError(t, err)
+		assert.Equal(t, "Registered", got.Types[0].Name)
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		r := &TypeMetadataResolver{}
+		r.Register("https://example.com/pid", []byte(`{"vct": "https://example.com/pid"}`))
+		_, err := r.Resolve(context.Background(), "https://example.com/pid", "")
+		assert.NoError(t, err)
+	})
+}
+
+func TestVerifierTypeMetadata(t *testing.T) {
+	verifier := &Verifier{Key: "mura", VC: true, TypeMetadata: mockTypeMetadataResolver()}
+
+	tts := []struct {
+		name         string
+		instructions InstructionsV2
+		integrity    string
+		want         error
+	}{
+		{
+			name: "test 0 - valid",
+			instructions: InstructionsV2{
+				&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+				&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{&ChildInstructionV2{Value: "SE"}}},
+			},
+			integrity: Integrity(mockPIDType(Integrity(mockBaseType))),
+		},
+		{
+			name: "test 1 - does not match the schema",
+			instructions: InstructionsV2{
+				&ChildInstructionV2{Name: "given_name", Value: "John"},
+				&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{&ChildInstructionV2{Value: "SWE"}}},
+			},
+			want: ErrClaimsNotValid,
+		},
+		{
+			name: "test 2 - vct#integrity does not match",
+			instructions: InstructionsV2{
+				&ChildInstructionV2{Name: "given_name", Value: "John"},
+			},
+			integrity: Integrity(mockBaseType),
+			want:      ErrIntegrityNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			vc := VC{VCT: "https://example.com/pid", Issuer: "https://example.com", VCTIntegrity: tt.integrity}
+			sdjwt, err := tt.instructions.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+			assert.NoError(t, err)
+
+			_, validation, err := verifier.Verify(context.Background(), mockVCPresentation(sdjwt))
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "PID", validation.Type.Types[0].Name)
+			assert.Equal(t, "First name", validation.Type.ClaimDisplay("en", "given_name").Label)
+			assert.Nil(t, validation.Type.ClaimDisplay("en", "address", "street"))
+		})
+	}
+}
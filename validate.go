@@ -0,0 +1,186 @@
+package gosdjwt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrInstructionNameEmpty is returned when an instruction lacks a name
+	ErrInstructionNameEmpty = errors.New("instruction name is empty")
+
+	// ErrInstructionNameDuplicate is returned when two siblings have the same name
+	ErrInstructionNameDuplicate = errors.New("instruction name is not unique among its siblings")
+
+	// ErrInstructionNameReserved is returned when an instruction uses a name reserved by SD-JWT
+	ErrInstructionNameReserved = errors.New("instruction name is reserved")
+
+	// ErrArrayElementNamed is returned when an array element has a name
+	ErrArrayElementNamed = errors.New("array element can not have a name")
+
+	// ErrSelectiveDisclosureAndAlwaysVisible is returned when an instruction is both selective disclosable and always visible
+	ErrSelectiveDisclosureAndAlwaysVisible = errors.New("instruction is both selective disclosable and always visible")
+
+	// ErrInstructionNil is returned when an instruction tree contains a nil instruction
+	ErrInstructionNil = errors.New("instruction is nil")
+
+	// ErrRecursiveInstructionValue is returned when a recursive instruction has a value, its object is built from its children
+	ErrRecursiveInstructionValue = errors.New("recursive instruction has a value instead of children")
+)
+
+// reservedNames can not be used as claim names at any depth
+var reservedNames = map[string]bool{
+	"_sd": true,
+	"...": true,
+}
+
+// topLevelReservedNames can not be used as claim names in the top-level object
+var topLevelReservedNames = map[string]bool{
+	"_sd_alg": true,
+	"cnf":     true,
+}
+
+// isNilInstruction reports whether the instruction is nil, or a nil pointer wrapped in the interface
+func isNilInstruction(instruction Instruction) bool {
+	if instruction == nil {
+		return true
+	}
+	value := reflect.ValueOf(instruction)
+	return value.Kind() == reflect.Pointer && value.IsNil()
+}
+
+// InstructionError is a problem with the instruction at Path
+type InstructionError struct {
+	Path string
+	Err  error
+}
+
+func (e *InstructionError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *InstructionError) Unwrap() error {
+	return e.Err
+}
+
+// InstructionErrors are all problems found in an instruction tree
+type InstructionErrors []*InstructionError
+
+func (e InstructionErrors) Error() string {
+	s := []string{}
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "; ")
+}
+
+// Unwrap makes errors.Is and errors.As match any of the problems
+func (e InstructionErrors) Unwrap() []error {
+	errs := []error{}
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// validator collects problems while walking an instruction tree
+type validator struct {
+	errs InstructionErrors
+}
+
+func (v *validator) add(path string, err error) {
+	v.errs = append(v.errs, &InstructionError{Path: path, Err: err})
+}
+
+// name checks the name of the instruction at index among its siblings, and returns its path.
+// siblings is nil for array elements, which must not have a name.
+func (v *validator) name(path, name string, index int, siblings map[string]bool) string {
+	if siblings == nil {
+		elementPath := fmt.Sprintf("%s[%d]", path, index)
+		if name != "" {
+			v.add(elementPath, ErrArrayElementNamed)
+		}
+		return elementPath
+	}
+
+	claimPath := joinPath(path, name)
+	switch {
+	case name == "":
+		claimPath = fmt.Sprintf("%s[%d]", path, index)
+		v.add(claimPath, ErrInstructionNameEmpty)
+	case reservedNames[name], path == "" && topLevelReservedNames[name]:
+		v.add(claimPath, ErrInstructionNameReserved)
+	case siblings[name]:
+		v.add(claimPath, ErrInstructionNameDuplicate)
+	}
+	siblings[name] = true
+	return claimPath
+}
+
+func (v *validator) children(path string, children []Instruction) {
+	siblings := map[string]bool{}
+	for index, child := range children {
+		if isNilInstruction(child) {
+			v.add(fmt.Sprintf("%s[%d]", path, index), ErrInstructionNil)
+			continue
+		}
+		child.validate(path, index, siblings, v)
+	}
+}
+
+func (v *validator) elements(path string, elements []Instruction) {
+	for index, element := range elements {
+		if isNilInstruction(element) {
+			v.add(fmt.Sprintf("%s[%d]", path, index), ErrInstructionNil)
+			continue
+		}
+		element.validate(path, index, nil, v)
+	}
+}
+
+// Validate walks the instruction tree and returns all problems found, or nil.
+// The returned error is of type InstructionErrors.
+func (i InstructionsV2) Validate() error {
+	v := &validator{}
+	v.children("", i)
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func (p *ParentInstructionV2) validate(path string, index int, siblings map[string]bool, v *validator) {
+	claimPath := v.name(path, p.Name, index, siblings)
+	if p.SelectiveDisclosure && p.AlwaysVisible {
+		v.add(claimPath, ErrSelectiveDisclosureAndAlwaysVisible)
+	}
+	v.children(claimPath, p.Children)
+}
+
+func (r *RecursiveInstructionV2) validate(path string, index int, siblings map[string]bool, v *validator) {
+	claimPath := v.name(path, r.Name, index, siblings)
+	switch {
+	case r.Value != nil && len(r.Children) > 0:
+		v.add(claimPath, ErrValueAndChildrenPresent)
+	case r.Value != nil:
+		v.add(claimPath, ErrRecursiveInstructionValue)
+	}
+	v.children(claimPath, r.Children)
+}
+
+func (c *ChildInstructionV2) validate(path string, index int, siblings map[string]bool, v *validator) {
+	claimPath := v.name(path, c.Name, index, siblings)
+	if c.SelectiveDisclosure && c.AlwaysVisible {
+		v.add(claimPath, ErrSelectiveDisclosureAndAlwaysVisible)
+	}
+}
+
+func (c *ChildArrayInstructionV2) validate(path string, index int, siblings map[string]bool, v *validator) {
+	claimPath := v.name(path, c.Name, index, siblings)
+	if c.SelectiveDisclosure && c.AlwaysVisible {
+		v.add(claimPath, ErrSelectiveDisclosureAndAlwaysVisible)
+	}
+	v.elements(claimPath, c.Children)
+}
@@ -0,0 +1,189 @@
+package gosdjwt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tts := []struct {
+		name string
+		have InstructionsV2
+		want InstructionErrors
+	}{
+		{
+			name: "valid",
+			have: InstructionsV2{
+				&ChildInstructionV2{Name: "iss", Value: "https://example.com"},
+				&ParentInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+						&ChildArrayInstructionV2{Name: "lines", Children: []Instruction{&ChildInstructionV2{Value: "1"}}},
+					},
+				},
+			},
+		},
+		{
+			name: "all problems with their paths",
+			have: InstructionsV2{
+				&ChildInstructionV2{Value: "no name"},
+				&ChildInstructionV2{Name: "_sd", Value: "reserved"},
+				&ChildInstructionV2{Name: "cnf", Value: "reserved"},
+				&ParentInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 2"},
+						&RecursiveInstructionV2{
+							Name:  "region",
+							Value: "value",
+							Children: []Instruction{
+								&ChildInstructionV2{Name: "...", Value: "reserved"},
+							},
+						},
+					},
+				},
+				&ChildInstructionV2{Name: "address", Value: "duplicate"},
+			},
+			want: InstructionErrors{
+				{Path: "[0]", Err: ErrInstructionNameEmpty},
+				{Path: "_sd", Err: ErrInstructionNameReserved},
+				{Path: "cnf", Err: ErrInstructionNameReserved},
+				{Path: "address.street", Err: ErrInstructionNameDuplicate},
+				{Path: "address.region", Err: ErrValueAndChildrenPresent},
+				{Path: "address.region....", Err: ErrInstructionNameReserved},
+				{Path: "address", Err: ErrInstructionNameDuplicate},
+			},
+		},
+		{
+			name: "selective disclosable and always visible",
+			have: InstructionsV2{
+				&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true, AlwaysVisible: true},
+				&ChildArrayInstructionV2{Name: "nationalities", SelectiveDisclosure: true, AlwaysVisible: true},
+				&ParentInstructionV2{Name: "address", SelectiveDisclosure: true, AlwaysVisible: true},
+			},
+			want: InstructionErrors{
+				{Path: "given_name", Err: ErrSelectiveDisclosureAndAlwaysVisible},
+				{Path: "nationalities", Err: ErrSelectiveDisclosureAndAlwaysVisible},
+				{Path: "address", Err: ErrSelectiveDisclosureAndAlwaysVisible},
+			},
+		},
+		{
+			name: "array elements",
+			have: InstructionsV2{
+				&ChildArrayInstructionV2{
+					Name: "addresses",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "street", Value: "named"},
+						&ParentInstructionV2{
+							Children: []Instruction{
+								&ChildInstructionV2{Value: "no name"},
+							},
+						},
+					},
+				},
+			},
+			want: InstructionErrors{
+				{Path: "addresses[0]", Err: ErrArrayElementNamed},
+				{Path: "addresses[1][0]", Err: ErrInstructionNameEmpty},
+			},
+		},
+		{
+			name: "nil instructions",
+			have: InstructionsV2{
+				nil,
+				(*ChildInstructionV2)(nil),
+				&ParentInstructionV2{Name: "address", Children: []Instruction{(*ParentInstructionV2)(nil)}},
+				&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{(*ChildInstructionV2)(nil)}},
+			},
+			want: InstructionErrors{
+				{Path: "[0]", Err: ErrInstructionNil},
+				{Path: "[1]", Err: ErrInstructionNil},
+				{Path: "address[0]", Err: ErrInstructionNil},
+				{Path: "nationalities[0]", Err: ErrInstructionNil},
+			},
+		},
+		{
+			name: "top-level reserved names are allowed in nested objects",
+			have: InstructionsV2{
+				&ParentInstructionV2{
+					Name: "proof",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "cnf", Value: "nested"},
+						&ChildInstructionV2{Name: "_sd_alg", Value: "nested"},
+						&ChildInstructionV2{Name: "_sd", Value: "reserved"},
+					},
+				},
+			},
+			want: InstructionErrors{
+				{Path: "proof._sd", Err: ErrInstructionNameReserved},
+			},
+		},
+		{
+			name: "recursive value without children",
+			have: InstructionsV2{
+				&RecursiveInstructionV2{Name: "address", Value: "Storgatan 1"},
+			},
+			want: InstructionErrors{
+				{Path: "address", Err: ErrRecursiveInstructionValue},
+			},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.have.Validate()
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got InstructionErrors
+			assert.True(t, errors.As(err, &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMakeSDV2NilInstruction(t *testing.T) {
+	tts := []struct {
+		name string
+		have []Instruction
+	}{
+		{
+			name: "test 0 - nil",
+			have: []Instruction{nil},
+		},
+		{
+			name: "test 1 - typed nil",
+			have: []Instruction{(*ChildInstructionV2)(nil)},
+		},
+		{
+			name: "test 2 - typed nil in a recursive parent",
+			have: []Instruction{&RecursiveInstructionV2{Name: "address", Children: []Instruction{(*ChildInstructionV2)(nil)}}},
+		},
+		{
+			name: "test 3 - typed nil array element",
+			have: []Instruction{&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{(*ParentInstructionV2)(nil)}}},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			err := makeSDV2(tt.have, jwt.MapClaims{}, DisclosuresV2{})
+			assert.ErrorIs(t, err, ErrInstructionNil)
+		})
+	}
+}
+
+func TestSDJWTValidates(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "_sd_alg", Value: "sha-256"},
+	}
+
+	_, err := instructions.SDJWT(jwt.SigningMethodHS256, "mura")
+	assert.ErrorIs(t, err, ErrInstructionNameReserved)
+}
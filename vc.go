@@ -0,0 +1,285 @@
+package gosdjwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// TypeSDJWTVC is the typ header of a SD-JWT VC
+	TypeSDJWTVC = "dc+sd-jwt"
+
+	// TypeSDJWTVCLegacy is the typ header used by earlier drafts of SD-JWT VC, it is still accepted
+	TypeSDJWTVCLegacy = "vc+sd-jwt"
+)
+
+var (
+	// ErrVCTypeNotValid is returned when the typ of a SD-JWT VC is not dc+sd-jwt or vc+sd-jwt
+	ErrVCTypeNotValid = errors.New("typ is not a SD-JWT VC type")
+
+	// ErrVCClaimMissing is returned when a claim required by SD-JWT VC is missing
+	ErrVCClaimMissing = errors.New("SD-JWT VC claim is missing")
+
+	// ErrVCClaimNotValid is returned when a SD-JWT VC claim has the wrong type
+	ErrVCClaimNotValid = errors.New("SD-JWT VC claim is not valid")
+
+	// ErrVCClaimSelectiveDisclosure is returned when a claim that must always be visible is selective disclosable
+	ErrVCClaimSelectiveDisclosure = errors.New("SD-JWT VC claim can not be selective disclosable")
+)
+
+// vcNeverSelectiveDisclosure are the claims that a SD-JWT VC never discloses selectively
+var vcNeverSelectiveDisclosure = map[string]bool{
+	"iss":           true,
+	"nbf":           true,
+	"exp":           true,
+	"cnf":           true,
+	"vct":           true,
+	"vct#integrity": true,
+	"status":        true,
+}
+
+// VC holds the SD-JWT VC claims that are added to the payload.
+// VCT and Issuer are required, unless they are plain claims in the instructions.
+type VC struct {
+	// Type is the typ header, TypeSDJWTVC is used if empty
+	Type string
+
+	VCT    string
+	Issuer string
+
+	// VCTIntegrity is the optional vct#integrity claim, see Integrity
+	VCTIntegrity string
+
+	// Status is the optional status claim, e.g. a status list reference
+	Status map[string]any
+
+	// Confirmation is the optional cnf claim with the holder key
+	Confirmation map[string]any
+
+	// Header is added to the JOSE header, its Type is replaced by Type
+	Header Header
+
+	// TypeMetadata is the optional type metadata of VCT, the instructions have to follow its claim sd rules,
+	// see InstructionsV2.CheckTypeMetadata
+	TypeMetadata *ResolvedType
+}
+
+// claims returns the claims of the VC that are set
+func (vc VC) claims() jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	if vc.VCT != "" {
+		claims["vct"] = vc.VCT
+	}
+	if vc.Issuer != "" {
+		claims["iss"] = vc.Issuer
+	}
+	if vc.VCTIntegrity != "" {
+		claims["vct#integrity"] = vc.VCTIntegrity
+	}
+	if vc.Status != nil {
+		claims["status"] = vc.Status
+	}
+	if vc.Confirmation != nil {
+		claims["cnf"] = vc.Confirmation
+	}
+	return claims
+}
+
+func checkVCType(typ string) error {
+	switch typ {
+	case TypeSDJWTVC, TypeSDJWTVCLegacy:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrVCTypeNotValid, typ)
+}
+
+// checkVCClaims checks the claims required by SD-JWT VC in the payload
+func checkVCClaims(claims map[string]any) error {
+	for _, name := range []string{"vct", "iss"} {
+		v, ok := claims[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrVCClaimMissing, name)
+		}
+		if s, ok := v.(string); !ok || s == "" {
+			return fmt.Errorf("%w: %s", ErrVCClaimNotValid, name)
+		}
+	}
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		v, ok := claims[name]
+		if !ok {
+			continue
+		}
+		if _, ok := numericValue(v); !ok {
+			return fmt.Errorf("%w: %s is not a NumericDate", ErrVCClaimNotValid, name)
+		}
+	}
+	if v, ok := claims["cnf"]; ok {
+		if _, ok := objectValue(v); !ok {
+			return fmt.Errorf("%w: cnf", ErrVCClaimNotValid)
+		}
+	}
+	if v, ok := claims["status"]; ok {
+		if err := checkVCStatus(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkVCStatus checks that the status claim is an object, and that a status_list in it has an idx and an uri
+func checkVCStatus(v any) error {
+	status, ok := objectValue(v)
+	if !ok {
+		return fmt.Errorf("%w: status", ErrVCClaimNotValid)
+	}
+	ref, ok := status["status_list"]
+	if !ok {
+		return nil
+	}
+	statusList, ok := objectValue(ref)
+	if !ok {
+		return fmt.Errorf("%w: status.status_list", ErrVCClaimNotValid)
+	}
+	idx, ok := numericValue(statusList["idx"])
+	if !ok || idx < 0 || idx != float64(int64(idx)) {
+		return fmt.Errorf("%w: status.status_list.idx", ErrVCClaimNotValid)
+	}
+	if uri, ok := statusList["uri"].(string); !ok || uri == "" {
+		return fmt.Errorf("%w: status.status_list.uri", ErrVCClaimNotValid)
+	}
+	return nil
+}
+
+// objectValue returns v as an object, claims are either decoded JSON or given by the issuer as jwt.MapClaims
+func objectValue(v any) (map[string]any, bool) {
+	switch o := v.(type) {
+	case map[string]any:
+		return o, true
+	case jwt.MapClaims:
+		return o, true
+	}
+	return nil, false
+}
+
+// numericValue returns v as a number, claims are either decoded JSON or given by the issuer as a Go number
+func numericValue(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case *jwt.NumericDate:
+		if n != nil {
+			return float64(n.Unix()), true
+		}
+	case jwt.NumericDate:
+		return float64(n.Unix()), true
+	}
+	return 0, false
+}
+
+// checkVCInstructions makes sure that claims that are never selective disclosable are plain claims
+func checkVCInstructions(instructions InstructionsV2) error {
+	for _, instruction := range instructions {
+		if isNilInstruction(instruction) {
+			continue
+		}
+		if vcNeverSelectiveDisclosure[instruction.name()] && instruction.isSelectiveDisclosure() {
+			return fmt.Errorf("%w: %s", ErrVCClaimSelectiveDisclosure, instruction.name())
+		}
+	}
+	return nil
+}
+
+// SDJWTVC returns a signed SD-JWT VC with disclosures, the claims of vc are added as plain claims.
+// signingKey is the private key of signingMethod, a string is used as a HMAC secret.
+func (i InstructionsV2) SDJWTVC(vc VC, signingMethod jwt.SigningMethod, signingKey any) (*SDJWT, error) {
+	if vc.Type == "" {
+		vc.Type = TypeSDJWTVC
+	}
+	if err := checkVCType(vc.Type); err != nil {
+		return nil, err
+	}
+	if err := checkVCInstructions(i); err != nil {
+		return nil, err
+	}
+	if vc.TypeMetadata != nil {
+		if vc.VCT != "" && vc.VCT != vc.TypeMetadata.VCT() {
+			return nil, fmt.Errorf("%w: vct %q is not the type metadata vct %q", ErrVCClaimNotValid, vc.VCT, vc.TypeMetadata.VCT())
+		}
+		if err := i.CheckTypeMetadata(vc.TypeMetadata); err != nil {
+			return nil, err
+		}
+	}
+
+	header := vc.Header
+	header.Type = vc.Type
+	params, err := header.params()
+	if err != nil {
+		return nil, err
+	}
+
+	rawSDJWT, disclosures, err := i.createSDJWT()
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range vc.claims() {
+		if _, ok := rawSDJWT[name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrClaimNameExists, name)
+		}
+		rawSDJWT[name] = value
+	}
+	if err := checkVCClaims(rawSDJWT); err != nil {
+		return nil, err
+	}
+
+	signedJWT, err := sign(rawSDJWT, params, signingMethod, keyOf(signingKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SDJWT{
+		JWT:         signedJWT,
+		Disclosures: disclosures,
+	}, nil
+}
+
+// VerifyVC verifies the SD-JWT VC and returns the claims and the validation, key verifies the signature where a
+// string is used as a HMAC secret. Besides Verify it checks the typ header, that vct and iss are present, that
+// exp, nbf, iat and status have the right shape, and that no claim that must always be visible is selective disclosed.
+func VerifyVC(sdjwt string, key any) (jwt.MapClaims, *Validation, error) {
+	claims, r, validation, err := verify(sdjwt, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkVCProfile(claims, r, validation); err != nil {
+		return nil, nil, err
+	}
+	return claims, validation, nil
+}
+
+// checkVCProfile checks a verified SD-JWT against the SD-JWT VC profile
+func checkVCProfile(claims jwt.MapClaims, r *reconstruction, validation *Validation) error {
+	typ, _ := validation.Header["typ"].(string)
+	if err := checkVCType(typ); err != nil {
+		return err
+	}
+
+	for _, claim := range r.disclosed {
+		if vcNeverSelectiveDisclosure[claim.path] {
+			return fmt.Errorf("%w: %s", ErrVCClaimSelectiveDisclosure, claim.path)
+		}
+	}
+
+	return checkVCClaims(claims)
+}
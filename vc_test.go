@@ -0,0 +1,286 @@
+package gosdjwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var mockVC = VC{
+	VCT:    "https://credentials.example.com/identity_credential",
+	Issuer: "https://example.com/issuer",
+	Status: map[string]any{
+		"status_list": map[string]any{"idx": float64(0), "uri": "https://example.com/statuslists/1"},
+	},
+	Confirmation: map[string]any{
+		"jwk": map[string]any{"kty": "EC", "crv": "P-256", "x": "x", "y": "y"},
+	},
+}
+
+func mockVCPresentation(sdjwt *SDJWT) string {
+	presentation := sdjwt.JWT + "~"
+	for _, hash := range sdjwt.Disclosures.ArrayHashes() {
+		presentation += hash + "~"
+	}
+	return presentation
+}
+
+func TestSDJWTVC(t *testing.T) {
+	tts := []struct {
+		name     string
+		have     VC
+		wantType string
+	}{
+		{
+			name:     "test 0 - default type",
+			have:     mockVC,
+			wantType: TypeSDJWTVC,
+		},
+		{
+			name: "test 1 - legacy type without status and cnf",
+			have: VC{
+				Type:   TypeSDJWTVCLegacy,
+				VCT:    mockVC.VCT,
+				Issuer: mockVC.Issuer,
+			},
+			wantType: TypeSDJWTVCLegacy,
+		},
+	}
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			sdjwt, err := instructions.SDJWTVC(tt.have, jwt.SigningMethodHS256, "mura")
+			assert.NoError(t, err)
+
+			claims, validation, err := VerifyVC(mockVCPresentation(sdjwt), "mura")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantType, validation.Header["typ"])
+			assert.Equal(t, tt.have.VCT, claims["vct"])
+			assert.Equal(t, tt.have.Issuer, claims["iss"])
+			assert.Equal(t, "John", claims["given_name"])
+			if tt.have.Status != nil {
+				assert.Equal(t, tt.have.Status, claims["status"])
+				assert.Equal(t, tt.have.Confirmation, claims["cnf"])
+			}
+		})
+	}
+}
+
+func TestSDJWTVCErrors(t *testing.T) {
+	tts := []struct {
+		name         string
+		instructions InstructionsV2
+		vc           VC
+		want         error
+	}{
+		{
+			name: "unknown type",
+			vc:   VC{Type: "sd-jwt", VCT: mockVC.VCT, Issuer: mockVC.Issuer},
+			want: ErrVCTypeNotValid,
+		},
+		{
+			name: "missing vct",
+			vc:   VC{Issuer: mockVC.Issuer},
+			want: ErrVCClaimMissing,
+		},
+		{
+			name: "missing iss",
+			vc:   VC{VCT: mockVC.VCT},
+			want: ErrVCClaimMissing,
+		},
+		{
+			name: "selective disclosable iss",
+			instructions: InstructionsV2{
+				&ChildInstructionV2{Name: "iss", Value: mockVC.Issuer, SelectiveDisclosure: true},
+			},
+			vc:   VC{VCT: mockVC.VCT},
+			want: ErrVCClaimSelectiveDisclosure,
+		},
+		{
+			name: "recursive status",
+			instructions: InstructionsV2{
+				&RecursiveInstructionV2{Name: "status"},
+			},
+			vc:   VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer},
+			want: ErrVCClaimSelectiveDisclosure,
+		},
+		{
+			name: "vct in both instructions and vc",
+			instructions: InstructionsV2{
+				&ChildInstructionV2{Name: "vct", Value: mockVC.VCT},
+			},
+			vc:   VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer},
+			want: ErrClaimNameExists,
+		},
+		{
+			name: "status is not an object",
+			instructions: InstructionsV2{
+				&ChildInstructionV2{Name: "status", Value: "valid"},
+			},
+			vc:   VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer},
+			want: ErrVCClaimNotValid,
+		},
+		{
+			name: "status_list without uri",
+			vc: VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer, Status: map[string]any{
+				"status_list": map[string]any{"idx": 0},
+			}},
+			want: ErrVCClaimNotValid,
+		},
+		{
+			name: "status_list with a negative idx",
+			vc: VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer, Status: map[string]any{
+				"status_list": map[string]any{"idx": -1, "uri": "https://example.com/statuslists/1"},
+			}},
+			want: ErrVCClaimNotValid,
+		},
+		{
+			name: "exp is not a NumericDate",
+			instructions: InstructionsV2{
+				&ChildInstructionV2{Name: "exp", Value: "2030-01-01"},
+			},
+			vc:   VC{VCT: mockVC.VCT, Issuer: mockVC.Issuer},
+			want: ErrVCClaimNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.instructions.SDJWTVC(tt.vc, jwt.SigningMethodHS256, "mura")
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestSDJWTVCPlainClaimsInInstructions(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "vct", Value: mockVC.VCT},
+		&ChildInstructionV2{Name: "iss", Value: mockVC.Issuer},
+	}
+
+	sdjwt, err := instructions.SDJWTVC(VC{}, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	claims, _, err := VerifyVC(mockVCPresentation(sdjwt), "mura")
+	assert.NoError(t, err)
+	assert.Equal(t, mockVC.VCT, claims["vct"])
+}
+
+func TestVerifyVCErrors(t *testing.T) {
+	tts := []struct {
+		name string
+		have func(t *testing.T) string
+		want error
+	}{
+		{
+			name: "not a SD-JWT VC type",
+			have: func(t *testing.T) string {
+				return mockPresentation(t, InstructionsV2{
+					&ChildInstructionV2{Name: "vct", Value: mockVC.VCT},
+					&ChildInstructionV2{Name: "iss", Value: mockVC.Issuer},
+				}, "mura")
+			},
+			want: ErrVCTypeNotValid,
+		},
+		{
+			name: "selective disclosed iss",
+			have: func(t *testing.T) string {
+				payload := jwt.MapClaims{"vct": mockVC.VCT}
+				disclosures := DisclosuresV2{}
+				err := makeSDV2([]Instruction{
+					&ChildInstructionV2{Name: "iss", Value: mockVC.Issuer, SelectiveDisclosure: true},
+				}, payload, disclosures)
+				assert.NoError(t, err)
+
+				token, err := sign(payload, map[string]any{"typ": TypeSDJWTVC}, jwt.SigningMethodHS256, []byte("mura"))
+				assert.NoError(t, err)
+				return mockVCPresentation(&SDJWT{JWT: token, Disclosures: disclosures})
+			},
+			want: ErrVCClaimSelectiveDisclosure,
+		},
+		{
+			name: "missing vct",
+			have: func(t *testing.T) string {
+				token, err := sign(jwt.MapClaims{"iss": mockVC.Issuer}, map[string]any{"typ": TypeSDJWTVC}, jwt.SigningMethodHS256, []byte("mura"))
+				assert.NoError(t, err)
+				return token + "~"
+			},
+			want: ErrVCClaimMissing,
+		},
+		{
+			name: "iat is not a NumericDate",
+			have: func(t *testing.T) string {
+				token, err := sign(jwt.MapClaims{"vct": mockVC.VCT, "iss": mockVC.Issuer, "iat": "now"}, map[string]any{"typ": TypeSDJWTVC}, jwt.SigningMethodHS256, []byte("mura"))
+				assert.NoError(t, err)
+				return token + "~"
+			},
+			want: ErrVCClaimNotValid,
+		},
+		{
+			name: "status_list idx is not a number",
+			have: func(t *testing.T) string {
+				token, err := sign(jwt.MapClaims{
+					"vct":    mockVC.VCT,
+					"iss":    mockVC.Issuer,
+					"status": map[string]any{"status_list": map[string]any{"idx": "0", "uri": "https://example.com/statuslists/1"}},
+				}, map[string]any{"typ": TypeSDJWTVC}, jwt.SigningMethodHS256, []byte("mura"))
+				assert.NoError(t, err)
+				return token + "~"
+			},
+			want: ErrVCClaimNotValid,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := VerifyVC(tt.have(t), "mura")
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	_, _, err := VerifyVC(strings.Repeat("x", 10), "mura")
+	assert.Error(t, err)
+}
+
+func TestSDJWTVCDigests(t *testing.T) {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+	}
+	sdjwt, err := instructions.SDJWTVC(mockVC, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(sdjwt.JWT, claims)
+	assert.NoError(t, err)
+	assert.Equal(t, SDAlgSHA256, claims["_sd_alg"])
+
+	disclosure := sdjwt.Disclosures.ArrayHashes()[0]
+	digest := sha256.Sum256([]byte(disclosure))
+	assert.Equal(t, []any{base64.RawURLEncoding.EncodeToString(digest[:])}, claims["_sd"])
+}
+
+func TestVerifyVCKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+	}
+	sdjwt, err := instructions.SDJWTVC(mockVC, jwt.SigningMethodES256, key)
+	assert.NoError(t, err)
+
+	claims, _, err := VerifyVC(mockVCPresentation(sdjwt), &key.PublicKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "John", claims["given_name"])
+}
@@ -1,8 +1,10 @@
 package gosdjwt
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -53,14 +55,14 @@ func VerifySignature(token, signingAlg string, pubKey any) error {
 	return jwtToken.Method.Verify(signingString, sig, pubKey)
 }
 
-func parseJWTAndValidate(sdjwt, key string) (jwt.MapClaims, *Validation, error) {
+func parseJWTAndValidate(sdjwt string, key any) (jwt.MapClaims, *Validation, error) {
 	c := jwt.MapClaims{}
 	validation := &Validation{
 		SignaturePolicy: SignaturePolicyPassed, // TODO(masv): Fix this
 	}
 
 	token, err := jwt.ParseWithClaims(sdjwt, c, func(token *jwt.Token) (any, error) {
-		return []byte(key), nil
+		return keyOf(key), nil
 	})
 	if err != nil {
 		return nil, validation, err
@@ -68,97 +70,307 @@ func parseJWTAndValidate(sdjwt, key string) (jwt.MapClaims, *Validation, error)
 
 	if token.Valid {
 		validation.Verify = true
+		validation.Header = token.Header
 		return c, validation, nil
 	}
 
 	return nil, validation, ErrTokenNotValid
 }
 
-// TODO(masv): whats the point of this?
-func run(claims jwt.MapClaims, s []string) (jwt.MapClaims, error) {
+// reconstruction keeps track of the disclosures while the claims are reconstructed
+type reconstruction struct {
+	disclosures DisclosuresV2
+	used        map[string]bool
+	// undisclosed counts digests without a disclosure by the path of the object or array they belong to
+	undisclosed map[string]int
+	// disclosed are the claims replaced by a disclosure, in the order they were found
+	disclosed []disclosedClaim
+}
+
+// disclosedClaim is a claim from a disclosure, path is the path of the claim and digestPath the path of its digest
+type disclosedClaim struct {
+	path       string
+	digestPath string
+	disclosure Disclosure
+}
+
+func newReconstruction(disclosures DisclosuresV2) *reconstruction {
+	return &reconstruction{
+		disclosures: disclosures,
+		used:        map[string]bool{},
+		undisclosed: map[string]int{},
+	}
+}
+
+// reconstructClaims replaces the digests of a SD-JWT payload with the claims from its disclosures
+func reconstructClaims(claims jwt.MapClaims, s []string) (jwt.MapClaims, *reconstruction, error) {
+	if alg, ok := claims["_sd_alg"]; ok && alg != SDAlgSHA256 {
+		return nil, nil, fmt.Errorf("%w: %w: %v", ErrSDJWTNotValid, ErrSDAlgNotSupported, alg)
+	}
+
 	disclosures := DisclosuresV2{}
 	if err := disclosures.new(s); err != nil {
-		return nil, err
-
+		return nil, nil, err
 	}
 
-	_, err := addClaims(claims, disclosures, "")
+	r := newReconstruction(disclosures)
+	reconstructed, err := r.object(claims, "")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	removeSDClaims(claims)
-	return claims, nil
+	for claimHash := range disclosures {
+		if !r.used[claimHash] {
+			return nil, nil, fmt.Errorf("%w: %s", ErrDisclosureNotReferenced, claimHash)
+		}
+	}
+
+	return jwt.MapClaims(reconstructed), r, nil
+}
+
+func (r *reconstruction) disclosure(digest string) (Disclosure, bool, error) {
+	disclosure, ok := r.disclosures.get(digest)
+	if !ok {
+		return Disclosure{}, false, nil
+	}
+	if r.used[digest] {
+		return Disclosure{}, false, fmt.Errorf("%w: %w: %s", ErrSDJWTNotValid, ErrDigestNotUnique, digest)
+	}
+	r.used[digest] = true
+	return disclosure, true, nil
 }
 
-func removeSDClaims(claims jwt.MapClaims) {
+func (r *reconstruction) object(claims map[string]any, path string) (map[string]any, error) {
+	reconstructed := map[string]any{}
 	for claimKey, claimValue := range claims {
 		switch claimKey {
 		case "_sd_alg", "_sd":
-			delete(claims, claimKey)
+			continue
 		}
+		v, err := r.value(claimValue, joinPath(path, claimKey))
+		if err != nil {
+			return nil, err
+		}
+		reconstructed[claimKey] = v
+	}
 
-		switch claimV := claimValue.(type) {
-		case jwt.MapClaims:
-			removeSDClaims(claimV)
-		case map[string]any:
-			removeSDClaims(claimV)
+	digests, _ := claims["_sd"].([]any)
+	for i, d := range digests {
+		digest, ok := d.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %w: %s", ErrSDJWTNotValid, ErrDisclosureNotValid, path)
 		}
+		disclosure, ok, err := r.disclosure(digest)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			r.undisclosed[path]++
+			continue
+		}
+		if disclosure.element {
+			return nil, fmt.Errorf("%w: %w: array element disclosure in %s._sd", ErrSDJWTNotValid, ErrDisclosureNotValid, path)
+		}
+		switch disclosure.name {
+		case "", "_sd", "...":
+			return nil, fmt.Errorf("%w: %w: claim name %q in %s._sd", ErrSDJWTNotValid, ErrDisclosureNotValid, disclosure.name, path)
+		}
+		claimPath := joinPath(path, disclosure.name)
+		if _, exists := reconstructed[disclosure.name]; exists {
+			return nil, fmt.Errorf("%w: %w: %s", ErrSDJWTNotValid, ErrClaimNameExists, claimPath)
+		}
+		r.disclosed = append(r.disclosed, disclosedClaim{
+			path:       claimPath,
+			digestPath: fmt.Sprintf("%s[%d]", joinPath(path, "_sd"), i),
+			disclosure: disclosure,
+		})
+		v, err := r.value(disclosure.value, claimPath)
+		if err != nil {
+			return nil, err
+		}
+		reconstructed[disclosure.name] = v
 	}
-	fmt.Println("claims", claims)
-}
 
-func addClaims(claims jwt.MapClaims, disclosures DisclosuresV2, parentName string) (jwt.MapClaims, error) {
-	for claimKey, claimValue := range claims {
+	return reconstructed, nil
+}
 
-		switch claimV := claimValue.(type) {
-		case jwt.MapClaims:
-			_, err := addClaims(claimV, disclosures, claimKey)
+func (r *reconstruction) array(claims []any, path string) ([]any, error) {
+	reconstructed := []any{}
+	for i, element := range claims {
+		elementPath := fmt.Sprintf("%s[%d]", path, len(reconstructed))
+		if digest, ok := arrayElementDigest(element); ok {
+			disclosure, ok, err := r.disclosure(digest)
 			if err != nil {
 				return nil, err
 			}
-
-		case []any:
-			fmt.Println("digg deeper in array")
-			fmt.Println("claimKey", claimKey, "claimValue", claimValue)
-			for i, v := range claimValue.([]any) {
-				disco, ok := disclosures.get(v.(string))
-				if !ok {
-					fmt.Println("delete", claimKey, "index", i, "value", v)
-					claims[claimKey].([]any)[i] = claims[claimKey].([]any)[len(claims[claimKey].([]any))-1]
-				} else {
-					if parentName == "" {
-						fmt.Println("we are at the root level")
-						claims[disco.name] = disco.value
-					}
-					fmt.Println("disco", disco)
-					fmt.Println("xxxxx disclosure found", claimKey)
-				}
+			if !ok {
+				r.undisclosed[path]++
+				continue
+			}
+			if !disclosure.element {
+				return nil, fmt.Errorf("%w: %w: object member disclosure in %s[%d]", ErrSDJWTNotValid, ErrDisclosureNotValid, path, i)
 			}
+			r.disclosed = append(r.disclosed, disclosedClaim{
+				path:       elementPath,
+				digestPath: fmt.Sprintf("%s[%d]", path, i),
+				disclosure: disclosure,
+			})
+			element = disclosure.value
 		}
+		v, err := r.value(element, elementPath)
+		if err != nil {
+			return nil, err
+		}
+		reconstructed = append(reconstructed, v)
+	}
+	return reconstructed, nil
+}
+
+func (r *reconstruction) value(v any, path string) (any, error) {
+	switch claim := v.(type) {
+	case jwt.MapClaims:
+		return r.object(claim, path)
+	case map[string]any:
+		return r.object(claim, path)
+	case []any:
+		return r.array(claim, path)
+	default:
+		return v, nil
+	}
+}
+
+// arrayElementDigest returns the digest of an array element in the form {"...": digest}
+func arrayElementDigest(element any) (string, bool) {
+	m, ok := element.(map[string]any)
+	if !ok || len(m) != 1 {
+		return "", false
 	}
-	return claims, nil
+	digest, ok := m["..."].(string)
+	return digest, ok
 }
 
 // Validation contains the result of the validation
 type Validation struct {
 	Verify          bool
 	SignaturePolicy string
+
+	// Header is the JOSE header of the verified JWT
+	Header map[string]any
+
+	// Status is the status of the credential in its status list, nil if it was not checked
+	Status *StatusResult
+
+	// Type is the resolved type metadata of the vct claim, nil if it was not resolved
+	Type *ResolvedType
+}
+
+// Verifier verifies SD-JWTs, with optional checks besides the signature and the disclosures
+type Verifier struct {
+	// Key verifies the signature, a string is used as a HMAC secret
+	Key any
+
+	// KeyResolver finds the key that verifies the signature, if set, instead of Key
+	KeyResolver KeyResolver
+
+	// VC checks the SD-JWT VC profile, as VerifyVC does
+	VC bool
+
+	// StatusChecker checks the status claim, if set, and reports it in Validation.Status
+	StatusChecker *StatusChecker
+
+	// TypeMetadata resolves the type metadata of the vct claim, if set, checks the claims against its schemas
+	// and reports it in Validation.Type
+	TypeMetadata *TypeMetadataResolver
+
+	// KeyBindingMaxAge is how old the iat of a KB-JWT may be, DefaultKeyBindingMaxAge if zero
+	KeyBindingMaxAge time.Duration
+}
+
+// keyBindingMaxAge returns KeyBindingMaxAge, or DefaultKeyBindingMaxAge if it is not set
+func (v *Verifier) keyBindingMaxAge() time.Duration {
+	if v.KeyBindingMaxAge == 0 {
+		return DefaultKeyBindingMaxAge
+	}
+	return v.KeyBindingMaxAge
+}
+
+// Verify verifies the SDJWT and returns the claims and the validation.
+// A credential that is revoked or suspended is not an error, its status is reported in the validation.
+func (v *Verifier) Verify(ctx context.Context, sdjwt string) (jwt.MapClaims, *Validation, error) {
+	claims, _, validation, err := v.verifyReconstruction(ctx, sdjwt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, validation, nil
+}
+
+// verifyReconstruction is Verify that also returns the reconstruction of the claims
+func (v *Verifier) verifyReconstruction(ctx context.Context, sdjwt string) (jwt.MapClaims, *reconstruction, *Validation, error) {
+	key := v.Key
+	if v.KeyResolver != nil {
+		var err error
+		if key, err = resolveKey(ctx, v.KeyResolver, sdjwt); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	claims, r, validation, err := verify(sdjwt, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if v.VC {
+		if err := checkVCProfile(claims, r, validation); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if v.TypeMetadata != nil {
+		vct, ok := claims["vct"].(string)
+		if !ok || vct == "" {
+			return nil, nil, nil, fmt.Errorf("%w: vct", ErrVCClaimMissing)
+		}
+		integrity, _ := claims["vct#integrity"].(string)
+		if validation.Type, err = v.TypeMetadata.Resolve(ctx, vct, integrity); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := validation.Type.Validate(claims); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if v.StatusChecker != nil {
+		validation.Status, err = v.StatusChecker.Check(ctx, claims)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return claims, r, validation, nil
 }
 
 // Verify verifies the SDJWT and returns the claims and the validation
 func Verify(sdjwt, key string) (jwt.MapClaims, *Validation, error) {
+	claims, _, validation, err := verify(sdjwt, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, validation, nil
+}
+
+// verify verifies the SDJWT with key, a string is used as a HMAC secret
+func verify(sdjwt string, key any) (jwt.MapClaims, *reconstruction, *Validation, error) {
 	sd := splitSDJWT(sdjwt)
 
 	claims, validation, err := parseJWTAndValidate(sd.JWT, key)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	j, err := run(claims, sd.Disclosures)
+	j, r, err := reconstructClaims(claims, sd.Disclosures)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	return j, validation, nil
+	return j, r, validation, nil
 }
@@ -1,5 +1,262 @@
 package gosdjwt
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconstructClaims(t *testing.T) {
+	tts := []struct {
+		name         string
+		instructions InstructionsV2
+		disclose     []string
+		want         jwt.MapClaims
+	}{
+		{
+			name: "test 0 - plain and selective disclosure claims",
+			instructions: InstructionsV2{
+				&ChildInstructionV2{Name: "sub", Value: "test-2"},
+				&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+				&ChildInstructionV2{Name: "family_name", Value: "Doe", SelectiveDisclosure: true},
+			},
+			disclose: []string{"given_name"},
+			want: jwt.MapClaims{
+				"sub":        "test-2",
+				"given_name": "John",
+			},
+		},
+		{
+			name: "test 1 - selective disclosure parent",
+			instructions: InstructionsV2{
+				&ParentInstructionV2{
+					Name:                "address",
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "country", Value: "sweden"},
+					},
+				},
+			},
+			disclose: []string{"address"},
+			want: jwt.MapClaims{
+				"address": map[string]any{
+					"country": "sweden",
+				},
+			},
+		},
+		{
+			name: "test 2 - recursive parent with one disclosed child",
+			instructions: InstructionsV2{
+				&RecursiveInstructionV2{
+					Name: "address",
+					Children: []Instruction{
+						&ChildInstructionV2{Name: "country", Value: "sweden"},
+						&ChildInstructionV2{Name: "street", Value: "Storgatan 1"},
+					},
+				},
+			},
+			disclose: []string{"address", "street"},
+			want: jwt.MapClaims{
+				"address": map[string]any{
+					"street": "Storgatan 1",
+				},
+			},
+		},
+		{
+			name: "test 3 - array with selective disclosure elements",
+			instructions: InstructionsV2{
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "SE"},
+						&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+						&ChildInstructionV2{Value: "NO", SelectiveDisclosure: true},
+					},
+				},
+			},
+			disclose: []string{""},
+			want: jwt.MapClaims{
+				"nationalities": []any{"SE", "DK", "NO"},
+			},
+		},
+		{
+			name: "test 4 - selective disclosure parent with nested parent and array",
+			instructions: InstructionsV2{
+				&ParentInstructionV2{
+					Name:                "address",
+					SelectiveDisclosure: true,
+					Children: []Instruction{
+						&ChildArrayInstructionV2{
+							Name: "lines",
+							Children: []Instruction{
+								&ChildInstructionV2{Value: "Storgatan 1"},
+							},
+						},
+						&ParentInstructionV2{
+							Name: "region",
+							Children: []Instruction{
+								&ChildInstructionV2{Name: "country", Value: "sweden"},
+							},
+						},
+					},
+				},
+			},
+			disclose: []string{"address"},
+			want: jwt.MapClaims{
+				"address": map[string]any{
+					"lines": []any{"Storgatan 1"},
+					"region": map[string]any{
+						"country": "sweden",
+					},
+				},
+			},
+		},
+		{
+			name: "test 5 - array without disclosed elements",
+			instructions: InstructionsV2{
+				&ChildArrayInstructionV2{
+					Name: "nationalities",
+					Children: []Instruction{
+						&ChildInstructionV2{Value: "SE"},
+						&ChildInstructionV2{Value: "DK", SelectiveDisclosure: true},
+					},
+				},
+			},
+			want: jwt.MapClaims{
+				"nationalities": []any{"SE"},
+			},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			presentation := mockPresentation(t, tt.instructions, "mura", tt.disclose...)
+
+			got, validation, err := Verify(presentation, "mura")
+			assert.NoError(t, err)
+			assert.True(t, validation.Verify)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// mockDisclosure returns the parsed disclosure of the JSON array of parts
+func mockDisclosure(t *testing.T, parts ...any) Disclosure {
+	b, err := json.Marshal(parts)
+	assert.NoError(t, err)
+	disclosure := Disclosure{}
+	assert.NoError(t, disclosure.parse(base64.RawURLEncoding.EncodeToString(b)))
+	return disclosure
+}
+
+func TestReconstructClaimsErrors(t *testing.T) {
+	disclosure := Disclosure{}
+	assert.NoError(t, disclosure.parse("WyJzYWx0X3p5eCIsImdpdmVuX25hbWUiLCJKb2huIl0"))
+	element := mockDisclosure(t, "salt_zyx", "SE")
+	otherGivenName := mockDisclosure(t, "salt_abc", "given_name", "Jane")
+
+	tts := []struct {
+		name        string
+		claims      jwt.MapClaims
+		disclosures []string
+		want        error
+	}{
+		{
+			name:        "disclosure not referenced",
+			claims:      jwt.MapClaims{"sub": "test-2"},
+			disclosures: []string{disclosure.disclosureHash},
+			want:        ErrDisclosureNotReferenced,
+		},
+		{
+			name: "digest referenced twice",
+			claims: jwt.MapClaims{
+				"_sd": []any{disclosure.claimHash},
+				"address": map[string]any{
+					"_sd": []any{disclosure.claimHash},
+				},
+			},
+			disclosures: []string{disclosure.disclosureHash},
+			want:        ErrDigestNotUnique,
+		},
+		{
+			name: "disclosed claim name exists",
+			claims: jwt.MapClaims{
+				"_sd":        []any{disclosure.claimHash},
+				"given_name": "Jane",
+			},
+			disclosures: []string{disclosure.disclosureHash},
+			want:        ErrClaimNameExists,
+		},
+		{
+			name:        "disclosure not valid",
+			claims:      jwt.MapClaims{},
+			disclosures: []string{"WyJzYWx0X3p5eCJd"},
+			want:        ErrDisclosureNotValid,
+		},
+		{
+			name:        "array element disclosure in an object",
+			claims:      jwt.MapClaims{"_sd": []any{element.claimHash}},
+			disclosures: []string{element.disclosureHash},
+			want:        ErrDisclosureNotValid,
+		},
+		{
+			name:        "object member disclosure in an array",
+			claims:      jwt.MapClaims{"nationalities": []any{map[string]any{"...": disclosure.claimHash}}},
+			disclosures: []string{disclosure.disclosureHash},
+			want:        ErrDisclosureNotValid,
+		},
+		{
+			name:        "empty claim name",
+			claims:      jwt.MapClaims{"_sd": []any{mockDisclosure(t, "salt_zyx", "", "x").claimHash}},
+			disclosures: []string{mockDisclosure(t, "salt_zyx", "", "x").disclosureHash},
+			want:        ErrDisclosureNotValid,
+		},
+		{
+			name:        "reserved claim name _sd",
+			claims:      jwt.MapClaims{"_sd": []any{mockDisclosure(t, "salt_zyx", "_sd", []any{"x"}).claimHash}},
+			disclosures: []string{mockDisclosure(t, "salt_zyx", "_sd", []any{"x"}).disclosureHash},
+			want:        ErrDisclosureNotValid,
+		},
+		{
+			name:        "reserved claim name ...",
+			claims:      jwt.MapClaims{"_sd": []any{mockDisclosure(t, "salt_zyx", "...", "x").claimHash}},
+			disclosures: []string{mockDisclosure(t, "salt_zyx", "...", "x").disclosureHash},
+			want:        ErrDisclosureNotValid,
+		},
+		{
+			name:        "duplicate disclosed claim name",
+			claims:      jwt.MapClaims{"_sd": []any{disclosure.claimHash, otherGivenName.claimHash}},
+			disclosures: []string{disclosure.disclosureHash, otherGivenName.disclosureHash},
+			want:        ErrClaimNameExists,
+		},
+		{
+			name:        "_sd_alg not supported",
+			claims:      jwt.MapClaims{"_sd_alg": "sha-512"},
+			disclosures: []string{},
+			want:        ErrSDAlgNotSupported,
+		},
+		{
+			name:        "same disclosure twice",
+			claims:      jwt.MapClaims{"_sd": []any{disclosure.claimHash}},
+			disclosures: []string{disclosure.disclosureHash, disclosure.disclosureHash},
+			want:        ErrDigestNotUnique,
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := reconstructClaims(tt.claims, tt.disclosures)
+			assert.ErrorIs(t, err, tt.want)
+			if tt.want != ErrDisclosureNotReferenced {
+				assert.ErrorIs(t, err, ErrSDJWTNotValid)
+			}
+		})
+	}
+}
+
 //func TestParseAndValidate(t *testing.T) {
 //	type want struct {
 //		jwt        jwt.MapClaims
@@ -24,7 +281,7 @@ package gosdjwt
 //						"country": "sweden",
 //					},
 //					"_sd": []any{
-//						"MzE0ZDU5NzY0NGQ4YjRlZTM1YjJjYWMwNGFlNmMwM2JiNGFmYTk5ODQxMDhjMzIzNGQ3ZTY2NmZmMWJmYzk4Nw",
+//						"MU1ZdkTYtO41ssrASubAO7SvqZhBCMMjTX5mb_G_yYc",
 //						"Zjc4YWM0MzQ5ODJiY2RiZmIyN2RkNDMwZmY5M2Q3N2FhOGYxMzQ2YWQ4ODYyZGVjMTQ4NjQ2YzcxM2E0MDUzZg",
 //					},
 //				},
@@ -132,7 +389,7 @@ package gosdjwt
 //						"country": "sweden",
 //					},
 //					"_sd": []any{
-//						"MzE0ZDU5NzY0NGQ4YjRlZTM1YjJjYWMwNGFlNmMwM2JiNGFmYTk5ODQxMDhjMzIzNGQ3ZTY2NmZmMWJmYzk4Nw",
+//						"MU1ZdkTYtO41ssrASubAO7SvqZhBCMMjTX5mb_G_yYc",
 //						"Zjc4YWM0MzQ5ODJiY2RiZmIyN2RkNDMwZmY5M2Q3N2FhOGYxMzQ2YWQ4ODYyZGVjMTQ4NjQ2YzcxM2E0MDUzZg",
 //					},
 //				},
@@ -179,7 +436,7 @@ package gosdjwt
 //					"country": "sweden",
 //				},
 //				"_sd": []any{
-//					"MzE0ZDU5NzY0NGQ4YjRlZTM1YjJjYWMwNGFlNmMwM2JiNGFmYTk5ODQxMDhjMzIzNGQ3ZTY2NmZmMWJmYzk4Nw",
+//					"MU1ZdkTYtO41ssrASubAO7SvqZhBCMMjTX5mb_G_yYc",
 //					"Zjc4YWM0MzQ5ODJiY2RiZmIyN2RkNDMwZmY5M2Q3N2FhOGYxMzQ2YWQ4ODYyZGVjMTQ4NjQ2YzcxM2E0MDUzZg",
 //				},
 //			},
@@ -0,0 +1,456 @@
+package gosdjwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrCredentialNotFound is returned when a credential is not in the store
+	ErrCredentialNotFound = errors.New("credential is not found")
+
+	// ErrCredentialIDNotValid is returned when a credential ID is empty or has other characters than letters,
+	// digits, - and _
+	ErrCredentialIDNotValid = errors.New("credential id is not valid")
+)
+
+var credentialIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ParseSDJWT parses a serialized SD-JWT, the JWT followed by its disclosures and an optional key binding JWT
+// separated by ~. The signature is not verified.
+func ParseSDJWT(s string) (*SDJWT, error) {
+	presentation := splitSDJWT(s)
+	if strings.Count(presentation.JWT, ".") != 2 {
+		return nil, fmt.Errorf("%w: JWT", ErrSDJWTNotValid)
+	}
+
+	disclosures := DisclosuresV2{}
+	if err := disclosures.new(presentation.Disclosures); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSDJWTNotValid, err)
+	}
+
+	return &SDJWT{
+		JWT:         presentation.JWT,
+		Disclosures: disclosures,
+		KeyBinding:  presentation.KeyBinding,
+	}, nil
+}
+
+// String returns the serialized SD-JWT, the JWT and each disclosure followed by ~, and the key binding JWT if any
+func (s *SDJWT) String() string {
+	serialized := s.JWT + "~"
+	for _, disclosure := range s.Disclosures.ArrayHashes() {
+		serialized += disclosure + "~"
+	}
+	return serialized + s.KeyBinding
+}
+
+// StoredCredential is a credential held by a wallet, with metadata from its payload
+type StoredCredential struct {
+	// ID identifies the credential in a store, a UUID is used if empty when it is stored
+	ID    string
+	SDJWT *SDJWT
+
+	Issuer    string
+	VCT       string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	// HolderKeyID refers to the holder key the credential is bound to, empty if it is not bound
+	HolderKeyID string
+
+	StoredAt time.Time
+
+	// Claims are the claims with all disclosures applied
+	Claims map[string]any
+}
+
+// NewStoredCredential parses a serialized SD-JWT into a credential, holderKeyID is the optional holder key.
+// The signature is not verified, the credential should have been verified when it was received.
+func NewStoredCredential(sdjwt, holderKeyID string) (*StoredCredential, error) {
+	parsed, err := ParseSDJWT(sdjwt)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(parsed.JWT, claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSDJWTNotValid, err)
+	}
+	reconstructed, _, err := reconstructClaims(claims, parsed.Disclosures.ArrayHashes())
+	if err != nil {
+		return nil, err
+	}
+
+	credential := &StoredCredential{
+		SDJWT:       parsed,
+		HolderKeyID: holderKeyID,
+		Claims:      reconstructed,
+	}
+	credential.Issuer, _ = claims["iss"].(string)
+	credential.VCT, _ = claims["vct"].(string)
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		credential.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		credential.ExpiresAt = exp.Time
+	}
+	return credential, nil
+}
+
+// clone returns a deep copy of the credential, changes to the copy do not reach the credential
+func (c *StoredCredential) clone() *StoredCredential {
+	clone := *c
+	if c.SDJWT != nil {
+		sdjwt := *c.SDJWT
+		sdjwt.Disclosures = c.SDJWT.Disclosures.clone()
+		clone.SDJWT = &sdjwt
+	}
+	if c.Claims != nil {
+		clone.Claims = cloneClaims(c.Claims)
+	}
+	return &clone
+}
+
+// cloneClaims returns a deep copy of claims
+func cloneClaims(claims map[string]any) map[string]any {
+	clone := make(map[string]any, len(claims))
+	for name, value := range claims {
+		clone[name] = cloneClaimValue(value)
+	}
+	return clone
+}
+
+// cloneClaimValue returns a deep copy of the objects and arrays of a claim value, other values are immutable
+func cloneClaimValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return cloneClaims(v)
+	case jwt.MapClaims:
+		return jwt.MapClaims(cloneClaims(v))
+	case []any:
+		clone := make([]any, len(v))
+		for i, element := range v {
+			clone[i] = cloneClaimValue(element)
+		}
+		return clone
+	}
+	return value
+}
+
+// Expired returns true if the credential has an expiry that is not after now
+func (c *StoredCredential) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// storedCredentialJSON is how a credential is encoded, the claims are reconstructed from the SD-JWT when decoded
+type storedCredentialJSON struct {
+	ID          string    `json:"id"`
+	Credential  string    `json:"credential"`
+	Issuer      string    `json:"iss,omitempty"`
+	VCT         string    `json:"vct,omitempty"`
+	IssuedAt    time.Time `json:"iat"`
+	ExpiresAt   time.Time `json:"exp"`
+	HolderKeyID string    `json:"holder_key_id,omitempty"`
+	StoredAt    time.Time `json:"stored_at"`
+}
+
+// MarshalJSON encodes the credential with its SD-JWT serialized
+func (c *StoredCredential) MarshalJSON() ([]byte, error) {
+	if c.SDJWT == nil {
+		return nil, fmt.Errorf("%w: %s has no SD-JWT", ErrSDJWTNotValid, c.ID)
+	}
+	return json.Marshal(storedCredentialJSON{
+		ID:          c.ID,
+		Credential:  c.SDJWT.String(),
+		Issuer:      c.Issuer,
+		VCT:         c.VCT,
+		IssuedAt:    c.IssuedAt,
+		ExpiresAt:   c.ExpiresAt,
+		HolderKeyID: c.HolderKeyID,
+		StoredAt:    c.StoredAt,
+	})
+}
+
+// UnmarshalJSON decodes a credential encoded by MarshalJSON
+func (c *StoredCredential) UnmarshalJSON(b []byte) error {
+	encoded := storedCredentialJSON{}
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return err
+	}
+
+	credential, err := NewStoredCredential(encoded.Credential, encoded.HolderKeyID)
+	if err != nil {
+		return err
+	}
+	credential.ID = encoded.ID
+	credential.StoredAt = encoded.StoredAt
+
+	*c = *credential
+	return nil
+}
+
+// ClaimFilter matches credentials with a claim at Path
+type ClaimFilter struct {
+	// Path selects claims like ClaimMetadata.Path, strings select object members, integers array elements and
+	// null all array elements
+	Path []any
+
+	// Values are the accepted values of the claim, any value is accepted if empty
+	Values []any
+}
+
+// CredentialQuery selects credentials, empty fields match any credential
+type CredentialQuery struct {
+	VCT    string
+	Issuer string
+
+	// Claims all have to match
+	Claims []ClaimFilter
+
+	// Expired includes expired credentials, they are left out by default
+	Expired bool
+}
+
+// Matches returns true if the credential is selected by the query at now
+func (q CredentialQuery) Matches(c *StoredCredential, now time.Time) bool {
+	if q.VCT != "" && q.VCT != c.VCT {
+		return false
+	}
+	if q.Issuer != "" && q.Issuer != c.Issuer {
+		return false
+	}
+	if !q.Expired && c.Expired(now) {
+		return false
+	}
+	for _, filter := range q.Claims {
+		if !filter.matches(c.Claims) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f ClaimFilter) matches(claims map[string]any) bool {
+	selected := selectClaims(claims, f.Path)
+	if len(f.Values) == 0 {
+		return len(selected) > 0
+	}
+	for _, v := range selected {
+		for _, want := range f.Values {
+			if schemaEqual(want, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectClaims returns the values that path selects in claims, see ClaimFilter.Path
+func selectClaims(claims any, path []any) []any {
+	values := []any{}
+	for _, selected := range selectClaimPaths(claims, path) {
+		values = append(values, selected.value)
+	}
+	return values
+}
+
+// selectedClaim is a claim selected by a claims path, path is its path as in reconstruction
+type selectedClaim struct {
+	path  string
+	value any
+}
+
+// selectClaimPaths returns the claims that path selects in claims, see ClaimFilter.Path and parseJSONPath
+func selectClaimPaths(claims any, path []any) []selectedClaim {
+	selected := []selectedClaim{{value: claims}}
+	for _, selector := range path {
+		next := []selectedClaim{}
+		for _, claim := range selected {
+			switch s := selector.(type) {
+			case string:
+				object, ok := claim.value.(map[string]any)
+				if !ok {
+					continue
+				}
+				if member, ok := object[s]; ok {
+					next = append(next, selectedClaim{path: joinPath(claim.path, s), value: member})
+				}
+			case nil:
+				array, _ := claim.value.([]any)
+				for i, element := range array {
+					next = append(next, selectedClaim{path: fmt.Sprintf("%s[%d]", claim.path, i), value: element})
+				}
+			case jsonPathWildcard:
+				object, _ := claim.value.(map[string]any)
+				names := make([]string, 0, len(object))
+				for name := range object {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					next = append(next, selectedClaim{path: joinPath(claim.path, name), value: object[name]})
+				}
+				array, _ := claim.value.([]any)
+				for i, element := range array {
+					next = append(next, selectedClaim{path: fmt.Sprintf("%s[%d]", claim.path, i), value: element})
+				}
+			default:
+				array, _ := claim.value.([]any)
+				if i, ok := schemaNumber(s); ok && i >= 0 && int(i) < len(array) && i == float64(int(i)) {
+					next = append(next, selectedClaim{path: fmt.Sprintf("%s[%d]", claim.path, int(i)), value: array[int(i)]})
+				}
+			}
+		}
+		selected = next
+	}
+	return selected
+}
+
+// CredentialStore stores the credentials of a wallet
+type CredentialStore interface {
+	// Put stores the credential, replacing a credential with the same ID, and sets its ID if it is empty
+	Put(ctx context.Context, credential *StoredCredential) error
+
+	// Get returns the credential with id, or ErrCredentialNotFound
+	Get(ctx context.Context, id string) (*StoredCredential, error)
+
+	// Delete removes the credential with id, or returns ErrCredentialNotFound
+	Delete(ctx context.Context, id string) error
+
+	// Query returns the credentials that match the query, oldest stored first
+	Query(ctx context.Context, query CredentialQuery) ([]*StoredCredential, error)
+
+	// Purge removes the credentials that are expired at now and returns how many were removed
+	Purge(ctx context.Context, now time.Time) (int, error)
+}
+
+// prepareCredential sets the ID and StoredAt of a credential that is about to be stored
+func prepareCredential(credential *StoredCredential, now time.Time) error {
+	if credential.SDJWT == nil {
+		return fmt.Errorf("%w: no SD-JWT", ErrSDJWTNotValid)
+	}
+	if credential.ID == "" {
+		credential.ID = newUUID()
+	}
+	if !credentialIDPattern.MatchString(credential.ID) {
+		return fmt.Errorf("%w: %q", ErrCredentialIDNotValid, credential.ID)
+	}
+	if credential.StoredAt.IsZero() {
+		credential.StoredAt = now
+	}
+	return nil
+}
+
+// sortCredentials sorts credentials by when they were stored, then by ID
+func sortCredentials(credentials []*StoredCredential) {
+	sort.Slice(credentials, func(a, b int) bool {
+		if !credentials[a].StoredAt.Equal(credentials[b].StoredAt) {
+			return credentials[a].StoredAt.Before(credentials[b].StoredAt)
+		}
+		return credentials[a].ID < credentials[b].ID
+	})
+}
+
+// MemoryCredentialStore is a CredentialStore in memory, it is safe for concurrent use and the zero value is ready
+// to use
+type MemoryCredentialStore struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	credentials map[string]StoredCredential
+}
+
+// NewMemoryCredentialStore returns an empty store
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{
+		now:         time.Now,
+		credentials: map[string]StoredCredential{},
+	}
+}
+
+// clock returns the current time
+func (s *MemoryCredentialStore) clock() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
+// Put stores a copy of the credential
+func (s *MemoryCredentialStore) Put(ctx context.Context, credential *StoredCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := prepareCredential(credential, s.clock()); err != nil {
+		return err
+	}
+	if s.credentials == nil {
+		s.credentials = map[string]StoredCredential{}
+	}
+	s.credentials[credential.ID] = *credential.clone()
+	return nil
+}
+
+// Get returns a copy of the credential with id
+func (s *MemoryCredentialStore) Get(ctx context.Context, id string) (*StoredCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credential, ok := s.credentials[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCredentialNotFound, id)
+	}
+	return credential.clone(), nil
+}
+
+// Delete removes the credential with id
+func (s *MemoryCredentialStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.credentials[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrCredentialNotFound, id)
+	}
+	delete(s.credentials, id)
+	return nil
+}
+
+// Query returns copies of the credentials that match the query
+func (s *MemoryCredentialStore) Query(ctx context.Context, query CredentialQuery) ([]*StoredCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	matches := []*StoredCredential{}
+	for _, credential := range s.credentials {
+		if query.Matches(&credential, now) {
+			matches = append(matches, credential.clone())
+		}
+	}
+	sortCredentials(matches)
+	return matches, nil
+}
+
+// Purge removes the credentials that are expired at now
+func (s *MemoryCredentialStore) Purge(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, credential := range s.credentials {
+		if credential.Expired(now) {
+			delete(s.credentials, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
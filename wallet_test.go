@@ -0,0 +1,218 @@
+package gosdjwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var mockWalletNow = time.Unix(1700000000, 0)
+
+// mockWalletCredential issues a credential of vct that expires at exp, if set
+func mockWalletCredential(t *testing.T, vct string, exp time.Time, country string) string {
+	return mockWalletCredentialVC(t, VC{VCT: vct, Issuer: "https://example.com/issuer"}, exp, country)
+}
+
+// mockWalletCredentialVC returns a credential of vc with the claims of mockWalletCredential
+func mockWalletCredentialVC(t *testing.T, vc VC, exp time.Time, country string) string {
+	instructions := InstructionsV2{
+		&ChildInstructionV2{Name: "iat", Value: mockWalletNow.Add(-time.Hour).Unix()},
+		&ChildInstructionV2{Name: "given_name", Value: "John", SelectiveDisclosure: true},
+		&ParentInstructionV2{Name: "address", SelectiveDisclosure: true, Children: []Instruction{
+			&ChildInstructionV2{Name: "country", Value: country, SelectiveDisclosure: true},
+		}},
+		&ChildArrayInstructionV2{Name: "nationalities", Children: []Instruction{
+			&ChildInstructionV2{Value: "FI", SelectiveDisclosure: true},
+			&ChildInstructionV2{Value: country, SelectiveDisclosure: true},
+		}},
+	}
+	if !exp.IsZero() {
+		instructions = append(instructions, &ChildInstructionV2{Name: "exp", Value: exp.Unix()})
+	}
+	sdjwt, err := instructions.SDJWTVC(vc, jwt.SigningMethodHS256, "mura")
+	assert.NoError(t, err)
+	return sdjwt.String()
+}
+
+func TestParseSDJWT(t *testing.T) {
+	serialized := mockWalletCredential(t, "https://example.com/pid", time.Time{}, "SE")
+
+	parsed, err := ParseSDJWT(serialized)
+	assert.NoError(t, err)
+	assert.Len(t, parsed.Disclosures, 5)
+	assert.Equal(t, serialized, parsed.String())
+
+	withKeyBinding, err := ParseSDJWT(serialized + "eyJhbGciOiJFUzI1NiJ9.e30.c2ln")
+	assert.NoError(t, err)
+	assert.Equal(t, "eyJhbGciOiJFUzI1NiJ9.e30.c2ln", withKeyBinding.KeyBinding)
+
+	_, err = ParseSDJWT("not a jwt~")
+	assert.ErrorIs(t, err, ErrSDJWTNotValid)
+
+	_, err = ParseSDJWT(parsed.JWT + "~bm90IGpzb24~")
+	assert.ErrorIs(t, err, ErrSDJWTNotValid)
+}
+
+func TestNewStoredCredential(t *testing.T) {
+	exp := mockWalletNow.Add(time.Hour)
+	credential, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/pid", exp, "DK"), "holder-key-1")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "https://example.com/issuer", credential.Issuer)
+	assert.Equal(t, "https://example.com/pid", credential.VCT)
+	assert.Equal(t, mockWalletNow.Add(-time.Hour), credential.IssuedAt)
+	assert.Equal(t, exp, credential.ExpiresAt)
+	assert.Equal(t, "holder-key-1", credential.HolderKeyID)
+	assert.Equal(t, map[string]any{"country": "DK"}, credential.Claims["address"])
+	assert.Equal(t, []any{"FI", "DK"}, credential.Claims["nationalities"])
+
+	assert.False(t, credential.Expired(mockWalletNow))
+	assert.True(t, credential.Expired(exp))
+}
+
+// testCredentialStore runs the same tests against each CredentialStore implementation
+func testCredentialStore(t *testing.T, store CredentialStore) {
+	ctx := context.Background()
+
+	pid, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/pid", mockWalletNow.Add(time.Hour), "DK"), "holder-key-1")
+	assert.NoError(t, err)
+	expired, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/pid", mockWalletNow.Add(-time.Minute), "SE"), "")
+	assert.NoError(t, err)
+	diploma, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/diploma", time.Time{}, "NO"), "")
+	assert.NoError(t, err)
+
+	for i, credential := range []*StoredCredential{pid, expired, diploma} {
+		credential.StoredAt = mockWalletNow.Add(time.Duration(i) * time.Second)
+		assert.NoError(t, store.Put(ctx, credential))
+		assert.NotEmpty(t, credential.ID)
+	}
+
+	t.Run("get", func(t *testing.T) {
+		got, err := store.Get(ctx, pid.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, pid.SDJWT.String(), got.SDJWT.String())
+		assert.Equal(t, pid.Claims, got.Claims)
+		assert.Equal(t, "holder-key-1", got.HolderKeyID)
+		assert.True(t, pid.StoredAt.Equal(got.StoredAt))
+
+		_, err = store.Get(ctx, "unknown")
+		assert.ErrorIs(t, err, ErrCredentialNotFound)
+	})
+
+	t.Run("get returns a copy", func(t *testing.T) {
+		got, err := store.Get(ctx, pid.ID)
+		assert.NoError(t, err)
+		got.Claims["vct"] = "changed"
+		got.Claims["nationalities"].([]any)[0] = "changed"
+		for k := range got.SDJWT.Disclosures {
+			delete(got.SDJWT.Disclosures, k)
+		}
+
+		again, err := store.Get(ctx, pid.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, pid.Claims, again.Claims)
+		assert.Equal(t, pid.SDJWT.String(), again.SDJWT.String())
+
+		queried, err := store.Query(ctx, CredentialQuery{VCT: "https://example.com/pid"})
+		assert.NoError(t, err)
+		for _, credential := range queried {
+			credential.Claims["vct"] = "changed"
+		}
+		again, err = store.Get(ctx, pid.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/pid", again.Claims["vct"])
+	})
+
+	tts := []struct {
+		name  string
+		query CredentialQuery
+		want  []*StoredCredential
+	}{
+		{name: "all that are not expired", want: []*StoredCredential{pid, diploma}},
+		{name: "including expired", query: CredentialQuery{Expired: true}, want: []*StoredCredential{pid, expired, diploma}},
+		{name: "by vct", query: CredentialQuery{VCT: "https://example.com/diploma"}, want: []*StoredCredential{diploma}},
+		{name: "by issuer", query: CredentialQuery{Issuer: "https://example.com/other"}, want: []*StoredCredential{}},
+		{
+			name:  "by claim value",
+			query: CredentialQuery{Expired: true, Claims: []ClaimFilter{{Path: []any{"address", "country"}, Values: []any{"SE", "NO"}}}},
+			want:  []*StoredCredential{expired, diploma},
+		},
+		{
+			name:  "by array element",
+			query: CredentialQuery{Claims: []ClaimFilter{{Path: []any{"nationalities", nil}, Values: []any{"DK"}}}},
+			want:  []*StoredCredential{pid},
+		},
+		{
+			name:  "by array index",
+			query: CredentialQuery{Claims: []ClaimFilter{{Path: []any{"nationalities", 0}, Values: []any{"SE"}}}},
+			want:  []*StoredCredential{},
+		},
+		{
+			name:  "by claim that is present",
+			query: CredentialQuery{Claims: []ClaimFilter{{Path: []any{"given_name"}}, {Path: []any{"family_name"}}}},
+			want:  []*StoredCredential{},
+		},
+	}
+
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Query(ctx, tt.query)
+			assert.NoError(t, err)
+
+			ids := []string{}
+			for _, credential := range got {
+				ids = append(ids, credential.ID)
+			}
+			wantIDs := []string{}
+			for _, credential := range tt.want {
+				wantIDs = append(wantIDs, credential.ID)
+			}
+			assert.Equal(t, wantIDs, ids)
+		})
+	}
+
+	t.Run("purge", func(t *testing.T) {
+		purged, err := store.Purge(ctx, mockWalletNow)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, purged)
+
+		_, err = store.Get(ctx, expired.ID)
+		assert.ErrorIs(t, err, ErrCredentialNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, store.Delete(ctx, diploma.ID))
+		assert.ErrorIs(t, store.Delete(ctx, diploma.ID), ErrCredentialNotFound)
+
+		got, err := store.Query(ctx, CredentialQuery{Expired: true})
+		assert.NoError(t, err)
+		assert.Len(t, got, 1)
+	})
+}
+
+func TestMemoryCredentialStore(t *testing.T) {
+	store := NewMemoryCredentialStore()
+	store.now = func() time.Time { return mockWalletNow }
+	testCredentialStore(t, store)
+}
+
+func TestMemoryCredentialStoreZeroValue(t *testing.T) {
+	ctx := context.Background()
+	store := &MemoryCredentialStore{}
+
+	credential, err := NewStoredCredential(mockWalletCredential(t, "https://example.com/pid", time.Time{}, "SE"), "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put(ctx, credential))
+
+	got, err := store.Get(ctx, credential.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, credential.Claims, got.Claims)
+
+	queried, err := store.Query(ctx, CredentialQuery{VCT: "https://example.com/pid"})
+	assert.NoError(t, err)
+	assert.Len(t, queried, 1)
+	assert.NoError(t, store.Delete(ctx, credential.ID))
+}